@@ -0,0 +1,155 @@
+// Command replay feeds a recorded log through the reactions of an engine config without executing anything and prints
+// what fired e.g. to tune the regexes of a new game without booting a server.
+//
+//	replay -config engine.yaml [-interval 1s] [-start 2023-01-01T00:00:00Z] [-group-start regex] [-group-continuation regex] [log]
+//
+// The log is read from stdin if no file is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/hostfactor/api/go/blueprint"
+	reaction2 "github.com/hostfactor/diazo/pkg/reaction"
+	"github.com/hostfactor/diazo/pkg/replay"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configPath := flags.String("config", "", "The YAML or JSON engine config with the reactions to replay. Required.")
+	interval := flags.Duration("interval", time.Second, "How long after the last line each line was logged.")
+	start := flags.String("start", "", "When the first line was logged as RFC 3339. Defaults to now.")
+	groupStart := flags.String("group-start", "", "Lines matching the regex start a new event. Every other line is appended to the previous event.")
+	groupContinuation := flags.String("group-continuation", "", "Lines matching the regex are appended to the previous event.")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *configPath == "" {
+		return fmt.Errorf("-config is required")
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	store := variable.NewStore()
+	declarer := store.(variable.Declarer)
+	for k, v := range conf.Types {
+		err = declarer.Declare(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	opts := replay.Opts{Store: store}
+
+	if *start != "" {
+		opts.Start, err = time.Parse(time.RFC3339, *start)
+		if err != nil {
+			return fmt.Errorf("invalid start %s", *start)
+		}
+	}
+
+	if *groupStart != "" || *groupContinuation != "" {
+		opts.Group = &reaction2.GroupLinesOpts{Start: *groupStart, Continuation: *groupContinuation}
+	}
+
+	log := stdin
+	if flags.NArg() > 0 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		log = f
+	}
+
+	// Failed actions are part of the timeline.
+	logrus.SetLevel(logrus.FatalLevel)
+
+	res, err := replay.ReplayLog(context.Background(), replayConfig(conf), log, *interval, opts)
+	if err != nil {
+		return err
+	}
+
+	return writeResult(stdout, res)
+}
+
+func loadConfig(fp string) (*reaction2.EngineConfig, error) {
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, filename := filepath.Split(abs)
+	return reaction2.LoadEngineConfig(os.DirFS(dir), filename)
+}
+
+// replayConfig is every log reaction of the engine config. Log reactions are numbered in the order of the logs.
+func replayConfig(conf *reaction2.EngineConfig) replay.Config {
+	out := replay.Config{Files: conf.Files}
+	for _, v := range conf.Logs {
+		out.LogReactions = append(out.LogReactions, v.Reactions...)
+		out.Logs = append(out.Logs, v.Compiled...)
+	}
+	return out
+}
+
+func writeResult(w io.Writer, res *replay.Result) error {
+	err := res.WriteTimeline(w)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, "\nStatuses:")
+	if err != nil {
+		return err
+	}
+
+	for _, v := range res.Statuses {
+		_, err = fmt.Fprintf(w, "  %s\n", v.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "\nVariables:")
+	if err != nil {
+		return err
+	}
+
+	vars := make([]*blueprint.Variable, 0, res.Store.Len())
+	res.Store.Range(func(_ string, value *blueprint.Variable) bool {
+		vars = append(vars, value)
+		return true
+	})
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].GetName() < vars[j].GetName()
+	})
+
+	for _, v := range vars {
+		_, err = fmt.Fprintf(w, "  %s=%q\n", v.GetName(), v.GetValue())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
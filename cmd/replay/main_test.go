@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"github.com/bxcodec/faker/v3"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type MainTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (m *MainTestSuite) BeforeTest(_, _ string) {
+	m.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(m.Dir, os.ModePerm)
+}
+
+func (m *MainTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(m.Dir)
+}
+
+func (m *MainTestSuite) TestRun() {
+	// -- Given
+	//
+	conf := filepath.Join(m.Dir, "engine.yaml")
+	_ = os.WriteFile(conf, []byte(`
+logs:
+  - path: /data/logs/latest.log
+    reactions:
+      - when: [{ matches: { regex: "server version (.*)" } }]
+        then: [{ setVariable: { name: version, value: "{{first_match}}" } }]
+      - when: [{ matches: { regex: "Done" } }]
+        then: [{ setStatus: { status: ready } }]
+`), os.ModePerm)
+	log := strings.NewReader("Starting minecraft server version 1.20.1\nPreparing spawn area\nDone (3.2s)!\n")
+	out := bytes.NewBuffer(nil)
+
+	// -- When
+	//
+	err := run([]string{"-config", conf, "-start", "2023-01-01T12:00:00Z"}, log, out)
+
+	// -- Then
+	//
+	if m.NoError(err) {
+		m.Equal(strings.Join([]string{
+			`12:00:01.000 log/0 line="Starting minecraft server version 1.20.1"`,
+			`12:00:03.000 log/1 line="Done (3.2s)!" status=ready`,
+			``,
+			`Statuses:`,
+			`  ready`,
+			``,
+			`Variables:`,
+			`  version="1.20.1"`,
+			``,
+		}, "\n"), out.String())
+	}
+}
+
+func (m *MainTestSuite) TestRunNoConfig() {
+	// -- When
+	//
+	err := run(nil, strings.NewReader(""), bytes.NewBuffer(nil))
+
+	// -- Then
+	//
+	m.Error(err)
+}
+
+func TestMainTestSuite(t *testing.T) {
+	suite.Run(t, new(MainTestSuite))
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -29,6 +30,7 @@ type Client interface {
 	Zip(z *actions.ZipFile) error
 	MoveFile(a *actions.MoveFile) error
 	Shell(ctx context.Context, a *actions.Shell) ([]byte, error)
+	Fetch(ctx context.Context, f *FetchFile, opts FetchOpts) error
 }
 
 type OnError func(err error)
@@ -88,11 +90,23 @@ type OnDownloadFuncParams struct {
 type OnDownloadFunc func(params OnDownloadFuncParams)
 
 func New(c userfiles.Client) Client {
-	return &client{UserfilesClient: c}
+	return NewWithOpts(c, ClientOpts{})
+}
+
+type ClientOpts struct {
+	// Used to fetch files from URLs. Defaults to http.DefaultClient.
+	HttpClient *http.Client
+}
+
+func NewWithOpts(c userfiles.Client, opts ClientOpts) Client {
+	return &client{UserfilesClient: c, HttpClient: opts.HttpClient}
 }
 
 type client struct {
 	UserfilesClient userfiles.Client
+
+	// Used to fetch files from URLs. Defaults to http.DefaultClient if nil.
+	HttpClient *http.Client
 }
 
 func (i *client) Shell(ctx context.Context, a *actions.Shell) ([]byte, error) {
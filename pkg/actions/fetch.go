@@ -0,0 +1,245 @@
+package actions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultFetchMaxRedirects is the number of redirects followed when FetchFile.MaxRedirects is not set.
+	DefaultFetchMaxRedirects = 10
+
+	// The mode of every fetched file.
+	fetchFileMode = 0644
+)
+
+// FetchFile downloads a file from a URL and places it at a path once it has been fully written and verified.
+type FetchFile struct {
+	// The http(s) URL of the file.
+	Url string
+
+	// The path the file is written to. If the path is an existing directory, the file is written into it using the last
+	// element of the URL's path as the filename.
+	To string
+
+	// The expected hex-encoded SHA-256 of the file. If set and the fetched file does not match, the file is discarded and
+	// a ChecksumError is returned.
+	Sha256 string
+
+	// Headers sent with the request e.g. an Authorization header.
+	Headers map[string]string
+
+	// The max number of redirects to follow. If zero, DefaultFetchMaxRedirects is used. If negative, no redirects are
+	// followed.
+	MaxRedirects int
+
+	// The max number of bytes the file can be. If zero, there is no limit.
+	MaxBytes int64
+}
+
+type FetchOpts struct {
+	OnFetch OnFetchFunc
+	OnError OnError
+}
+
+type OnFetchFuncParams struct {
+	// The absolute filepath to the file that was fetched.
+	ToFilepath   string
+	BytesWritten int64
+
+	// The URL the file was fetched from.
+	Url string
+
+	// The hex-encoded SHA-256 of the fetched file.
+	Sha256 string
+}
+
+type OnFetchFunc func(params OnFetchFuncParams)
+
+// ChecksumError is returned when a fetched file does not match its expected checksum.
+type ChecksumError struct {
+	Url      string
+	Expected string
+	Actual   string
+}
+
+func (c *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: expected sha256 %s but got %s", c.Url, c.Expected, c.Actual)
+}
+
+// SizeLimitError is returned when a fetched file is larger than FetchFile.MaxBytes.
+type SizeLimitError struct {
+	Url      string
+	MaxBytes int64
+}
+
+func (s *SizeLimitError) Error() string {
+	return fmt.Sprintf("%s exceeds the max size of %d bytes", s.Url, s.MaxBytes)
+}
+
+func Fetch(ctx context.Context, f *FetchFile, opts FetchOpts) error {
+	return Default.Fetch(ctx, f, opts)
+}
+
+// RenderFetchFile renders the URL, destination and headers of the FetchFile using the variable.Store. The original is
+// not modified.
+func RenderFetchFile(f *FetchFile, s variable.Store, entries ...*variable.Entry) *FetchFile {
+	out := *f
+	out.Url = variable.RenderString(f.Url, s, entries...)
+	out.To = variable.RenderString(f.To, s, entries...)
+	if f.Headers != nil {
+		out.Headers = make(map[string]string, len(f.Headers))
+		for k, v := range f.Headers {
+			out.Headers[k] = variable.RenderString(v, s, entries...)
+		}
+	}
+	return &out
+}
+
+func (i *client) Fetch(ctx context.Context, f *FetchFile, opts FetchOpts) error {
+	err := i.fetch(ctx, f, opts)
+	if err != nil && opts.OnError != nil {
+		opts.OnError(err)
+	}
+	return err
+}
+
+func (i *client) fetch(ctx context.Context, f *FetchFile, opts FetchOpts) error {
+	u, err := url.Parse(f.Url)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme for %s: only http and https are supported", f.Url)
+	}
+
+	to := f.To
+	if info, err := os.Stat(to); err == nil && info.IsDir() {
+		if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+			return except.NewInvalid("cannot fetch %s into the directory %s as the url has no filename", f.Url, to)
+		}
+		to = filepath.Join(to, path.Base(u.Path))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range f.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := i.fetchHttpClient(f.MaxRedirects).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to fetch %s: %s", f.Url, resp.Status)
+	}
+
+	if f.MaxBytes > 0 && resp.ContentLength > f.MaxBytes {
+		return &SizeLimitError{Url: f.Url, MaxBytes: f.MaxBytes}
+	}
+
+	err = os.MkdirAll(filepath.Dir(to), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// The file is written next to the destination so the final rename is atomic.
+	tmp, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	var body io.Reader = resp.Body
+	if f.MaxBytes > 0 {
+		body = io.LimitReader(resp.Body, f.MaxBytes+1)
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if err != nil {
+		return err
+	}
+
+	if f.MaxBytes > 0 && written > f.MaxBytes {
+		return &SizeLimitError{Url: f.Url, MaxBytes: f.MaxBytes}
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if f.Sha256 != "" && !strings.EqualFold(sum, f.Sha256) {
+		return &ChecksumError{Url: f.Url, Expected: f.Sha256, Actual: sum}
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	// Temp files are only readable by their owner.
+	err = os.Chmod(tmp.Name(), fetchFileMode)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), to)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("url", f.Url).WithField("to", to).WithField("bytes", written).Debug("Fetched file.")
+	if opts.OnFetch != nil {
+		opts.OnFetch(OnFetchFuncParams{
+			ToFilepath:   to,
+			BytesWritten: written,
+			Url:          f.Url,
+			Sha256:       sum,
+		})
+	}
+
+	return nil
+}
+
+func (i *client) fetchHttpClient(maxRedirects int) *http.Client {
+	hc := http.DefaultClient
+	if i.HttpClient != nil {
+		hc = i.HttpClient
+	}
+
+	if maxRedirects == 0 {
+		maxRedirects = DefaultFetchMaxRedirects
+	}
+
+	out := *hc
+	out.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", len(via)-1)
+		}
+		return nil
+	}
+
+	return &out
+}
@@ -0,0 +1,232 @@
+package actions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/bxcodec/faker/v3"
+	"github.com/hostfactor/api/go/exception"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type FetchTestSuite struct {
+	suite.Suite
+
+	Svc *client
+	Dir string
+}
+
+func (f *FetchTestSuite) BeforeTest(_, _ string) {
+	f.Svc = &client{}
+	f.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(f.Dir, os.ModePerm)
+}
+
+func (f *FetchTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(f.Dir)
+}
+
+func (f *FetchTestSuite) TestFetch() {
+	// -- Given
+	//
+	content := []byte("server jar")
+	sum := sha256.Sum256(content)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/server.jar", http.StatusFound)
+	})
+	mux.HandleFunc("/server.jar", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(content)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	type test struct {
+		Given         *FetchFile
+		ExpectedFile  string
+		ExpectedError error
+	}
+
+	tests := []test{
+		{
+			Given: &FetchFile{
+				Url:     s.URL + "/server.jar",
+				To:      f.Dir,
+				Sha256:  hex.EncodeToString(sum[:]),
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			ExpectedFile: filepath.Join(f.Dir, "server.jar"),
+		},
+		{
+			Given: &FetchFile{
+				Url:     s.URL + "/redirect",
+				To:      filepath.Join(f.Dir, "nested", "renamed.jar"),
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			ExpectedFile: filepath.Join(f.Dir, "nested", "renamed.jar"),
+		},
+		{
+			Given: &FetchFile{
+				Url:     s.URL + "/server.jar",
+				To:      filepath.Join(f.Dir, "bad.jar"),
+				Sha256:  "abc",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			ExpectedError: &ChecksumError{Url: s.URL + "/server.jar", Expected: "abc", Actual: hex.EncodeToString(sum[:])},
+		},
+		{
+			Given: &FetchFile{
+				Url:      s.URL + "/server.jar",
+				To:       filepath.Join(f.Dir, "big.jar"),
+				MaxBytes: 2,
+				Headers:  map[string]string{"Authorization": "Bearer token"},
+			},
+			ExpectedError: &SizeLimitError{Url: s.URL + "/server.jar", MaxBytes: 2},
+		},
+	}
+
+	// -- When
+	//
+	for _, v := range tests {
+		var params OnFetchFuncParams
+		err := f.Svc.Fetch(context.Background(), v.Given, FetchOpts{
+			OnFetch: func(p OnFetchFuncParams) {
+				params = p
+			},
+		})
+
+		// -- Then
+		//
+		if v.ExpectedError != nil {
+			f.Equal(v.ExpectedError, err)
+			f.NoFileExists(v.Given.To)
+			continue
+		}
+
+		if f.NoError(err) {
+			actual, _ := os.ReadFile(v.ExpectedFile)
+			f.Equal(content, actual)
+			f.Equal(v.ExpectedFile, params.ToFilepath)
+			f.Equal(int64(len(content)), params.BytesWritten)
+		}
+	}
+}
+
+func (f *FetchTestSuite) TestFetchMaxRedirects() {
+	// -- Given
+	//
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/loop", http.StatusFound)
+	}))
+	defer s.Close()
+	given := &FetchFile{
+		Url:          s.URL + "/loop",
+		To:           filepath.Join(f.Dir, "loop"),
+		MaxRedirects: 2,
+	}
+
+	var onErr error
+
+	// -- When
+	//
+	err := f.Svc.Fetch(context.Background(), given, FetchOpts{
+		OnError: func(err error) {
+			onErr = err
+		},
+	})
+
+	// -- Then
+	//
+	if f.Error(err) {
+		f.Contains(err.Error(), "stopped after 2 redirects")
+		f.True(errors.Is(onErr, err))
+		f.NoFileExists(given.To)
+	}
+}
+
+func (f *FetchTestSuite) TestFetchNoFilename() {
+	// -- Given
+	//
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("index"))
+	}))
+	defer s.Close()
+
+	for _, v := range []string{s.URL, s.URL + "/files/"} {
+		// -- When
+		//
+		err := f.Svc.Fetch(context.Background(), &FetchFile{Url: v, To: f.Dir}, FetchOpts{})
+
+		// -- Then
+		//
+		f.True(except.Is(err, exception.Reason_REASON_INVALID), v)
+		entries, _ := os.ReadDir(f.Dir)
+		f.Empty(entries)
+	}
+}
+
+func (f *FetchTestSuite) TestFetchHttpClient() {
+	// -- Given
+	//
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("secure"))
+	}))
+	defer s.Close()
+	given := &FetchFile{Url: s.URL + "/server.jar", To: f.Dir}
+
+	// -- When
+	//
+	insecureErr := f.Svc.Fetch(context.Background(), given, FetchOpts{})
+	err := NewWithOpts(nil, ClientOpts{HttpClient: s.Client()}).Fetch(context.Background(), given, FetchOpts{})
+
+	// -- Then
+	//
+	f.Error(insecureErr)
+	if f.NoError(err) {
+		info, err := os.Stat(filepath.Join(f.Dir, "server.jar"))
+		if f.NoError(err) {
+			f.Equal(os.FileMode(fetchFileMode), info.Mode().Perm())
+		}
+	}
+}
+
+func (f *FetchTestSuite) TestRenderFetchFile() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	store.AddEntries(variable.NewEntry("version", "1.20"), variable.NewEntry("token", "secret"))
+	given := &FetchFile{
+		Url:     "https://example.com/{{version}}/server.jar",
+		To:      "/opt/{{version}}.jar",
+		Headers: map[string]string{"Authorization": "Bearer {{token}}"},
+	}
+
+	// -- When
+	//
+	actual := RenderFetchFile(given, store)
+
+	// -- Then
+	//
+	f.Equal(&FetchFile{
+		Url:     "https://example.com/1.20/server.jar",
+		To:      "/opt/1.20.jar",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}, actual)
+	f.Equal("Bearer {{token}}", given.Headers["Authorization"])
+}
+
+func TestFetchTestSuite(t *testing.T) {
+	suite.Run(t, new(FetchTestSuite))
+}
@@ -3,27 +3,151 @@ package actions
 import (
 	"context"
 	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint"
 	"github.com/hostfactor/api/go/blueprint/actions"
 	"github.com/hostfactor/diazo/pkg/envvar"
+	"github.com/hostfactor/diazo/pkg/except"
 	"github.com/hostfactor/diazo/pkg/variable"
+	"strconv"
+	"strings"
 )
 
+// SetVariable renders the name and value of the action and sets the variable within the store. Saved variables are
+// added as blueprint variables so a variable.PersistentStore persists them too.
 func SetVariable(client app.AppServiceClient, store variable.Store, act *actions.SetVariable, entries ...*variable.Entry) error {
 	name := variable.RenderString(act.GetName(), store, entries...)
 	value := variable.RenderString(act.GetValue(), store, entries...)
 
 	if act.GetSave() {
+		displayName := variable.RenderString(act.GetDisplayName(), store, entries...)
 		_, err := client.SetVariable(context.Background(), &app.SetVariable_Request{
 			Name:        name,
 			Value:       value,
-			DisplayName: variable.RenderString(act.GetDisplayName(), store, entries...),
+			DisplayName: displayName,
 			Id:          envvar.ServerId,
 		})
 		if err != nil {
 			return err
 		}
+		store.AddVariable(&blueprint.Variable{Name: name, Value: value, DisplayName: displayName})
+		return nil
 	}
 
 	store.AddEntries(variable.NewEntry(name, value))
 	return nil
 }
+
+// VariableOp is how an UpdateVariable changes the value of a variable.
+type VariableOp int
+
+const (
+	// VariableIncrement adds the value, which defaults to 1, to a counter.
+	VariableIncrement VariableOp = iota
+
+	// VariableDecrement subtracts the value, which defaults to 1, from a counter.
+	VariableDecrement
+
+	// VariableAddToSet adds the value to a sorted set of unique values.
+	VariableAddToSet
+
+	// VariableRemoveFromSet removes the value from a set or list.
+	VariableRemoveFromSet
+
+	// VariableAppendToList appends the value to a list.
+	VariableAppendToList
+)
+
+func (v VariableOp) String() string {
+	switch v {
+	case VariableDecrement:
+		return "decrement"
+	case VariableAddToSet:
+		return "add_to_set"
+	case VariableRemoveFromSet:
+		return "remove_from_set"
+	case VariableAppendToList:
+		return "append_to_list"
+	default:
+		return "increment"
+	}
+}
+
+// UpdateVariable changes the value of a variable based on its current value e.g. counting the players online or
+// tracking the names of connected players. Unlike SetVariable, concurrent updates of the same variable are never lost.
+type UpdateVariable struct {
+	Name string
+	Op   VariableOp
+
+	// The amount for counters or the element for sets and lists.
+	Value string
+
+	// The max number of elements kept by VariableAppendToList. The oldest are dropped first. If zero, there is no limit.
+	MaxLen int
+
+	// The lowest value of a counter e.g. zero for the players online. If nil, the counter can go negative.
+	Floor *int64
+
+	// Saves the updated value through the AppServiceClient.
+	Save        bool
+	DisplayName string
+}
+
+// ExecuteUpdateVariable renders the name, value and display name of the action and updates the variable within the
+// store.
+func ExecuteUpdateVariable(client app.AppServiceClient, store variable.Store, act *UpdateVariable, entries ...*variable.Entry) error {
+	name := variable.RenderString(act.Name, store, entries...)
+	if name == "" {
+		return except.NewInvalid("a variable name is required")
+	}
+	value := variable.RenderString(act.Value, store, entries...)
+	updater, ok := store.(variable.Updater)
+	if !ok {
+		return except.NewInvalid("cannot %s %s as the store does not support updates", act.Op.String(), name)
+	}
+	if value == "" && act.Op != VariableIncrement && act.Op != VariableDecrement {
+		return except.NewInvalid("a value is required to %s %s", act.Op.String(), name)
+	}
+
+	var out *variable.Entry
+	switch act.Op {
+	case VariableIncrement, VariableDecrement:
+		delta := int64(1)
+		if value != "" {
+			var err error
+			delta, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return except.NewInvalid("cannot %s %s by %s", act.Op.String(), name, value)
+			}
+		}
+		if act.Op == VariableDecrement {
+			delta = -delta
+		}
+		if act.Floor != nil {
+			out = variable.IncrementFloor(updater, name, delta, *act.Floor)
+		} else {
+			out = variable.Increment(updater, name, delta)
+		}
+	case VariableAddToSet:
+		out = variable.AddToSet(updater, name, value)
+	case VariableRemoveFromSet:
+		out = variable.RemoveFromSet(updater, name, value)
+	case VariableAppendToList:
+		out = variable.AppendToList(updater, name, act.MaxLen, value)
+	default:
+		return except.NewInvalid("unknown variable op %d", act.Op)
+	}
+
+	if act.Save {
+		_, err := client.SetVariable(context.Background(), &app.SetVariable_Request{
+			Name:        name,
+			Value:       variable.FormatValue(out.Val),
+			DisplayName: variable.RenderString(act.DisplayName, store, entries...),
+			Id:          envvar.ServerId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package gamequery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/hostfactor/diazo/pkg/except"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// The header of every single packet A2S request and response.
+var a2sHeader = []byte{0xff, 0xff, 0xff, 0xff}
+
+const (
+	a2sInfoRequest     = 'T'
+	a2sInfoResponse    = 'I'
+	a2sPlayerRequest   = 'U'
+	a2sPlayerResponse  = 'D'
+	a2sChallenge       = 'A'
+	a2sSplitHeader     = 0xfffffffe
+	a2sCompressed      = 0x80000000
+	a2sMaxPacket       = 1400
+	a2sShipAppID       = 2400
+	a2sPayload         = "Source Engine Query\x00"
+	a2sMaxChallenges   = 3
+	a2sNoChallengeYet  = -1
+	a2sChallengeLength = 4
+)
+
+// A2SPlayer is a player reported by A2S_PLAYER.
+type A2SPlayer struct {
+	Name     string
+	Score    int32
+	Duration time.Duration
+}
+
+// QueryA2S queries the Valve A2S_INFO of the address e.g. "localhost:27015". Split packet responses must use the Source
+// format and must not be compressed. If the context has no deadline, the DefaultTimeout is used.
+func QueryA2S(ctx context.Context, addr string) (*Info, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	conn, err := dialUdp(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	resp, err := a2sRequest(conn, append([]byte{a2sInfoRequest}, a2sPayload...), a2sNoChallengeYet, a2sInfoResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parseA2SInfo(resp)
+	if err != nil {
+		return nil, err
+	}
+	info.Latency = time.Since(start)
+
+	return info, nil
+}
+
+// QueryA2SPlayers queries the Valve A2S_PLAYER of the address e.g. "localhost:27015". If the context has no deadline,
+// the DefaultTimeout is used.
+func QueryA2SPlayers(ctx context.Context, addr string) ([]A2SPlayer, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	conn, err := dialUdp(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := a2sRequest(conn, []byte{a2sPlayerRequest}, math.MaxUint32, a2sPlayerResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseA2SPlayers(resp)
+}
+
+func dialUdp(ctx context.Context, addr string) (net.Conn, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	return conn, nil
+}
+
+// a2sRequest sends the request and answers any challenges until the expected response is received. The challenge is
+// appended to the request if it's not a2sNoChallengeYet. The returned payload starts after the response type.
+func a2sRequest(conn net.Conn, req []byte, challenge int64, expected byte) ([]byte, error) {
+	buf := make([]byte, a2sMaxPacket)
+	for i := 0; i < a2sMaxChallenges; i++ {
+		packet := append(append([]byte{}, a2sHeader...), req...)
+		if challenge != a2sNoChallengeYet {
+			packet = binary.LittleEndian.AppendUint32(packet, uint32(challenge))
+		}
+
+		_, err := conn.Write(packet)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := a2sRead(conn, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(resp) < len(a2sHeader)+1 || !bytes.Equal(resp[:len(a2sHeader)], a2sHeader) {
+			return nil, except.NewInvalid("invalid a2s response header")
+		}
+
+		switch resp[len(a2sHeader)] {
+		case expected:
+			return append([]byte{}, resp[len(a2sHeader)+1:]...), nil
+		case a2sChallenge:
+			payload := resp[len(a2sHeader)+1:]
+			if len(payload) < a2sChallengeLength {
+				return nil, except.NewInvalid("invalid a2s challenge")
+			}
+			challenge = int64(binary.LittleEndian.Uint32(payload))
+		default:
+			return nil, except.NewInvalid("unexpected a2s response type %x", resp[len(a2sHeader)])
+		}
+	}
+
+	return nil, except.NewInvalid("a2s server kept challenging the request")
+}
+
+// a2sRead reads the next response. A split response is read until every packet is received and then reassembled.
+// Packets of other responses are skipped.
+func a2sRead(conn net.Conn, buf []byte) ([]byte, error) {
+	var id uint32
+	var packets [][]byte
+	received := 0
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &packetReader{r: bytes.NewReader(buf[:n])}
+		if r.Uint32() != a2sSplitHeader {
+			if packets != nil {
+				continue
+			}
+			return append([]byte{}, buf[:n]...), nil
+		}
+
+		packetID := r.Uint32()
+		total := int(r.Byte())
+		number := int(r.Byte())
+		r.Skip(2) // size
+		if r.err != nil {
+			return nil, except.NewInvalid("invalid split a2s packet header")
+		}
+
+		if packetID&a2sCompressed != 0 {
+			return nil, except.NewInvalid("compressed split a2s responses are not supported")
+		}
+
+		if packets == nil {
+			if total == 0 {
+				return nil, except.NewInvalid("split a2s response has no packets")
+			}
+			id = packetID
+			packets = make([][]byte, total)
+		}
+
+		if packetID != id {
+			continue
+		}
+
+		if total != len(packets) || number >= total {
+			return nil, except.NewInvalid("invalid split a2s packet %d of %d", number, total)
+		}
+
+		if packets[number] == nil {
+			packets[number] = append([]byte{}, buf[n-r.r.Len():n]...)
+			received++
+		}
+
+		if received == len(packets) {
+			return bytes.Join(packets, nil), nil
+		}
+	}
+}
+
+func parseA2SInfo(b []byte) (*Info, error) {
+	r := &packetReader{r: bytes.NewReader(b)}
+	_ = r.Byte() // protocol
+	info := &Info{
+		Name: r.CString(),
+		Map:  r.CString(),
+	}
+	_ = r.CString() // folder
+	_ = r.CString() // game
+	appID := r.Uint16()
+	info.Players = int(r.Byte())
+	info.MaxPlayers = int(r.Byte())
+	info.Bots = int(r.Byte())
+	r.Skip(4) // server type, environment, visibility and VAC
+	if appID == a2sShipAppID {
+		r.Skip(3) // mode, witnesses and duration
+	}
+	info.Version = r.CString()
+
+	if r.err != nil {
+		return nil, except.NewInvalid("invalid a2s info response: %s", r.err.Error())
+	}
+
+	return info, nil
+}
+
+func parseA2SPlayers(b []byte) ([]A2SPlayer, error) {
+	r := &packetReader{r: bytes.NewReader(b)}
+	count := int(r.Byte())
+	out := make([]A2SPlayer, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		_ = r.Byte() // index
+		p := A2SPlayer{
+			Name:  r.CString(),
+			Score: int32(r.Uint32()),
+		}
+		p.Duration = time.Duration(float64(math.Float32frombits(r.Uint32())) * float64(time.Second))
+		out = append(out, p)
+	}
+
+	if r.err != nil {
+		return nil, except.NewInvalid("invalid a2s player response: %s", r.err.Error())
+	}
+
+	return out, nil
+}
+
+// packetReader reads little-endian fields. Once a read fails, every read returns the zero value and err is set.
+type packetReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (p *packetReader) Byte() byte {
+	if p.err != nil {
+		return 0
+	}
+	b, err := p.r.ReadByte()
+	if err != nil {
+		p.err = io.ErrUnexpectedEOF
+	}
+	return b
+}
+
+func (p *packetReader) Uint16() uint16 {
+	b := p.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (p *packetReader) Uint32() uint32 {
+	b := p.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (p *packetReader) Skip(n int) {
+	_ = p.bytes(n)
+}
+
+// CString reads a null terminated string.
+func (p *packetReader) CString() string {
+	var out []byte
+	for {
+		b := p.Byte()
+		if p.err != nil || b == 0 {
+			return string(out)
+		}
+		out = append(out, b)
+	}
+}
+
+func (p *packetReader) bytes(n int) []byte {
+	if p.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(p.r, b)
+	if err != nil {
+		p.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,282 @@
+package gamequery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+type A2STestSuite struct {
+	suite.Suite
+
+	Conn net.PacketConn
+
+	// Responses to A2S requests keyed by the request type. When Challenge is set, requests without it are challenged.
+	Responses map[byte][]byte
+	Challenge []byte
+
+	// When set, responses are split into packets with at most Split bytes of the response in the Source format.
+	Split int
+}
+
+func (a *A2STestSuite) BeforeTest(_, _ string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	a.Require().NoError(err)
+	a.Conn = conn
+	a.Responses = map[byte][]byte{}
+	a.Challenge = nil
+	a.Split = 0
+}
+
+func (a *A2STestSuite) AfterTest(_, _ string) {
+	_ = a.Conn.Close()
+}
+
+// addr starts the fake server once the test has configured it.
+func (a *A2STestSuite) addr() string {
+	go serveA2S(a.Conn, a.Responses, a.Challenge, a.Split)
+	return a.Conn.LocalAddr().String()
+}
+
+func (a *A2STestSuite) TestQueryA2S() {
+	// -- Given
+	//
+	a.Responses[a2sInfoRequest] = a.info(440)
+	expected := &Info{
+		Name:       "My Server",
+		Map:        "cp_badlands",
+		Version:    "1.0.0.1",
+		Players:    5,
+		MaxPlayers: 24,
+		Bots:       1,
+	}
+
+	// -- When
+	//
+	actual, err := QueryA2S(context.Background(), a.addr())
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.NotZero(actual.Latency)
+		actual.Latency = 0
+		a.Equal(expected, actual)
+	}
+}
+
+func (a *A2STestSuite) TestQueryA2SChallenge() {
+	// -- Given
+	//
+	a.Responses[a2sInfoRequest] = a.info(a2sShipAppID)
+	a.Challenge = []byte{1, 2, 3, 4}
+
+	// -- When
+	//
+	actual, err := QueryA2S(context.Background(), a.addr())
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal("1.0.0.1", actual.Version)
+		a.Equal(5, actual.Players)
+	}
+}
+
+func (a *A2STestSuite) TestQueryA2SPlayers() {
+	// -- Given
+	//
+	a.Challenge = []byte{9, 9, 9, 9}
+	resp := []byte{2}
+	for _, v := range []string{"steve", "alex"} {
+		resp = append(resp, 0)
+		resp = append(append(resp, v...), 0)
+		resp = binary.LittleEndian.AppendUint32(resp, 10)
+		resp = binary.LittleEndian.AppendUint32(resp, math.Float32bits(90))
+	}
+	a.Responses[a2sPlayerRequest] = resp
+
+	// -- When
+	//
+	actual, err := QueryA2SPlayers(context.Background(), a.addr())
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal([]A2SPlayer{
+			{Name: "steve", Score: 10, Duration: 90 * time.Second},
+			{Name: "alex", Score: 10, Duration: 90 * time.Second},
+		}, actual)
+	}
+}
+
+func (a *A2STestSuite) TestQueryA2SSplit() {
+	// -- Given
+	//
+	a.Challenge = []byte{1, 2, 3, 4}
+	a.Responses[a2sInfoRequest] = a.info(440)
+	a.Split = 8
+
+	// -- When
+	//
+	actual, err := QueryA2S(context.Background(), a.addr())
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		a.Equal("My Server", actual.Name)
+		a.Equal("1.0.0.1", actual.Version)
+		a.Equal(24, actual.MaxPlayers)
+	}
+}
+
+func (a *A2STestSuite) TestQueryA2SSplitCompressed() {
+	// -- Given
+	//
+	a.Responses[a2sInfoRequest] = a.info(440)
+	a.Split = -8
+
+	// -- When
+	//
+	_, err := QueryA2S(context.Background(), a.addr())
+
+	// -- Then
+	//
+	a.ErrorIs(err, except.ErrInvalid)
+}
+
+func (a *A2STestSuite) TestQueryA2STruncated() {
+	// -- Given
+	//
+	a.Responses[a2sInfoRequest] = a.info(440)[:10]
+
+	// -- When
+	//
+	_, err := QueryA2S(context.Background(), a.addr())
+
+	// -- Then
+	//
+	a.ErrorIs(err, except.ErrInvalid)
+}
+
+func (a *A2STestSuite) TestQueryA2STimeout() {
+	// -- Given
+	//
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// -- When
+	//
+	_, err := QueryA2S(ctx, a.addr())
+
+	// -- Then
+	//
+	a.Error(err)
+}
+
+func (a *A2STestSuite) TestInfoEntries() {
+	// -- Given
+	//
+	given := &Info{Name: "My Server", Players: 5, MaxPlayers: 24}
+	store := variable.NewStore()
+
+	// -- When
+	//
+	store.AddEntries(given.Entries()...)
+
+	// -- Then
+	//
+	a.Equal("My Server 5/24", variable.RenderString("{{server_name}} {{players}}/{{max_players}}", store))
+}
+
+func (a *A2STestSuite) info(appID uint16) []byte {
+	b := []byte{17}
+	for _, v := range []string{"My Server", "cp_badlands", "tf", "Team Fortress"} {
+		b = append(append(b, v...), 0)
+	}
+	b = binary.LittleEndian.AppendUint16(b, appID)
+	b = append(b, 5, 24, 1, 'd', 'l', 0, 1)
+	if appID == a2sShipAppID {
+		b = append(b, 0, 0, 0)
+	}
+	return append(append(b, "1.0.0.1"...), 0)
+}
+
+var a2sResponseTypes = map[byte]byte{
+	a2sInfoRequest:   a2sInfoResponse,
+	a2sPlayerRequest: a2sPlayerResponse,
+}
+
+// serveA2S answers requests with the responses. If split isn't zero, responses are split into packets of at most split
+// bytes which are sent out of order after a packet of another response. The packets are marked compressed if split is
+// negative.
+func serveA2S(conn net.PacketConn, responses map[byte][]byte, challenge []byte, split int) {
+	buf := make([]byte, a2sMaxPacket)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		req := buf[:n]
+		if n <= len(a2sHeader) {
+			continue
+		}
+
+		resp, ok := responses[req[len(a2sHeader)]]
+		if !ok {
+			continue
+		}
+
+		if challenge != nil && !bytes.HasSuffix(req, challenge) {
+			resp = append([]byte{a2sChallenge}, challenge...)
+		} else {
+			resp = append([]byte{a2sResponseTypes[req[len(a2sHeader)]]}, resp...)
+		}
+
+		resp = append(append([]byte{}, a2sHeader...), resp...)
+		if split == 0 {
+			_, _ = conn.WriteTo(resp, addr)
+			continue
+		}
+
+		for _, v := range splitA2S(resp, split) {
+			_, _ = conn.WriteTo(v, addr)
+		}
+	}
+}
+
+func splitA2S(resp []byte, size int) [][]byte {
+	id := uint32(7)
+	if size < 0 {
+		id |= a2sCompressed
+		size = -size
+	}
+
+	total := (len(resp) + size - 1) / size
+	packet := func(id uint32, number int, payload []byte) []byte {
+		b := binary.LittleEndian.AppendUint32(nil, a2sSplitHeader)
+		b = binary.LittleEndian.AppendUint32(b, id)
+		b = append(b, byte(total), byte(number))
+		b = binary.LittleEndian.AppendUint16(b, uint16(a2sMaxPacket))
+		return append(b, payload...)
+	}
+
+	out := make([][]byte, 0, total+1)
+	for i := total - 1; i >= 0; i-- {
+		out = append(out, packet(id, i, resp[i*size:min(len(resp), (i+1)*size)]))
+	}
+
+	// A stale packet of another response is sent after the first so it's skipped.
+	return append(out[:1], append([][]byte{packet(id+1, 0, []byte("stale"))}, out[1:]...)...)
+}
+
+func TestA2STestSuite(t *testing.T) {
+	suite.Run(t, new(A2STestSuite))
+}
@@ -0,0 +1,49 @@
+package gamequery
+
+import (
+	"context"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"time"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+)
+
+// Info is what a game server reports about itself.
+type Info struct {
+	Name       string
+	Map        string
+	Version    string
+	Players    int
+	MaxPlayers int
+	Bots       int
+
+	// The names of the players that are online. Not every server reports every player e.g. Minecraft only reports a
+	// sample.
+	PlayerNames []string
+
+	// The round trip time of the query.
+	Latency time.Duration
+}
+
+// Entries are the fields of the Info as variable entries e.g. for variable.Store.AddEntries.
+func (i *Info) Entries() []*variable.Entry {
+	return []*variable.Entry{
+		{Key: "server_name", Val: i.Name},
+		{Key: "map", Val: i.Map},
+		{Key: "version", Val: i.Version},
+		{Key: "players", Val: i.Players},
+		{Key: "max_players", Val: i.MaxPlayers},
+		{Key: "bots", Val: i.Bots},
+		{Key: "player_names", Val: i.PlayerNames},
+	}
+}
+
+// withTimeout applies the DefaultTimeout if the context has no deadline.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultTimeout)
+}
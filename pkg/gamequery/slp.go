@@ -0,0 +1,240 @@
+package gamequery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/netconn"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The protocol version sent in the handshake. -1 is accepted by every server that supports the Server List Ping.
+	slpProtocolVersion = -1
+	slpStatusState     = 1
+	slpStatusPacket    = 0x00
+	slpPingPacket      = 0x01
+	slpMaxPacket       = 2 * 1024 * 1024
+	slpDefaultPort     = 25565
+)
+
+// MinecraftStatus is the status reported by a Minecraft Server List Ping.
+type MinecraftStatus struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+			ID   string `json:"id"`
+		} `json:"sample"`
+	} `json:"players"`
+
+	// The MOTD. Either a plain string or a chat component.
+	Description json.RawMessage `json:"description"`
+}
+
+// Motd is the plain text of the Description.
+func (m *MinecraftStatus) Motd() string {
+	var text string
+	if json.Unmarshal(m.Description, &text) == nil {
+		return text
+	}
+
+	var component chatComponent
+	if json.Unmarshal(m.Description, &component) != nil {
+		return ""
+	}
+	return component.String()
+}
+
+type chatComponent struct {
+	Text  string          `json:"text"`
+	Extra []chatComponent `json:"extra"`
+}
+
+func (c chatComponent) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(c.Text)
+	for _, v := range c.Extra {
+		sb.WriteString(v.String())
+	}
+	return sb.String()
+}
+
+// QueryMinecraft queries the address e.g. "localhost:25565" using the Minecraft Server List Ping. The Info.Name is the
+// MOTD and the Info.Map is always empty. If the address has no port, the default Minecraft port is used. If the context
+// has no deadline, the DefaultTimeout is used.
+func QueryMinecraft(ctx context.Context, addr string) (*Info, error) {
+	status, latency, err := QueryMinecraftStatus(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Name:       status.Motd(),
+		Version:    status.Version.Name,
+		Players:    status.Players.Online,
+		MaxPlayers: status.Players.Max,
+		Latency:    latency,
+	}
+	for _, v := range status.Players.Sample {
+		info.PlayerNames = append(info.PlayerNames, v.Name)
+	}
+
+	return info, nil
+}
+
+// QueryMinecraftStatus is the same as QueryMinecraft but returns the raw status and the latency of the ping.
+func QueryMinecraftStatus(ctx context.Context, addr string) (*MinecraftStatus, time.Duration, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	host, port := netconn.Addr(addr).Split()
+	if port == 0 {
+		port = slpDefaultPort
+		addr = net.JoinHostPort(string(host), strconv.Itoa(slpDefaultPort))
+	}
+
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	handshake := appendVarInt([]byte{slpStatusPacket}, slpProtocolVersion)
+	handshake = appendString(handshake, string(host))
+	handshake = binary.BigEndian.AppendUint16(handshake, port)
+	handshake = appendVarInt(handshake, slpStatusState)
+	err = writePacket(conn, handshake, []byte{slpStatusPacket})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := bufio.NewReader(conn)
+	id, payload, err := readPacket(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if id != slpStatusPacket {
+		return nil, 0, except.NewInvalid("unexpected minecraft packet %x", id)
+	}
+
+	raw, err := readString(bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	status := &MinecraftStatus{}
+	err = json.Unmarshal([]byte(raw), status)
+	if err != nil {
+		return nil, 0, except.NewInvalid("invalid minecraft status: %s", err.Error())
+	}
+
+	// The latency is best effort since some servers close the connection instead of answering the ping.
+	start := time.Now()
+	ping := binary.BigEndian.AppendUint64([]byte{slpPingPacket}, uint64(start.UnixMilli()))
+	var latency time.Duration
+	if writePacket(conn, ping) == nil {
+		if id, _, err := readPacket(r); err == nil && id == slpPingPacket {
+			latency = time.Since(start)
+		}
+	}
+
+	return status, latency, nil
+}
+
+// writePacket writes every packet prefixed by its length.
+func writePacket(w io.Writer, packets ...[]byte) error {
+	var out []byte
+	for _, v := range packets {
+		out = appendVarInt(out, int32(len(v)))
+		out = append(out, v...)
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// readPacket reads a length prefixed packet and returns its ID and the rest of the packet.
+func readPacket(r *bufio.Reader) (int32, []byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length <= 0 || length > slpMaxPacket {
+		return 0, nil, except.NewInvalid("invalid minecraft packet length %d", length)
+	}
+
+	b := make([]byte, length)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	br := bytes.NewReader(b)
+	id, err := readVarInt(br)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return id, b[len(b)-br.Len():], nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", except.NewInvalid("invalid minecraft string length %d", length)
+	}
+
+	b := make([]byte, length)
+	_, _ = r.Read(b)
+	return string(b), nil
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendVarInt(b, int32(len(s))), s...)
+}
+
+func appendVarInt(b []byte, v int32) []byte {
+	u := uint32(v)
+	for {
+		if u&^0x7f == 0 {
+			return append(b, byte(u))
+		}
+		b = append(b, byte(u&0x7f|0x80))
+		u >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var out uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		out |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(out), nil
+		}
+	}
+	return 0, except.NewInvalid("minecraft varint is too long")
+}
@@ -0,0 +1,165 @@
+package gamequery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"testing"
+)
+
+type SlpTestSuite struct {
+	suite.Suite
+
+	Listener net.Listener
+}
+
+func (s *SlpTestSuite) BeforeTest(_, _ string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	s.Listener = l
+}
+
+func (s *SlpTestSuite) AfterTest(_, _ string) {
+	_ = s.Listener.Close()
+}
+
+func (s *SlpTestSuite) TestQueryMinecraft() {
+	// -- Given
+	//
+	handshakes := s.serve(`{
+		"version": {"name": "1.20.1", "protocol": 763},
+		"players": {"max": 20, "online": 2, "sample": [{"name": "steve", "id": "1"}, {"name": "alex", "id": "2"}]},
+		"description": {"text": "A ", "extra": [{"text": "Minecraft"}, {"text": " Server"}]}
+	}`, true)
+	expected := &Info{
+		Name:        "A Minecraft Server",
+		Version:     "1.20.1",
+		Players:     2,
+		MaxPlayers:  20,
+		PlayerNames: []string{"steve", "alex"},
+	}
+
+	// -- When
+	//
+	actual, err := QueryMinecraft(context.Background(), s.Listener.Addr().String())
+
+	// -- Then
+	//
+	if s.NoError(err) {
+		s.NotZero(actual.Latency)
+		actual.Latency = 0
+		s.Equal(expected, actual)
+		handshake := <-handshakes
+		s.Equal("127.0.0.1", handshake.Host)
+		s.Equal(uint16(s.Listener.Addr().(*net.TCPAddr).Port), handshake.Port)
+		s.Equal(int32(slpStatusState), handshake.State)
+	}
+}
+
+func (s *SlpTestSuite) TestQueryMinecraftNoPong() {
+	// -- Given
+	//
+	s.serve(`{"version": {"name": "1.8.9"}, "players": {"max": 10}, "description": "Hello"}`, false)
+
+	// -- When
+	//
+	actual, err := QueryMinecraft(context.Background(), s.Listener.Addr().String())
+
+	// -- Then
+	//
+	if s.NoError(err) {
+		s.Equal("Hello", actual.Name)
+		s.Equal("1.8.9", actual.Version)
+		s.Zero(actual.Latency)
+	}
+}
+
+func (s *SlpTestSuite) TestQueryMinecraftInvalid() {
+	// -- Given
+	//
+	s.serve(`not json`, false)
+
+	// -- When
+	//
+	_, err := QueryMinecraft(context.Background(), s.Listener.Addr().String())
+
+	// -- Then
+	//
+	s.ErrorIs(err, except.ErrInvalid)
+}
+
+func (s *SlpTestSuite) TestVarInt() {
+	// -- Given
+	//
+	given := []int32{0, 1, 127, 128, 255, 25565, 2097151, -1, -2147483648}
+
+	for _, v := range given {
+		// -- When
+		//
+		actual, err := readVarInt(bytes.NewReader(appendVarInt(nil, v)))
+
+		// -- Then
+		//
+		s.NoError(err)
+		s.Equal(v, actual)
+	}
+	s.Equal([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, appendVarInt(nil, -1))
+}
+
+type slpHandshake struct {
+	Host  string
+	Port  uint16
+	State int32
+}
+
+// serve answers a single Server List Ping with the status and, if pong is set, the ping.
+func (s *SlpTestSuite) serve(status string, pong bool) <-chan slpHandshake {
+	handshakes := make(chan slpHandshake, 1)
+	go func() {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		_, payload, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		pr := bytes.NewReader(payload)
+		_, _ = readVarInt(pr)
+		handshake := slpHandshake{}
+		handshake.Host, _ = readString(pr)
+		port := make([]byte, 2)
+		_, _ = pr.Read(port)
+		handshake.Port = binary.BigEndian.Uint16(port)
+		handshake.State, _ = readVarInt(pr)
+		handshakes <- handshake
+
+		id, _, err := readPacket(r)
+		if err != nil || id != slpStatusPacket {
+			return
+		}
+		_ = writePacket(conn, appendString([]byte{slpStatusPacket}, status))
+
+		if !pong {
+			return
+		}
+
+		id, ping, err := readPacket(r)
+		if err != nil || id != slpPingPacket {
+			return
+		}
+		_ = writePacket(conn, append([]byte{slpPingPacket}, ping...))
+	}()
+	return handshakes
+}
+
+func TestSlpTestSuite(t *testing.T) {
+	suite.Run(t, new(SlpTestSuite))
+}
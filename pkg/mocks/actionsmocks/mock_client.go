@@ -111,6 +111,50 @@ func (_c *Client_Extract_Call) RunAndReturn(run func(*actions.ExtractFiles) erro
 	return _c
 }
 
+// Fetch provides a mock function with given fields: ctx, f, opts
+func (_m *Client) Fetch(ctx context.Context, f *pkgactions.FetchFile, opts pkgactions.FetchOpts) error {
+	ret := _m.Called(ctx, f, opts)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *pkgactions.FetchFile, pkgactions.FetchOpts) error); ok {
+		r0 = rf(ctx, f, opts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_Fetch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Fetch'
+type Client_Fetch_Call struct {
+	*mock.Call
+}
+
+// Fetch is a helper method to define mock.On call
+//   - ctx context.Context
+//   - f *pkgactions.FetchFile
+//   - opts pkgactions.FetchOpts
+func (_e *Client_Expecter) Fetch(ctx interface{}, f interface{}, opts interface{}) *Client_Fetch_Call {
+	return &Client_Fetch_Call{Call: _e.mock.On("Fetch", ctx, f, opts)}
+}
+
+func (_c *Client_Fetch_Call) Run(run func(ctx context.Context, f *pkgactions.FetchFile, opts pkgactions.FetchOpts)) *Client_Fetch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*pkgactions.FetchFile), args[2].(pkgactions.FetchOpts))
+	})
+	return _c
+}
+
+func (_c *Client_Fetch_Call) Return(_a0 error) *Client_Fetch_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Client_Fetch_Call) RunAndReturn(run func(context.Context, *pkgactions.FetchFile, pkgactions.FetchOpts) error) *Client_Fetch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // MoveFile provides a mock function with given fields: a
 func (_m *Client) MoveFile(a *actions.MoveFile) error {
 	ret := _m.Called(a)
@@ -0,0 +1,68 @@
+// Code generated by mockery v2.36.0. DO NOT EDIT.
+
+package actionsmocks
+
+import (
+	actions "github.com/hostfactor/diazo/pkg/actions"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// OnFetchFunc is an autogenerated mock type for the OnFetchFunc type
+type OnFetchFunc struct {
+	mock.Mock
+}
+
+type OnFetchFunc_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *OnFetchFunc) EXPECT() *OnFetchFunc_Expecter {
+	return &OnFetchFunc_Expecter{mock: &_m.Mock}
+}
+
+// Execute provides a mock function with given fields: params
+func (_m *OnFetchFunc) Execute(params actions.OnFetchFuncParams) {
+	_m.Called(params)
+}
+
+// OnFetchFunc_Execute_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Execute'
+type OnFetchFunc_Execute_Call struct {
+	*mock.Call
+}
+
+// Execute is a helper method to define mock.On call
+//   - params actions.OnFetchFuncParams
+func (_e *OnFetchFunc_Expecter) Execute(params interface{}) *OnFetchFunc_Execute_Call {
+	return &OnFetchFunc_Execute_Call{Call: _e.mock.On("Execute", params)}
+}
+
+func (_c *OnFetchFunc_Execute_Call) Run(run func(params actions.OnFetchFuncParams)) *OnFetchFunc_Execute_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(actions.OnFetchFuncParams))
+	})
+	return _c
+}
+
+func (_c *OnFetchFunc_Execute_Call) Return() *OnFetchFunc_Execute_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *OnFetchFunc_Execute_Call) RunAndReturn(run func(actions.OnFetchFuncParams)) *OnFetchFunc_Execute_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewOnFetchFunc creates a new instance of OnFetchFunc. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewOnFetchFunc(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *OnFetchFunc {
+	mock := &OnFetchFunc{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,149 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/appcommand"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/appcmd"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// Action is an action that can be executed by any kind of reaction. Only one of the fields should be set.
+type Action struct {
+	// Uploads, downloads, zips, unzips, renames, extracts or moves files.
+	File *reaction.FileReactionAction
+
+	// Any setup action including shell commands.
+	Setup *blueprint.SetupAction
+
+	// Fetches a file over HTTP(S).
+	Fetch *actions2.FetchFile
+
+	// Sends a command to the app. Requires ActionOpts.OnAppCommand.
+	AppCommand *appcommand.AppCommandPayload
+
+	// Increments, decrements or adds to a variable e.g. to count the players online. Saving the variable requires
+	// ActionOpts.AppClient.
+	Variable *actions2.UpdateVariable
+}
+
+// AppCommandFunc sends a compiled app command to the app e.g. by writing it to the app's stdin.
+type AppCommandFunc func(cmd []byte) error
+
+type ActionOpts struct {
+	// The base path of where to execute file actions e.g. for download or upload.
+	Root string
+
+	File  ExecuteFileOpts
+	Fetch actions2.FetchOpts
+
+	// The owner of directories created by setup actions.
+	Uid *int
+	Gid *int
+
+	// The commands supported by the app. AppCommand payloads are compiled against these.
+	AppCommands []*appcommand.AppCommand
+
+	OnAppCommand AppCommandFunc
+
+	// Saves variables updated by the Variable action.
+	AppClient app.AppServiceClient
+}
+
+// ExecuteAction renders the templates within the action using the store and entries and executes it.
+//
+// Entries may hold untrusted data e.g. text from a log line so the values rendered into shell commands are quoted. See
+// variable.RenderShell.
+func ExecuteAction(ctx context.Context, store variable.Store, act *Action, opts ActionOpts, entries ...*variable.Entry) error {
+	if v := act.File; v != nil {
+		return executeFileReactionAction(opts.Root, RenderFileReactionAction(v, store, entries...), opts.File)
+	} else if v := act.Setup; v != nil {
+		return ExecuteSetupAction(ctx, opts.Root, RenderSetupAction(v, store, entries...), ExecuteOpts{
+			File: opts.File,
+			Uid:  opts.Uid,
+			Gid:  opts.Gid,
+		})
+	} else if v := act.Fetch; v != nil {
+		return opts.File.client().Fetch(ctx, actions2.RenderFetchFile(v, store, entries...), opts.Fetch)
+	} else if v := act.AppCommand; v != nil {
+		if opts.OnAppCommand == nil {
+			return except.NewInvalid("cannot send the %s app command as there is nothing to send it to", v.GetName())
+		}
+
+		cmd, err := appcmd.CompileExec(RenderAppCommand(v, store, entries...), opts.AppCommands...)
+		if err != nil {
+			return err
+		}
+
+		logrus.WithField("command", string(cmd)).Debug("Triggering app command.")
+		return opts.OnAppCommand(cmd)
+	} else if v := act.Variable; v != nil {
+		if v.Save && opts.AppClient == nil {
+			return except.NewInvalid("cannot save the %s variable as there is no app client", v.Name)
+		}
+		return actions2.ExecuteUpdateVariable(opts.AppClient, store, v, entries...)
+	}
+
+	return nil
+}
+
+// RenderSetupAction renders the templates within the action using the store and entries. The values rendered into shell
+// commands are quoted. The action is not modified.
+func RenderSetupAction(act *blueprint.SetupAction, s variable.Store, entries ...*variable.Entry) *blueprint.SetupAction {
+	act = proto.Clone(act).(*blueprint.SetupAction)
+
+	if v := act.GetUnzip(); v != nil {
+		v.From = variable.RenderString(v.From, s, entries...)
+		v.To = variable.RenderString(v.To, s, entries...)
+	} else if v := act.GetRename(); v != nil {
+		v.To = variable.RenderString(v.To, s, entries...)
+		if f := v.GetFrom(); f != nil {
+			f.Directory = variable.RenderString(f.Directory, s, entries...)
+		}
+	} else if v := act.GetExtract(); v != nil {
+		v.To = variable.RenderString(v.To, s, entries...)
+		if f := v.GetFrom(); f != nil {
+			f.Directory = variable.RenderString(f.Directory, s, entries...)
+		}
+	} else if v := act.GetDownload(); v != nil {
+		v.To = variable.RenderString(v.To, s, entries...)
+	} else if v := act.GetMove(); v != nil {
+		v.To = variable.RenderString(v.To, s, entries...)
+		if f := v.GetFrom(); f != nil {
+			f.Directory = variable.RenderString(f.Directory, s, entries...)
+		}
+	} else if v := act.GetShell(); v != nil {
+		v.Command = variable.RenderShell(v.Command, s, entries...)
+	}
+
+	return act
+}
+
+// RenderAppCommand renders the templates within the string args of the payload using the store and entries. The
+// payload is not modified.
+func RenderAppCommand(pl *appcommand.AppCommandPayload, s variable.Store, entries ...*variable.Entry) *appcommand.AppCommandPayload {
+	pl = proto.Clone(pl).(*appcommand.AppCommandPayload)
+	renderAppCommandArgs(pl.GetArgs(), s, entries...)
+	return pl
+}
+
+func renderAppCommandArgs(args []*appcommand.AppCommandArg, s variable.Store, entries ...*variable.Entry) {
+	for _, v := range args {
+		val := v.GetValue()
+		if val == nil {
+			continue
+		}
+
+		if val.StrVal != nil {
+			rendered := variable.RenderString(val.GetStrVal(), s, entries...)
+			val.StrVal = &rendered
+		}
+		renderAppCommandArgs(val.GetListVal(), s, entries...)
+	}
+}
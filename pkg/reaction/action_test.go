@@ -0,0 +1,252 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/appcommand"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/api/go/mocks"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/appcmd"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/mocks/actionsmocks"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type ActionTestSuite struct {
+	suite.Suite
+
+	FileActions *actionsmocks.Client
+}
+
+func (a *ActionTestSuite) BeforeTest(_, _ string) {
+	a.FileActions = new(actionsmocks.Client)
+	actions2.Default = a.FileActions
+}
+
+func (a *ActionTestSuite) TestExecuteActionFile() {
+	// -- Given
+	//
+	given := &Action{
+		File: &reaction.FileReactionAction{
+			Upload: &actions.UploadFile{
+				From: &actions.UploadFile_Source{Path: "/saves/{{first_match}}.sav"},
+				To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{first_match}}.sav"}},
+			},
+		},
+	}
+	a.FileActions.On("Upload", "root", &actions.UploadFile{
+		From: &actions.UploadFile_Source{Path: "/saves/world.sav"},
+		To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "world.sav"}},
+	}, actions2.UploadOpts{}).Return(nil)
+
+	// -- When
+	//
+	err := ExecuteAction(context.Background(), variable.NewStore(), given, ActionOpts{Root: "root"}, logTemplateEntries("Saved world", []string{"Saved world", "world"})...)
+
+	// -- Then
+	//
+	a.NoError(err)
+	a.FileActions.AssertExpectations(a.T())
+}
+
+func (a *ActionTestSuite) TestExecuteActionShell() {
+	// -- Given
+	//
+	given := &Action{
+		Setup: &blueprint.SetupAction{
+			Shell: &actions.Shell{Command: "./cleanup.sh {{code}}"},
+		},
+	}
+	store := variable.NewStore()
+	store.AddEntries(variable.NewEntry("code", "137"))
+	a.FileActions.On("Shell", mock.Anything, &actions.Shell{Command: "./cleanup.sh 137"}).Return(nil, nil)
+
+	// -- When
+	//
+	err := ExecuteAction(context.Background(), store, given, ActionOpts{})
+
+	// -- Then
+	//
+	a.NoError(err)
+	a.FileActions.AssertExpectations(a.T())
+	a.Equal("./cleanup.sh {{code}}", given.Setup.Shell.Command)
+}
+
+func (a *ActionTestSuite) TestExecuteActionShellQuoted() {
+	// -- Given
+	//
+	given := &Action{
+		Setup: &blueprint.SetupAction{
+			Shell: &actions.Shell{Command: "./welcome.sh {{first_match}}"},
+		},
+	}
+	a.FileActions.On("Shell", mock.Anything, &actions.Shell{Command: `./welcome.sh 'steve; rm -rf /'`}).Return(nil, nil)
+
+	// -- When
+	//
+	err := ExecuteAction(context.Background(), variable.NewStore(), given, ActionOpts{},
+		logTemplateEntries("steve; rm -rf / joined", []string{"steve; rm -rf / joined", "steve; rm -rf /"})...)
+
+	// -- Then
+	//
+	a.NoError(err)
+	a.FileActions.AssertExpectations(a.T())
+}
+
+func (a *ActionTestSuite) TestExecuteActionAppCommand() {
+	// -- Given
+	//
+	given := &Action{
+		AppCommand: &appcommand.AppCommandPayload{
+			Name: "say",
+			Args: []*appcommand.AppCommandArg{
+				{Name: "message", Value: appcmd.NewVal("welcome {{first_match}}")},
+			},
+		},
+	}
+	var actual []byte
+	opts := ActionOpts{
+		AppCommands: []*appcommand.AppCommand{
+			{Name: "say", Spec: &appcommand.AppCommandSpec{Options: []*appcommand.CommandOption{
+				{Name: "message", Type: appcommand.CommandOption_STRING},
+			}}},
+		},
+		OnAppCommand: func(cmd []byte) error {
+			actual = cmd
+			return nil
+		},
+	}
+
+	// -- When
+	//
+	err := ExecuteAction(context.Background(), variable.NewStore(), given, opts, logTemplateEntries("steve joined", []string{"steve joined", "steve"})...)
+
+	// -- Then
+	//
+	a.NoError(err)
+	a.Equal("say welcome steve", string(actual))
+}
+
+func (a *ActionTestSuite) TestExecuteActionAppCommandNoHandler() {
+	// -- When
+	//
+	err := ExecuteAction(context.Background(), variable.NewStore(), &Action{
+		AppCommand: &appcommand.AppCommandPayload{Name: "save"},
+	}, ActionOpts{})
+
+	// -- Then
+	//
+	a.ErrorIs(err, except.ErrInvalid)
+}
+
+func (a *ActionTestSuite) TestExecuteLogReaderActions() {
+	// -- Given
+	//
+	reader := strings.NewReader("Saving...\nWorld saved: overworld\n")
+	rx := []*CompiledLogReaction{
+		{
+			Condition: a.regex(`World saved: (\w+)`),
+			Actions: []*Action{
+				{
+					File: &reaction.FileReactionAction{
+						Upload: &actions.UploadFile{
+							From: &actions.UploadFile_Source{Path: "/saves/{{first_match}}"},
+							To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{first_match}}.zip"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	a.FileActions.On("Upload", "root", &actions.UploadFile{
+		From: &actions.UploadFile_Source{Path: "/saves/overworld"},
+		To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "overworld.zip"}},
+	}, actions2.UploadOpts{}).Return(nil).Once()
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, variable.NewStore(), nil, nil, ExecuteLogOpts{
+		Reactions: rx,
+		Actions:   ActionOpts{Root: "root"},
+	})
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		<-c.Done()
+		a.FileActions.AssertExpectations(a.T())
+	}
+}
+
+func (a *ActionTestSuite) TestExecuteLogReaderVariableActions() {
+	// -- Given
+	//
+	reader := strings.NewReader("steve joined the game\nalex joined the game\nsteve left the game\n")
+	store := variable.NewStore()
+	appClient := new(mocks.AppServiceClient)
+	appClient.On("SetVariable", mock.Anything, mock.MatchedBy(func(req *app.SetVariable_Request) bool {
+		return req.GetName() == "players_online"
+	})).Return(nil, nil).Times(3)
+	rx := []*CompiledLogReaction{
+		{
+			Condition: a.regex(`(\w+) joined the game`),
+			Actions: []*Action{
+				{Variable: &actions2.UpdateVariable{Name: "players_online", Op: actions2.VariableIncrement, Save: true}},
+				{Variable: &actions2.UpdateVariable{Name: "players", Op: actions2.VariableAddToSet, Value: "{{first_match}}"}},
+			},
+		},
+		{
+			Condition: a.regex(`(\w+) left the game`),
+			Actions: []*Action{
+				{Variable: &actions2.UpdateVariable{Name: "players_online", Op: actions2.VariableDecrement, Save: true}},
+				{Variable: &actions2.UpdateVariable{Name: "players", Op: actions2.VariableRemoveFromSet, Value: "{{first_match}}"}},
+			},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, nil, ExecuteLogOpts{
+		Reactions: rx,
+		Actions:   ActionOpts{AppClient: appClient},
+	})
+
+	// -- Then
+	//
+	if a.NoError(err) {
+		<-c.Done()
+		a.Equal("1", store.GetStringValue("players_online"))
+		a.Equal(`["alex"]`, store.GetStringValue("players"))
+		appClient.AssertExpectations(a.T())
+	}
+}
+
+func (a *ActionTestSuite) TestExecuteActionVariableNoAppClient() {
+	// -- When
+	//
+	err := ExecuteAction(context.Background(), variable.NewStore(), &Action{
+		Variable: &actions2.UpdateVariable{Name: "players_online", Save: true},
+	}, ActionOpts{})
+
+	// -- Then
+	//
+	a.ErrorIs(err, except.ErrInvalid)
+}
+
+func (a *ActionTestSuite) regex(expr string) LogCondition {
+	c, err := Regex(expr)
+	a.Require().NoError(err)
+	return c
+}
+
+func TestActionTestSuite(t *testing.T) {
+	suite.Run(t, new(ActionTestSuite))
+}
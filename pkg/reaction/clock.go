@@ -0,0 +1,160 @@
+package reaction
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time seen by reactions and the scheduler of their deferred work e.g. the trailing fire of a limited
+// reaction. Every delay is measured by the same Clock that told the time so a fake Clock controls both.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls the fn once the duration has passed. The returned timer stops the call.
+	AfterFunc(d time.Duration, fn func()) ClockTimer
+}
+
+// ClockTimer is a call scheduled by a Clock.
+type ClockTimer interface {
+	// Stop prevents the call. Returns false if it was already called or stopped.
+	Stop() bool
+}
+
+// RealClock is the system's clock.
+var RealClock Clock = realClock{}
+
+type realClock struct {
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, fn func()) ClockTimer {
+	return time.AfterFunc(d, fn)
+}
+
+// clockOrReal is the clock or RealClock if it's nil.
+func clockOrReal(c Clock) Clock {
+	if c != nil {
+		return c
+	}
+	return RealClock
+}
+
+// ManualClock is a Clock whose time only moves when it's set e.g. to replay a log. The calls that become due are made
+// in the order they're due on the goroutine that moved the time, with the time set to when each was due, so whatever
+// they schedule is also made in order.
+type ManualClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+	seq    int
+}
+
+type manualTimer struct {
+	Clock *ManualClock
+	At    time.Time
+	Fn    func()
+
+	// Orders calls that are due at the same time by when they were scheduled.
+	seq int
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (m *ManualClock) Now() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.now
+}
+
+func (m *ManualClock) AfterFunc(d time.Duration, fn func()) ClockTimer {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.seq++
+	t := &manualTimer{Clock: m, At: m.now.Add(d), Fn: fn, seq: m.seq}
+	m.timers = append(m.timers, t)
+	return t
+}
+
+// Set moves the time to t and makes every call that's due by then. The time never moves backwards.
+func (m *ManualClock) Set(t time.Time) {
+	for {
+		m.lock.Lock()
+		next := m.next(t)
+		if next == nil {
+			if t.After(m.now) {
+				m.now = t
+			}
+			m.lock.Unlock()
+			return
+		}
+
+		m.remove(next)
+		if next.At.After(m.now) {
+			m.now = next.At
+		}
+		m.lock.Unlock()
+
+		next.Fn()
+	}
+}
+
+// Advance moves the time forward by the duration and makes every call that's due by then.
+func (m *ManualClock) Advance(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
+
+// Next is when the next call is due. False if no calls are scheduled.
+func (m *ManualClock) Next() (time.Time, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var out *manualTimer
+	for _, v := range m.timers {
+		if out == nil || v.before(out) {
+			out = v
+		}
+	}
+
+	if out == nil {
+		return time.Time{}, false
+	}
+	return out.At, true
+}
+
+// next is the first call due by the time. Must be called with the lock held.
+func (m *ManualClock) next(t time.Time) *manualTimer {
+	var out *manualTimer
+	for _, v := range m.timers {
+		if !v.At.After(t) && (out == nil || v.before(out)) {
+			out = v
+		}
+	}
+	return out
+}
+
+// remove unschedules the call. Returns false if it wasn't scheduled. Must be called with the lock held.
+func (m *ManualClock) remove(t *manualTimer) bool {
+	for i, v := range m.timers {
+		if v == t {
+			m.timers = append(m.timers[:i], m.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *manualTimer) Stop() bool {
+	m.Clock.lock.Lock()
+	defer m.Clock.lock.Unlock()
+	return m.Clock.remove(m)
+}
+
+func (m *manualTimer) before(o *manualTimer) bool {
+	return m.At.Before(o.At) || m.At.Equal(o.At) && m.seq < o.seq
+}
@@ -0,0 +1,58 @@
+package reaction
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type ClockTestSuite struct {
+	suite.Suite
+
+	Now time.Time
+}
+
+func (c *ClockTestSuite) BeforeTest(_, _ string) {
+	c.Now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (c *ClockTestSuite) TestManualClock() {
+	// -- Given
+	//
+	given := NewManualClock(c.Now)
+	var actual []string
+	var at []time.Time
+	record := func(name string) func() {
+		return func() {
+			actual = append(actual, name)
+			at = append(at, given.Now())
+		}
+	}
+	given.AfterFunc(2*time.Second, record("b"))
+	given.AfterFunc(time.Second, func() {
+		record("a")()
+		given.AfterFunc(time.Second, record("c"))
+	})
+	stopped := given.AfterFunc(time.Second, record("stopped"))
+	given.AfterFunc(time.Hour, record("later"))
+
+	// -- When
+	//
+	c.True(stopped.Stop())
+	given.Advance(3 * time.Second)
+
+	// -- Then
+	//
+	c.Equal([]string{"a", "b", "c"}, actual)
+	c.Equal([]time.Time{c.Now.Add(time.Second), c.Now.Add(2 * time.Second), c.Now.Add(2 * time.Second)}, at)
+	c.Equal(c.Now.Add(3*time.Second), given.Now())
+	c.False(stopped.Stop())
+
+	next, ok := given.Next()
+	c.True(ok)
+	c.Equal(c.Now.Add(time.Hour), next)
+}
+
+func TestClockTestSuite(t *testing.T) {
+	suite.Run(t, new(ClockTestSuite))
+}
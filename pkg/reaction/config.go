@@ -0,0 +1,248 @@
+package reaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	jsoniter "github.com/json-iterator/go"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// BlueprintReactions are the reactions of a blueprint.
+type BlueprintReactions struct {
+	// Executed in order before any reaction is started.
+	Setup []*blueprint.SetupAction
+	Files []*reaction.FileReaction
+
+	// Reactions to the app's log.
+	Logs []*reaction.LogReaction
+
+	// Sets the app's status to ready once its log matches. See ReadyCheckToLogReaction.
+	ReadyCheck *blueprint.ReadyCheck
+
+	// The app's log. Only one of LogPath or LogReader should be set. Logs and ReadyCheck are ignored if neither is.
+	LogPath   string
+	LogReader io.Reader
+}
+
+// NewEngineConfig creates the EngineConfig of the blueprint's reactions. Reactions that aren't within the blueprint
+// e.g. timers can be added with Extend. The blueprint's slices are never modified.
+func NewEngineConfig(bp BlueprintReactions) *EngineConfig {
+	out := &EngineConfig{
+		Setup: bp.Setup[:len(bp.Setup):len(bp.Setup)],
+		Files: bp.Files[:len(bp.Files):len(bp.Files)],
+	}
+
+	if bp.LogPath == "" && bp.LogReader == nil {
+		return out
+	}
+
+	l := &EngineLog{Path: bp.LogPath, Reader: bp.LogReader, Reactions: bp.Logs[:len(bp.Logs):len(bp.Logs)]}
+	if bp.ReadyCheck.GetRegex() != "" {
+		l.Reactions = append(l.Reactions, ReadyCheckToLogReaction(bp.ReadyCheck))
+	}
+
+	if len(l.Reactions) > 0 {
+		out.Logs = []*EngineLog{l}
+	}
+	return out
+}
+
+// Extend adds every reaction and type of the other config after the ones of the config e.g. the extra
+// reactions read by LoadEngineConfig. The types of the other config take precedence.
+func (e *EngineConfig) Extend(o *EngineConfig) {
+	e.Setup = append(e.Setup, o.Setup...)
+	e.Files = append(e.Files, o.Files...)
+	e.Logs = append(e.Logs, o.Logs...)
+	e.Timers = append(e.Timers, o.Timers...)
+
+	if len(o.Types) > 0 && e.Types == nil {
+		e.Types = make(map[string]variable.Type, len(o.Types))
+	}
+	for k, v := range o.Types {
+		e.Types[k] = v
+	}
+}
+
+// engineConfigFile is the document read by LoadEngineConfig. Actions and reactions are the JSON encoding of their
+// protos e.g.
+//
+//	setup:
+//	  - shell: { command: ./install.sh }
+//	files:
+//	  - when: [{ directories: [/data/saves], op: [create] }]
+//	    then: [{ upload: { from: { path: "{{abs}}" }, to: { bucketFile: { name: "{{filename}}" } } } }]
+//	logs:
+//	  - path: /data/logs/latest.log
+//	    reactions:
+//	      - when: [{ matches: { regex: Done } }]
+//	        then: [{ setStatus: { status: ready } }]
+//	timers:
+//	  - cron: "@daily"
+//	    jitter: 5m
+//	    then: [{ upload: { from: { path: /data/world }, to: { bucketFile: { name: "world.zip" } } } }]
+//	variables:
+//	  players_online: int
+type engineConfigFile struct {
+	Setup     []json.RawMessage        `json:"setup"`
+	Files     []json.RawMessage        `json:"files"`
+	Logs      []engineLogFile          `json:"logs"`
+	Timers    []timerFile              `json:"timers"`
+	Variables map[string]variable.Type `json:"variables"`
+}
+
+type engineLogFile struct {
+	Path      string            `json:"path"`
+	Reactions []json.RawMessage `json:"reactions"`
+}
+
+type timerFile struct {
+	Cron     string            `json:"cron"`
+	Every    string            `json:"every"`
+	Timezone string            `json:"timezone"`
+	Jitter   string            `json:"jitter"`
+	Then     []json.RawMessage `json:"then"`
+}
+
+// LoadEngineConfig reads an EngineConfig from a YAML or JSON file within the filesystem e.g. reactions that aren't
+// within the blueprint. Add it to the blueprint's config with Extend. Logs within the file are always tailed from their
+// path.
+func LoadEngineConfig(f fs.FS, fp string) (*EngineConfig, error) {
+	content, err := fs.ReadFile(f, fp)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(fp)
+	if ext == ".yaml" || ext == ".yml" {
+		m := map[string]interface{}{}
+		err := yaml.Unmarshal(content, &m)
+		if err != nil {
+			return nil, except.NewInvalid("invalid engine config %s: %s", fp, err.Error())
+		}
+
+		content, err = jsoniter.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+	} else if ext != ".json" {
+		return nil, except.NewInvalid("%s is not a supported extension for engine configs", ext)
+	}
+
+	raw := new(engineConfigFile)
+	err = json.Unmarshal(content, raw)
+	if err != nil {
+		return nil, except.NewInvalid("invalid engine config %s: %s", fp, err.Error())
+	}
+
+	return compileEngineConfig(raw)
+}
+
+func compileEngineConfig(raw *engineConfigFile) (*EngineConfig, error) {
+	out := &EngineConfig{
+		Setup:  make([]*blueprint.SetupAction, 0, len(raw.Setup)),
+		Files:  make([]*reaction.FileReaction, 0, len(raw.Files)),
+		Logs:   make([]*EngineLog, 0, len(raw.Logs)),
+		Timers: make([]*TimerReaction, 0, len(raw.Timers)),
+		Types:  raw.Variables,
+	}
+
+	for i, v := range raw.Setup {
+		act := new(blueprint.SetupAction)
+		err := unmarshalMessage(v, act, "setup/%d", i)
+		if err != nil {
+			return nil, err
+		}
+		out.Setup = append(out.Setup, act)
+	}
+
+	for i, v := range raw.Files {
+		rx := new(reaction.FileReaction)
+		err := unmarshalMessage(v, rx, "file/%d", i)
+		if err != nil {
+			return nil, err
+		}
+		out.Files = append(out.Files, rx)
+	}
+
+	for i, v := range raw.Logs {
+		l := &EngineLog{Path: v.Path, Reactions: make([]*reaction.LogReaction, 0, len(v.Reactions))}
+		for j, r := range v.Reactions {
+			rx := new(reaction.LogReaction)
+			err := unmarshalMessage(r, rx, "log/%d/%d", i, j)
+			if err != nil {
+				return nil, err
+			}
+			l.Reactions = append(l.Reactions, rx)
+		}
+		out.Logs = append(out.Logs, l)
+	}
+
+	for i, v := range raw.Timers {
+		t, err := compileTimerFile(v, i)
+		if err != nil {
+			return nil, err
+		}
+		out.Timers = append(out.Timers, t)
+	}
+
+	for k, v := range raw.Variables {
+		if !v.Valid() {
+			return nil, except.NewInvalid("variable %s has an invalid type %s", k, v)
+		}
+	}
+
+	return out, nil
+}
+
+func compileTimerFile(raw timerFile, idx int) (*TimerReaction, error) {
+	out := &TimerReaction{
+		Cron:     raw.Cron,
+		Timezone: raw.Timezone,
+		Then:     make([]*reaction.FileReactionAction, 0, len(raw.Then)),
+	}
+
+	var err error
+	if raw.Every != "" {
+		out.Every, err = time.ParseDuration(raw.Every)
+		if err != nil {
+			return nil, except.NewInvalid("timer/%d has an invalid interval %s", idx, raw.Every)
+		}
+	}
+
+	if raw.Jitter != "" {
+		out.Jitter, err = time.ParseDuration(raw.Jitter)
+		if err != nil {
+			return nil, except.NewInvalid("timer/%d has an invalid jitter %s", idx, raw.Jitter)
+		}
+	}
+
+	for i, v := range raw.Then {
+		act := new(reaction.FileReactionAction)
+		err := unmarshalMessage(v, act, "timer/%d/%d", idx, i)
+		if err != nil {
+			return nil, err
+		}
+		out.Then = append(out.Then, act)
+	}
+
+	return out, nil
+}
+
+func unmarshalMessage(raw json.RawMessage, msg proto.Message, name string, args ...interface{}) error {
+	err := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(raw), msg)
+	if err != nil {
+		return except.NewInvalid("%s is invalid: %s", fmt.Sprintf(name, args...), err.Error())
+	}
+	return nil
+}
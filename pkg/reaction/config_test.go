@@ -0,0 +1,175 @@
+package reaction
+
+import (
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+}
+
+func (c *ConfigTestSuite) TestLoadEngineConfig() {
+	// -- Given
+	//
+	given := fstest.MapFS{"engine.yaml": &fstest.MapFile{Data: []byte(`
+setup:
+  - shell: { command: ./install.sh }
+files:
+  - when: [{ directories: [/data/saves], op: [create] }]
+    then: [{ upload: { from: { path: "{{abs}}" }, to: { bucketFile: { name: "{{filename}}" } } } }]
+logs:
+  - path: /data/logs/latest.log
+    reactions:
+      - when: [{ matches: { regex: Done } }]
+        then: [{ setStatus: { status: ready } }]
+timers:
+  - cron: "@daily"
+    timezone: America/New_York
+    jitter: 5m
+    then: [{ upload: { from: { path: /data/world }, to: { bucketFile: { name: world.zip } } } }]
+variables:
+  players_online: int
+`)}}
+	upload := &actions.UploadFile{
+		From: &actions.UploadFile_Source{Path: "/data/world"},
+		To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "world.zip"}},
+	}
+
+	// -- When
+	//
+	actual, err := LoadEngineConfig(given, "engine.yaml")
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.True(proto.Equal(&blueprint.SetupAction{Shell: &actions.Shell{Command: "./install.sh"}}, actual.Setup[0]))
+		c.True(proto.Equal(&reaction.FileReaction{
+			When: []*reaction.FileReactionCondition{
+				{Directories: []string{"/data/saves"}, Op: []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_create}},
+			},
+			Then: []*reaction.FileReactionAction{
+				{Upload: &actions.UploadFile{
+					From: &actions.UploadFile_Source{Path: "{{abs}}"},
+					To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{filename}}"}},
+				}},
+			},
+		}, actual.Files[0]))
+		c.Equal("/data/logs/latest.log", actual.Logs[0].Path)
+		c.True(proto.Equal(&reaction.LogReaction{
+			When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: "Done"}}},
+			Then: []*reaction.LogReactionAction{{SetStatus: &actions.SetStatus{Status: actions.SetStatus_ready}}},
+		}, actual.Logs[0].Reactions[0]))
+		c.Equal("@daily", actual.Timers[0].Cron)
+		c.Equal("America/New_York", actual.Timers[0].Timezone)
+		c.Equal(5*time.Minute, actual.Timers[0].Jitter)
+		c.True(proto.Equal(upload, actual.Timers[0].Then[0].GetUpload()))
+		c.Equal(map[string]variable.Type{"players_online": variable.TypeInt}, actual.Types)
+	}
+}
+
+func (c *ConfigTestSuite) TestNewEngineConfig() {
+	// -- Given
+	//
+	setup := []*blueprint.SetupAction{{Shell: &actions.Shell{Command: "./install.sh"}}}
+	logs := make([]*reaction.LogReaction, 1, 2)
+	logs[0] = &reaction.LogReaction{When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: "joined"}}}}
+	given := BlueprintReactions{
+		Setup:      setup,
+		Logs:       logs,
+		ReadyCheck: &blueprint.ReadyCheck{Regex: "Done"},
+		LogPath:    "/data/logs/latest.log",
+	}
+	extra := &EngineConfig{
+		Setup:  []*blueprint.SetupAction{{Shell: &actions.Shell{Command: "./mods.sh"}}},
+		Timers: []*TimerReaction{{Every: time.Hour}},
+		Types:  map[string]variable.Type{"players_online": variable.TypeInt},
+	}
+
+	// -- When
+	//
+	actual := NewEngineConfig(given)
+	actual.Extend(extra)
+
+	// -- Then
+	//
+	c.Len(actual.Setup, 2)
+	c.Equal("./mods.sh", actual.Setup[1].GetShell().GetCommand())
+	c.Len(setup, 1)
+	if c.Len(actual.Logs, 1) && c.Len(actual.Logs[0].Reactions, 2) {
+		c.Equal("/data/logs/latest.log", actual.Logs[0].Path)
+		c.Same(logs[0], actual.Logs[0].Reactions[0])
+		c.True(proto.Equal(ReadyCheckToLogReaction(given.ReadyCheck), actual.Logs[0].Reactions[1]))
+	}
+	c.Nil(logs[:cap(logs)][1])
+	c.Equal(extra.Timers, actual.Timers)
+	c.Equal(variable.TypeInt, actual.Types["players_online"])
+}
+
+func (c *ConfigTestSuite) TestNewEngineConfigNoLog() {
+	// -- When
+	//
+	actual := NewEngineConfig(BlueprintReactions{
+		Logs:       []*reaction.LogReaction{{}},
+		ReadyCheck: &blueprint.ReadyCheck{Regex: "Done"},
+	})
+
+	// -- Then
+	//
+	c.Empty(actual.Logs)
+}
+
+func (c *ConfigTestSuite) TestLoadEngineConfigJson() {
+	// -- Given
+	//
+	given := fstest.MapFS{"engine.json": &fstest.MapFile{Data: []byte(`{"timers": [{"every": "1h"}]}`)}}
+
+	// -- When
+	//
+	actual, err := LoadEngineConfig(given, "engine.json")
+
+	// -- Then
+	//
+	if c.NoError(err) {
+		c.Equal(time.Hour, actual.Timers[0].Every)
+	}
+}
+
+func (c *ConfigTestSuite) TestLoadEngineConfigInvalid() {
+	type test struct {
+		Filename string
+		Content  string
+	}
+
+	tests := []test{
+		{Filename: "engine.toml", Content: ""},
+		{Filename: "engine.yaml", Content: "setup: ["},
+		{Filename: "engine.yaml", Content: "setup: [{ shell: { command: [1] } }]"},
+		{Filename: "engine.yaml", Content: "timers: [{ every: soon }]"},
+		{Filename: "engine.yaml", Content: "timers: [{ every: 1h, jitter: lots }]"},
+		{Filename: "engine.yaml", Content: "variables: { players: number }"},
+	}
+
+	for i, v := range tests {
+		// -- When
+		//
+		_, err := LoadEngineConfig(fstest.MapFS{v.Filename: &fstest.MapFile{Data: []byte(v.Content)}}, v.Filename)
+
+		// -- Then
+		//
+		c.ErrorIs(err, except.ErrInvalid, "test %d", i)
+	}
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
@@ -0,0 +1,499 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"time"
+)
+
+// ReactionKind is the type of reaction run by an Engine.
+type ReactionKind int
+
+const (
+	ReactionKindSetup ReactionKind = iota
+	ReactionKindFile
+	ReactionKindLog
+	ReactionKindTimer
+)
+
+func (r ReactionKind) String() string {
+	switch r {
+	case ReactionKindFile:
+		return "file"
+	case ReactionKindLog:
+		return "log"
+	case ReactionKindTimer:
+		return "timer"
+	default:
+		return "setup"
+	}
+}
+
+// ReactionState is the lifecycle state of a reaction run by an Engine.
+type ReactionState int
+
+const (
+	// ReactionPending has not been started.
+	ReactionPending ReactionState = iota
+
+	// ReactionWatching is waiting for its condition to be met.
+	ReactionWatching
+
+	// ReactionDone has finished e.g. a setup action that was executed or a log reader that was read to the end.
+	ReactionDone
+
+	// ReactionStopped was stopped by the Engine.
+	ReactionStopped
+
+	// ReactionErrored failed to start or stopped unexpectedly.
+	ReactionErrored
+)
+
+func (r ReactionState) String() string {
+	switch r {
+	case ReactionWatching:
+		return "watching"
+	case ReactionDone:
+		return "done"
+	case ReactionStopped:
+		return "stopped"
+	case ReactionErrored:
+		return "errored"
+	default:
+		return "pending"
+	}
+}
+
+// ReactionHealth is a snapshot of a reaction run by an Engine.
+type ReactionHealth struct {
+	// Unique within the Engine e.g. file/0 or log/1/2.
+	Name  string
+	Kind  ReactionKind
+	State ReactionState
+
+	// Why the reaction errored.
+	Err error
+
+	// When the reaction's condition was last met. Zero if it has never fired.
+	LastFired time.Time
+	FireCount int
+
+	// The number of fires suppressed by the reaction's limits.
+	Suppressed int
+}
+
+// EngineConfig is every reaction of a blueprint. See NewEngineConfig to create one from the blueprint's reactions and
+// LoadEngineConfig to read extra reactions from a file.
+type EngineConfig struct {
+	// Executed in order before any reaction is started.
+	Setup  []*blueprint.SetupAction
+	Files  []*reaction.FileReaction
+	Logs   []*EngineLog
+	Timers []*TimerReaction
+
+	// The declared type of each variable within the store.
+	Types map[string]variable.Type
+}
+
+// EngineLog is a log and the reactions to it. Only one of Path or Reader should be set.
+type EngineLog struct {
+	// The path of a log file which is tailed.
+	Path string
+
+	// A log that's read until it's closed e.g. the app's stdout.
+	Reader io.Reader
+
+	Reactions []*reaction.LogReaction
+
+	// Reactions that were already compiled e.g. ones with a composite Condition.
+	Compiled []*CompiledLogReaction
+}
+
+type EngineOpts struct {
+	// Executes every action. Required.
+	Client actions2.Client
+
+	// Used by SetVariable and Variable actions to update the app. Used instead of Actions.AppClient if set.
+	AppClient app.AppServiceClient
+
+	// Shared by every reaction. Defaults to an empty store.
+	Store variable.Store
+
+	// Configures how every action is executed. The Client is always used instead of Actions.File.Client.
+	Actions ActionOpts
+
+	// Configures how logs are read. Log.Reactions, Log.Actions and Log.Clock are ignored.
+	Log ExecuteLogOpts
+
+	// Called whenever a timer fires, before its actions are executed.
+	OnTimerFire func(rx *TimerReaction, at time.Time)
+
+	// Tells the time of every reaction and schedules their deferred work e.g. timers. Used instead of
+	// Actions.File.Clock. Defaults to RealClock.
+	Clock Clock
+}
+
+// Engine runs every reaction from a blueprint. The engine starts and stops the reactions together and tracks the health
+// of each.
+type Engine struct {
+	Config EngineConfig
+	Opts   EngineOpts
+
+	logs [][]*CompiledLogReaction
+
+	lock    sync.Mutex
+	health  []*ReactionHealth
+	started bool
+	cancel  context.CancelCauseFunc
+	wg      sync.WaitGroup
+	done    chan struct{}
+}
+
+// NewEngine validates and compiles every reaction within the config.
+func NewEngine(conf EngineConfig, opts EngineOpts) (*Engine, error) {
+	if opts.Client == nil {
+		return nil, except.NewInvalid("an actions client is required")
+	}
+
+	if opts.Store == nil {
+		opts.Store = variable.NewStore()
+	}
+	opts.Actions.File.Client = opts.Client
+	opts.Clock = clockOrReal(opts.Clock)
+	opts.Actions.File.Clock = opts.Clock
+	opts.Log.Clock = opts.Clock
+	if opts.AppClient != nil {
+		opts.Actions.AppClient = opts.AppClient
+	}
+
+	_, err := CompileTimerReactions(conf.Timers...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conf.Types) > 0 {
+		declarer, ok := opts.Store.(variable.Declarer)
+		if !ok {
+			return nil, except.NewInvalid("the variable store does not support types")
+		}
+		for k, v := range conf.Types {
+			err = declarer.Declare(k, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	e := &Engine{
+		Config: conf,
+		Opts:   opts,
+		logs:   make([][]*CompiledLogReaction, 0, len(conf.Logs)),
+		done:   make(chan struct{}),
+	}
+
+	for i := range conf.Setup {
+		e.track(fmt.Sprintf("setup/%d", i), ReactionKindSetup)
+	}
+
+	for i := range conf.Files {
+		e.track(fmt.Sprintf("file/%d", i), ReactionKindFile)
+	}
+
+	for i, v := range conf.Logs {
+		if (v.Path == "") == (v.Reader == nil) {
+			return nil, except.NewInvalid("log %d requires either a path or a reader", i)
+		}
+
+		compiled, err := CompileLogReactions(v.Reactions...)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, v.Compiled...)
+		e.logs = append(e.logs, compiled)
+
+		for j := range compiled {
+			e.track(fmt.Sprintf("log/%d/%d", i, j), ReactionKindLog)
+		}
+	}
+
+	for i := range conf.Timers {
+		e.track(fmt.Sprintf("timer/%d", i), ReactionKindTimer)
+	}
+
+	return e, nil
+}
+
+// Start executes the setup actions in order then starts every reaction. If anything fails to start, every reaction
+// that was started is stopped and the error is returned. The reactions are stopped once the context is done or Stop is
+// called.
+func (e *Engine) Start(ctx context.Context) error {
+	e.lock.Lock()
+	if e.started {
+		e.lock.Unlock()
+		return except.NewInvalid("the engine has already been started")
+	}
+	e.started = true
+	ctx, e.cancel = context.WithCancelCause(ctx)
+	e.lock.Unlock()
+
+	err := e.start(ctx)
+	if err != nil {
+		e.cancel(err)
+		e.wg.Wait()
+		close(e.done)
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		e.wg.Wait()
+		close(e.done)
+	}()
+
+	return nil
+}
+
+// Stop stops every reaction and waits for their in-flight actions to finish.
+func (e *Engine) Stop() {
+	e.lock.Lock()
+	cancel := e.cancel
+	e.lock.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel(nil)
+	<-e.done
+}
+
+// Done is closed once the engine was started and every reaction has stopped.
+func (e *Engine) Done() <-chan struct{} {
+	return e.done
+}
+
+// Health is a snapshot of every reaction in the order they're started.
+func (e *Engine) Health() []ReactionHealth {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	out := make([]ReactionHealth, 0, len(e.health))
+	for _, v := range e.health {
+		out = append(out, *v)
+	}
+	return out
+}
+
+func (e *Engine) start(ctx context.Context) error {
+	idx := 0
+	for _, v := range e.Config.Setup {
+		err := ExecuteAction(ctx, e.Opts.Store, &Action{Setup: v}, e.Opts.Actions)
+		if err != nil {
+			e.errored(idx, err)
+			return err
+		}
+		e.fired(idx)
+		e.setState(idx, ReactionDone)
+		idx++
+	}
+
+	for _, v := range e.Config.Files {
+		err := e.startFile(ctx, idx, v)
+		if err != nil {
+			return err
+		}
+		idx++
+	}
+
+	for i, v := range e.Config.Logs {
+		err := e.startLog(ctx, idx, v, e.logs[i])
+		if err != nil {
+			return err
+		}
+		idx += len(e.logs[i])
+	}
+
+	return e.startTimers(ctx, idx)
+}
+
+func (e *Engine) startFile(ctx context.Context, idx int, ft *reaction.FileReaction) error {
+	opts := e.Opts.Actions.File
+	onChange := opts.OnFileChange
+	opts.OnFileChange = func(fn string) {
+		e.fired(idx)
+		if onChange != nil {
+			onChange(fn)
+		}
+	}
+	onSuppress := opts.OnSuppress
+	opts.OnSuppress = func(fn string) {
+		e.suppressed(idx)
+		if onSuppress != nil {
+			onSuppress(fn)
+		}
+	}
+
+	c, err := ExecuteFile(ctx, e.Opts.Store, e.Opts.Actions.Root, ft, opts)
+	if err != nil {
+		e.errored(idx, err)
+		return err
+	}
+
+	e.watch(ctx, c, idx)
+	return nil
+}
+
+func (e *Engine) startLog(ctx context.Context, idx int, l *EngineLog, rx []*CompiledLogReaction) error {
+	if len(rx) == 0 {
+		return nil
+	}
+
+	indices := make(map[*CompiledLogReaction]int, len(rx))
+	for i, v := range rx {
+		indices[v] = idx + i
+	}
+	all := e.span(idx, len(rx))
+
+	opts := e.Opts.Log
+	opts.Reactions = rx
+	opts.Actions = e.Opts.Actions
+	onMatch := opts.OnMatch
+	opts.OnMatch = func(ll LogLine, m *LogMatch) {
+		e.fired(indices[m.Reaction])
+		if onMatch != nil {
+			onMatch(ll, m)
+		}
+	}
+	onSuppress := opts.OnSuppress
+	opts.OnSuppress = func(ll LogLine, m *LogMatch) {
+		e.suppressed(indices[m.Reaction])
+		if onSuppress != nil {
+			onSuppress(ll, m)
+		}
+	}
+
+	if l.Reader != nil {
+		c, err := ExecuteLogReader(ctx, l.Reader, e.Opts.Store, e.Opts.Actions.AppClient, nil, opts)
+		if err != nil {
+			e.errored(idx, err)
+			return err
+		}
+		e.watch(ctx, c, all...)
+		return nil
+	}
+
+	err := ExecuteLog(ctx, l.Path, e.Opts.Store, e.Opts.Actions.AppClient, nil, opts)
+	if err != nil {
+		e.errored(idx, err)
+		return err
+	}
+
+	// The tailer retries until the context is done.
+	e.watch(ctx, ctx, all...)
+	return nil
+}
+
+func (e *Engine) startTimers(ctx context.Context, idx int) error {
+	indices := make(map[*TimerReaction]int, len(e.Config.Timers))
+	for i, v := range e.Config.Timers {
+		indices[v] = idx + i
+	}
+	all := e.span(idx, len(e.Config.Timers))
+
+	c, err := ExecuteTimers(ctx, e.Opts.Store, e.Config.Timers, ExecuteTimerOpts{
+		Actions: e.Opts.Actions,
+		Clock:   e.Opts.Clock,
+		OnFire: func(rx *TimerReaction, at time.Time) {
+			e.fired(indices[rx])
+			if e.Opts.OnTimerFire != nil {
+				e.Opts.OnTimerFire(rx, at)
+			}
+		},
+	})
+	if err != nil {
+		e.errored(idx, err)
+		return err
+	}
+
+	e.watch(ctx, c, all...)
+	return nil
+}
+
+// watch marks the reactions as watching until the context c is done.
+func (e *Engine) watch(ctx, c context.Context, idx ...int) {
+	for _, v := range idx {
+		e.setState(v, ReactionWatching)
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		<-c.Done()
+
+		cause := context.Cause(c)
+		for _, v := range idx {
+			if ctx.Err() != nil {
+				e.setState(v, ReactionStopped)
+			} else if cause == nil || errors.Is(cause, context.Canceled) || errors.Is(cause, io.EOF) {
+				e.setState(v, ReactionDone)
+			} else {
+				e.errored(v, cause)
+			}
+		}
+	}()
+}
+
+func (e *Engine) span(idx, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = idx + i
+	}
+	return out
+}
+
+func (e *Engine) track(name string, kind ReactionKind) {
+	e.health = append(e.health, &ReactionHealth{Name: name, Kind: kind})
+}
+
+func (e *Engine) fired(idx int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	h := e.health[idx]
+	h.LastFired = e.Opts.Clock.Now()
+	h.FireCount++
+}
+
+func (e *Engine) suppressed(idx int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.health[idx].Suppressed++
+}
+
+func (e *Engine) errored(idx int, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	h := e.health[idx]
+	logrus.WithError(err).WithField("reaction", h.Name).Error("Reaction errored.")
+	h.State = ReactionErrored
+	h.Err = err
+}
+
+func (e *Engine) setState(idx int, state ReactionState) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.health[idx].State = state
+}
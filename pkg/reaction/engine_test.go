@@ -0,0 +1,302 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"github.com/bxcodec/faker/v3"
+	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/api/go/mocks"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/mocks/actionsmocks"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type EngineTestSuite struct {
+	suite.Suite
+
+	Dir     string
+	Actions *actionsmocks.Client
+}
+
+func (e *EngineTestSuite) BeforeTest(_, _ string) {
+	e.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(e.Dir, os.ModePerm)
+	e.Actions = new(actionsmocks.Client)
+
+	// The engine should never use the global client.
+	actions2.Default = new(actionsmocks.Client)
+}
+
+func (e *EngineTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(e.Dir)
+}
+
+func (e *EngineTestSuite) TestEngine() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	saved := e.regex(`Saved (\w+)`)
+	conf := EngineConfig{
+		Setup: []*blueprint.SetupAction{
+			{Shell: &actions.Shell{Command: "./install.sh"}},
+		},
+		Files: []*reaction.FileReaction{
+			{
+				When: []*reaction.FileReactionCondition{
+					{
+						Directories: []string{e.Dir},
+						Op:          []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_create},
+					},
+				},
+				Then: []*reaction.FileReactionAction{
+					{
+						Upload: &actions.UploadFile{
+							From: &actions.UploadFile_Source{Path: "{{abs}}"},
+							To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{filename}}"}},
+						},
+					},
+				},
+			},
+		},
+		Logs: []*EngineLog{
+			{
+				Reader: strings.NewReader("Saved world\nSaved nether\n"),
+				Compiled: []*CompiledLogReaction{
+					{
+						Condition: saved,
+						Then: []*reaction.LogReactionAction{
+							{SetVariable: &actions.SetVariable{Name: "last_save", Value: "{{first_match}}"}},
+						},
+					},
+				},
+			},
+		},
+		Timers: []*TimerReaction{
+			{Every: 10 * time.Millisecond},
+		},
+	}
+	e.Actions.On("Shell", mock.Anything, &actions.Shell{Command: "./install.sh"}).Return(nil, nil)
+	e.Actions.On("Upload", "root", &actions.UploadFile{
+		From: &actions.UploadFile_Source{Path: filepath.Join(e.Dir, "world.zip")},
+		To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "world.zip"}},
+	}, actions2.UploadOpts{}).Return(nil)
+
+	engine, err := NewEngine(conf, EngineOpts{
+		Client:  e.Actions,
+		Store:   store,
+		Actions: ActionOpts{Root: "root"},
+	})
+	e.Require().NoError(err)
+
+	// -- When
+	//
+	err = engine.Start(context.Background())
+	e.Require().NoError(err)
+	_ = os.WriteFile(filepath.Join(e.Dir, "world.zip"), []byte("world"), os.ModePerm)
+
+	// -- Then
+	//
+	e.Eventually(func() bool {
+		h := engine.Health()
+		return h[1].FireCount == 1 && h[2].State == ReactionDone && h[3].FireCount >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	engine.Stop()
+	actual := engine.Health()
+	e.Equal([]string{"setup/0", "file/0", "log/0/0", "timer/0"}, e.names(actual))
+	e.Equal([]ReactionState{ReactionDone, ReactionStopped, ReactionDone, ReactionStopped}, e.states(actual))
+	e.Equal(1, actual[0].FireCount)
+	e.Equal(2, actual[2].FireCount)
+	e.False(actual[2].LastFired.IsZero())
+	e.Equal("nether", store.GetStringValue("last_save"))
+	e.Actions.AssertExpectations(e.T())
+
+	select {
+	case <-engine.Done():
+	default:
+		e.Fail("engine should be done")
+	}
+}
+
+func (e *EngineTestSuite) TestEngineActionsAppClient() {
+	// -- Given
+	//
+	appClient := new(mocks.AppServiceClient)
+	appClient.On("SetVariable", mock.Anything, mock.MatchedBy(func(req *app.SetVariable_Request) bool {
+		return req.GetName() == "last_save" && req.GetValue() == "world"
+	})).Return(nil, nil).Once()
+	engine, err := NewEngine(EngineConfig{
+		Logs: []*EngineLog{
+			{
+				Reader: strings.NewReader("Saved world\n"),
+				Compiled: []*CompiledLogReaction{
+					{
+						Condition: e.regex(`Saved (\w+)`),
+						Then: []*reaction.LogReactionAction{
+							{SetVariable: &actions.SetVariable{Name: "last_save", Value: "{{first_match}}", Save: true}},
+						},
+					},
+				},
+			},
+		},
+	}, EngineOpts{
+		Client:  e.Actions,
+		Actions: ActionOpts{AppClient: appClient},
+	})
+	e.Require().NoError(err)
+
+	// -- When
+	//
+	err = engine.Start(context.Background())
+	e.Require().NoError(err)
+
+	// -- Then
+	//
+	e.Eventually(func() bool {
+		return engine.Health()[0].State == ReactionDone
+	}, 5*time.Second, 10*time.Millisecond)
+	engine.Stop()
+	appClient.AssertExpectations(e.T())
+}
+
+func (e *EngineTestSuite) TestStartSetupError() {
+	// -- Given
+	//
+	expected := errors.New("install failed")
+	engine, err := NewEngine(EngineConfig{
+		Setup: []*blueprint.SetupAction{
+			{Shell: &actions.Shell{Command: "./install.sh"}},
+		},
+		Timers: []*TimerReaction{
+			{Every: time.Millisecond},
+		},
+	}, EngineOpts{Client: e.Actions})
+	e.Require().NoError(err)
+	e.Actions.On("Shell", mock.Anything, mock.Anything).Return(nil, expected)
+
+	// -- When
+	//
+	err = engine.Start(context.Background())
+
+	// -- Then
+	//
+	e.ErrorIs(err, expected)
+	actual := engine.Health()
+	e.Equal([]ReactionState{ReactionErrored, ReactionPending}, e.states(actual))
+	e.ErrorIs(actual[0].Err, expected)
+	<-engine.Done()
+}
+
+func (e *EngineTestSuite) TestEngineClock() {
+	// -- Given
+	//
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	fired := make(chan time.Time, 1)
+	engine, err := NewEngine(EngineConfig{
+		Timers: []*TimerReaction{
+			{Every: time.Hour},
+		},
+	}, EngineOpts{
+		Client: e.Actions,
+		Clock:  clock,
+		OnTimerFire: func(rx *TimerReaction, at time.Time) {
+			fired <- at
+		},
+	})
+	e.Require().NoError(err)
+
+	// -- When
+	//
+	e.Require().NoError(engine.Start(context.Background()))
+	defer engine.Stop()
+	e.Eventually(func() bool {
+		_, ok := clock.Next()
+		return ok
+	}, 5*time.Second, time.Millisecond)
+	clock.Advance(time.Hour)
+
+	// -- Then
+	//
+	e.Equal(start.Add(time.Hour), <-fired)
+	e.Equal(start.Add(time.Hour), engine.Health()[0].LastFired)
+}
+
+func (e *EngineTestSuite) TestStartTwice() {
+	// -- Given
+	//
+	engine, err := NewEngine(EngineConfig{}, EngineOpts{Client: e.Actions})
+	e.Require().NoError(err)
+	e.Require().NoError(engine.Start(context.Background()))
+	defer engine.Stop()
+
+	// -- When
+	//
+	err = engine.Start(context.Background())
+
+	// -- Then
+	//
+	e.ErrorIs(err, except.ErrInvalid)
+}
+
+func (e *EngineTestSuite) TestNewEngineInvalid() {
+	type test struct {
+		Conf EngineConfig
+		Opts EngineOpts
+	}
+
+	tests := []test{
+		{Opts: EngineOpts{}},
+		{Conf: EngineConfig{Logs: []*EngineLog{{}}}, Opts: EngineOpts{Client: e.Actions}},
+		{Conf: EngineConfig{Logs: []*EngineLog{{Path: "log.txt", Reader: strings.NewReader("")}}}, Opts: EngineOpts{Client: e.Actions}},
+		{Conf: EngineConfig{Timers: []*TimerReaction{{}}}, Opts: EngineOpts{Client: e.Actions}},
+	}
+
+	for i, v := range tests {
+		// -- When
+		//
+		_, err := NewEngine(v.Conf, v.Opts)
+
+		// -- Then
+		//
+		e.ErrorIs(err, except.ErrInvalid, "test %d", i)
+	}
+}
+
+func (e *EngineTestSuite) names(h []ReactionHealth) []string {
+	out := make([]string, 0, len(h))
+	for _, v := range h {
+		out = append(out, v.Name)
+	}
+	return out
+}
+
+func (e *EngineTestSuite) states(h []ReactionHealth) []ReactionState {
+	out := make([]ReactionState, 0, len(h))
+	for _, v := range h {
+		out = append(out, v.State)
+	}
+	return out
+}
+
+func (e *EngineTestSuite) regex(expr string) LogCondition {
+	c, err := Regex(expr)
+	e.Require().NoError(err)
+	return c
+}
+
+func TestEngineTestSuite(t *testing.T) {
+	suite.Run(t, new(EngineTestSuite))
+}
@@ -0,0 +1,401 @@
+package reaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// LogFormat is how each log line is structured.
+type LogFormat int
+
+const (
+	// LogFormatText is unstructured text.
+	LogFormatText LogFormat = iota
+
+	// LogFormatJSON is a JSON object per line.
+	LogFormatJSON
+
+	// LogFormatLogfmt is key=value pairs separated by spaces.
+	LogFormatLogfmt
+)
+
+func (l LogFormat) String() string {
+	switch l {
+	case LogFormatJSON:
+		return "json"
+	case LogFormatLogfmt:
+		return "logfmt"
+	default:
+		return "text"
+	}
+}
+
+// FieldOp is how a FieldMatcher compares a field with its value.
+type FieldOp int
+
+const (
+	// FieldExists is met if the field is set.
+	FieldExists FieldOp = iota
+
+	// FieldEquals is met if the field equals the value.
+	FieldEquals
+
+	// FieldNotEquals is met if the field is not set or doesn't equal the value.
+	FieldNotEquals
+
+	// FieldMatches is met if the field matches the regex value.
+	FieldMatches
+)
+
+// FieldMatcher checks a field within a structured log line.
+type FieldMatcher struct {
+	// The dot separated path to the field e.g. player.name or players.0. Keys containing dots can't be matched.
+	Path string
+
+	Op FieldOp
+
+	// What the field is compared against. Numbers and bools are compared using their JSON representation.
+	Value string
+}
+
+var fieldOps = []struct {
+	Token string
+	Op    FieldOp
+}{
+	{Token: "==", Op: FieldEquals},
+	{Token: "!=", Op: FieldNotEquals},
+	{Token: "=~", Op: FieldMatches},
+}
+
+// ParseFieldMatcher parses an expression e.g. level == "error", event != join, msg =~ "^Saved" or player.name. A path
+// on its own checks that the field exists. Values may be quoted.
+func ParseFieldMatcher(expr string) (FieldMatcher, error) {
+	// The first operator splits the path from the value so the value may contain operators e.g. msg =~ "a==b".
+	at, token, op := -1, "", FieldExists
+	for _, v := range fieldOps {
+		i := strings.Index(expr, v.Token)
+		if i >= 0 && (at < 0 || i < at) {
+			at, token, op = i, v.Token, v.Op
+		}
+	}
+
+	if at >= 0 {
+		path := strings.TrimSpace(expr[:at])
+		val := strings.TrimSpace(expr[at+len(token):])
+		if path == "" {
+			return FieldMatcher{}, except.NewInvalid("missing field path in %s", expr)
+		}
+
+		if strings.HasPrefix(val, `"`) {
+			unquoted, err := strconv.Unquote(val)
+			if err != nil {
+				return FieldMatcher{}, except.NewInvalid("invalid quoted value in %s", expr)
+			}
+			val = unquoted
+		}
+
+		return FieldMatcher{Path: path, Op: op, Value: val}, nil
+	}
+
+	path := strings.TrimSpace(expr)
+	if path == "" || strings.ContainsFunc(path, unicode.IsSpace) {
+		return FieldMatcher{}, except.NewInvalid("invalid field expression %s", expr)
+	}
+
+	return FieldMatcher{Path: path, Op: FieldExists}, nil
+}
+
+// FieldCondition is a LogCondition that decodes each line and checks its fields. Lines that can't be decoded never
+// meet the condition.
+type FieldCondition struct {
+	Format   LogFormat
+	Matchers []FieldMatcher
+
+	regexes []*regexp.Regexp
+}
+
+// Fields is met by every line where every matcher is met. If any matcher is a FieldMatches, the regex matches of the
+// first are returned. Otherwise, the whole line is returned as the match.
+func Fields(format LogFormat, matchers ...FieldMatcher) (*FieldCondition, error) {
+	if format == LogFormatText {
+		return nil, except.NewInvalid("fields can only be matched for json or logfmt logs")
+	}
+
+	out := &FieldCondition{
+		Format:   format,
+		Matchers: matchers,
+		regexes:  make([]*regexp.Regexp, len(matchers)),
+	}
+
+	for i, v := range matchers {
+		if v.Op != FieldMatches {
+			continue
+		}
+
+		re, err := regexp.Compile(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		out.regexes[i] = re
+	}
+
+	return out, nil
+}
+
+func (f *FieldCondition) Match(line string, now time.Time) []string {
+	return f.MatchLine(NewDecodedLine(line), now)
+}
+
+func (f *FieldCondition) MatchLine(line *DecodedLine, _ time.Time) []string {
+	fields, err := line.Fields(f.Format)
+	if err != nil {
+		return nil
+	}
+
+	var out []string
+	for i, v := range f.Matchers {
+		val, ok := LookupField(fields, v.Path)
+		switch v.Op {
+		case FieldExists:
+			if !ok {
+				return nil
+			}
+		case FieldEquals:
+			if !ok || fieldString(val) != v.Value {
+				return nil
+			}
+		case FieldNotEquals:
+			if ok && fieldString(val) == v.Value {
+				return nil
+			}
+		case FieldMatches:
+			if !ok {
+				return nil
+			}
+
+			m := f.regexes[i].FindStringSubmatch(fieldString(val))
+			if m == nil {
+				return nil
+			}
+
+			if out == nil {
+				out = m
+			}
+		}
+	}
+
+	if out == nil {
+		out = []string{strings.TrimRight(line.Text, "\r\n")}
+	}
+
+	return out
+}
+
+// SubexpNames are the group names of the first FieldMatches matcher.
+func (f *FieldCondition) SubexpNames() []string {
+	for _, v := range f.regexes {
+		if v != nil {
+			return v.SubexpNames()
+		}
+	}
+	return nil
+}
+
+// DecodeLogLine decodes the fields from a structured log line.
+func DecodeLogLine(format LogFormat, line string) (map[string]any, error) {
+	switch format {
+	case LogFormatJSON:
+		out := map[string]any{}
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		err := dec.Decode(&out)
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	case LogFormatLogfmt:
+		return decodeLogfmt(line)
+	}
+
+	return nil, except.NewInvalid("%s logs have no fields", format)
+}
+
+// decodeLogLine decodes the lines of DecodedLine. Replaced by tests.
+var decodeLogLine = DecodeLogLine
+
+// DecodedLine is a log line whose fields are decoded at most once per format and then shared by everything that reads
+// them e.g. every FieldCondition and the template entries of the line.
+type DecodedLine struct {
+	Text string
+
+	lock    sync.Mutex
+	decoded map[LogFormat]*decodedFields
+}
+
+type decodedFields struct {
+	Fields map[string]any
+	Err    error
+}
+
+func NewDecodedLine(text string) *DecodedLine {
+	return &DecodedLine{Text: text}
+}
+
+// Fields are the decoded fields of the line. The fields must not be modified.
+func (d *DecodedLine) Fields(format LogFormat) (map[string]any, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if v, ok := d.decoded[format]; ok {
+		return v.Fields, v.Err
+	}
+
+	if d.decoded == nil {
+		d.decoded = map[LogFormat]*decodedFields{}
+	}
+
+	fields, err := decodeLogLine(format, d.Text)
+	d.decoded[format] = &decodedFields{Fields: fields, Err: err}
+	return fields, err
+}
+
+// LookupField finds the value at the dot separated path within the fields.
+func LookupField(fields map[string]any, path string) (any, bool) {
+	var cur any = fields
+	for _, key := range strings.Split(path, ".") {
+		switch t := cur.(type) {
+		case map[string]any:
+			v, ok := t[key]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			cur = t[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// FieldEntries exposes every top level field as a template entry. Nested fields can be accessed from the templates
+// e.g. {{ player.name }}. Characters that can't be used within a template variable are replaced with _ e.g.
+// @timestamp becomes _timestamp.
+func FieldEntries(fields map[string]any) []*variable.Entry {
+	out := make([]*variable.Entry, 0, len(fields))
+	for k, v := range fields {
+		out = append(out, variable.NewEntry(fieldKey(k), v))
+	}
+	return out
+}
+
+func fieldKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, k)
+}
+
+func fieldString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return "null"
+	case map[string]any, []any:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// decodeLogfmt decodes key=value pairs. Values may be quoted. Keys without a value are set to true.
+func decodeLogfmt(line string) (map[string]any, error) {
+	out := map[string]any{}
+	s := strings.TrimSpace(line)
+	for len(s) > 0 {
+		end := strings.IndexFunc(s, func(r rune) bool {
+			return r == '=' || unicode.IsSpace(r)
+		})
+		if end < 0 {
+			end = len(s)
+		}
+
+		key := s[:end]
+		if key == "" {
+			return nil, except.NewInvalid("invalid logfmt line: %s", line)
+		}
+		s = s[end:]
+
+		if !strings.HasPrefix(s, "=") {
+			out[key] = true
+			s = strings.TrimLeftFunc(s, unicode.IsSpace)
+			continue
+		}
+		s = s[1:]
+
+		if strings.HasPrefix(s, `"`) {
+			val, rest, err := cutQuoted(s)
+			if err != nil {
+				return nil, except.NewInvalid("invalid logfmt line: %s", line)
+			}
+			out[key] = val
+			s = rest
+		} else {
+			end = strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			out[key] = s[:end]
+			s = s[end:]
+		}
+
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	}
+
+	return out, nil
+}
+
+// cutQuoted cuts the quoted string from the start of s.
+func cutQuoted(s string) (string, string, error) {
+	buf := bytes.Buffer{}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated escape")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			default:
+				buf.WriteByte(s[i])
+			}
+		case '"':
+			return buf.String(), s[i+1:], nil
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated quote")
+}
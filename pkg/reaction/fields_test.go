@@ -0,0 +1,231 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+type FieldsTestSuite struct {
+	suite.Suite
+}
+
+func (f *FieldsTestSuite) TestParseFieldMatcher() {
+	type test struct {
+		Given    string
+		Expected FieldMatcher
+	}
+
+	tests := []test{
+		{Given: `level == "error"`, Expected: FieldMatcher{Path: "level", Op: FieldEquals, Value: "error"}},
+		{Given: `event!=player_join`, Expected: FieldMatcher{Path: "event", Op: FieldNotEquals, Value: "player_join"}},
+		{Given: `msg =~ "^Saved (\\w+)"`, Expected: FieldMatcher{Path: "msg", Op: FieldMatches, Value: `^Saved (\w+)`}},
+		{Given: `msg =~ "a==b"`, Expected: FieldMatcher{Path: "msg", Op: FieldMatches, Value: "a==b"}},
+		{Given: ` player.name `, Expected: FieldMatcher{Path: "player.name", Op: FieldExists}},
+	}
+
+	for _, v := range tests {
+		// -- When
+		//
+		actual, err := ParseFieldMatcher(v.Given)
+
+		// -- Then
+		//
+		if f.NoError(err, v.Given) {
+			f.Equal(v.Expected, actual, v.Given)
+		}
+	}
+}
+
+func (f *FieldsTestSuite) TestParseFieldMatcherInvalid() {
+	for _, v := range []string{``, `== "error"`, `level == "error`, `level error`} {
+		// -- When
+		//
+		_, err := ParseFieldMatcher(v)
+
+		// -- Then
+		//
+		f.ErrorIs(err, except.ErrInvalid, v)
+	}
+}
+
+func (f *FieldsTestSuite) TestFieldsJSON() {
+	// -- Given
+	//
+	given := f.fields(LogFormatJSON, `level == "error"`, `player.name`, `code != 0`)
+
+	// -- When
+	//
+	actual := [][]string{
+		given.Match(`{"level": "error", "player": {"name": "steve"}, "code": 137}`, time.Now()),
+		given.Match(`{"level": "info", "player": {"name": "steve"}, "code": 137}`, time.Now()),
+		given.Match(`{"level": "error", "code": 137}`, time.Now()),
+		given.Match(`{"level": "error", "player": {"name": "steve"}, "code": 0}`, time.Now()),
+		given.Match(`level=error`, time.Now()),
+	}
+
+	// -- Then
+	//
+	f.Equal([][]string{
+		{`{"level": "error", "player": {"name": "steve"}, "code": 137}`},
+		nil,
+		nil,
+		nil,
+		nil,
+	}, actual)
+}
+
+func (f *FieldsTestSuite) TestFieldsLogfmt() {
+	// -- Given
+	//
+	given := f.fields(LogFormatLogfmt, `event == player_join`, `player =~ "^(\\w+)#"`)
+
+	// -- When
+	//
+	joined := given.Match(`time=12:00 event=player_join player="steve#1234" admin`, time.Now())
+	left := given.Match(`time=12:00 event=player_leave player="steve#1234"`, time.Now())
+
+	// -- Then
+	//
+	f.Equal([]string{"steve#", "steve"}, joined)
+	f.Nil(left)
+}
+
+func (f *FieldsTestSuite) TestFieldsText() {
+	// -- When
+	//
+	_, err := Fields(LogFormatText)
+
+	// -- Then
+	//
+	f.ErrorIs(err, except.ErrInvalid)
+}
+
+func (f *FieldsTestSuite) TestDecodeLogfmt() {
+	// -- When
+	//
+	actual, err := DecodeLogLine(LogFormatLogfmt, `level=info msg="player said \"hi\"" empty= debug`)
+
+	// -- Then
+	//
+	if f.NoError(err) {
+		f.Equal(map[string]any{
+			"level": "info",
+			"msg":   `player said "hi"`,
+			"empty": "",
+			"debug": true,
+		}, actual)
+	}
+}
+
+func (f *FieldsTestSuite) TestLookupField() {
+	// -- Given
+	//
+	fields, err := DecodeLogLine(LogFormatJSON, `{"players": [{"name": "steve"}, {"name": "alex"}]}`)
+	f.Require().NoError(err)
+
+	// -- When
+	//
+	alex, ok := LookupField(fields, "players.1.name")
+	_, missing := LookupField(fields, "players.2.name")
+
+	// -- Then
+	//
+	f.True(ok)
+	f.Equal("alex", alex)
+	f.False(missing)
+}
+
+func (f *FieldsTestSuite) TestExecuteLogReaderFields() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	reader := strings.NewReader(`{"event": "player_join", "player": {"name": "steve"}, "@timestamp": "12:00"}` + "\n")
+	given := &CompiledLogReaction{
+		Condition: f.fields(LogFormatJSON, `event == player_join`),
+		Format:    LogFormatJSON,
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "last_join", Value: "{{player.name}} at {{_timestamp}}"}},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, nil, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+	})
+
+	// -- Then
+	//
+	if f.NoError(err) {
+		<-c.Done()
+		f.Equal("steve at 12:00", store.GetStringValue("last_join"))
+	}
+}
+
+func (f *FieldsTestSuite) TestDecodeOncePerLine() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	given := []*CompiledLogReaction{
+		{
+			Condition: And(f.fields(LogFormatJSON, `event == player_join`), Not(f.fields(LogFormatJSON, `player.name == alex`))),
+			Format:    LogFormatJSON,
+			Then: []*reaction.LogReactionAction{
+				{SetVariable: &actions.SetVariable{Name: "last_join", Value: "{{player.name}}"}},
+			},
+		},
+		{
+			Condition: f.fields(LogFormatJSON, `player.name`),
+			Format:    LogFormatJSON,
+		},
+	}
+	var matches []*LogMatch
+	decodes := 0
+	decodeLogLine = func(format LogFormat, line string) (map[string]any, error) {
+		decodes++
+		return DecodeLogLine(format, line)
+	}
+	f.T().Cleanup(func() {
+		decodeLogLine = DecodeLogLine
+	})
+
+	// -- When
+	//
+	err := ReactToLog(LogLine{Text: `{"event": "player_join", "player": {"name": "steve"}}`}, store, nil, given, ExecuteLogOpts{
+		OnMatch: func(_ LogLine, m *LogMatch) {
+			matches = append(matches, m)
+		},
+	})
+
+	// -- Then
+	//
+	if f.NoError(err) && f.Len(matches, 2) {
+		f.Equal("steve", store.GetStringValue("last_join"))
+		f.Same(matches[0].Line, matches[1].Line)
+		f.Equal(1, decodes)
+	}
+}
+
+func (f *FieldsTestSuite) fields(format LogFormat, exprs ...string) LogCondition {
+	matchers := make([]FieldMatcher, 0, len(exprs))
+	for _, v := range exprs {
+		m, err := ParseFieldMatcher(v)
+		f.Require().NoError(err)
+		matchers = append(matchers, m)
+	}
+
+	c, err := Fields(format, matchers...)
+	f.Require().NoError(err)
+	return c
+}
+
+func TestFieldsTestSuite(t *testing.T) {
+	suite.Run(t, new(FieldsTestSuite))
+}
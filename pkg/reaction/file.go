@@ -14,19 +14,51 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type ExecuteFileOpts struct {
 	OnFileChange func(fn string)
 	UploadOpts   actions2.UploadOpts
 	DownloadOpts actions2.DownloadOpts
+	Watch        WatchFileOpts
+
+	// Events for the same file within the duration of each other are collapsed into one. The actions are executed
+	// once the file has not changed for the duration.
+	Debounce time.Duration
+
+	// Delays executing the actions until the file has finished being written.
+	Settle SettleOpts
+
+	// Executes the actions on a pool of workers rather than within the watch. When set, the returned context is only
+	// done once the queued actions have finished.
+	Queue QueueOpts
+
+	// Executes the actions. Defaults to actions.Default.
+	Client actions2.Client
+
+	// Limits how often the actions are executed.
+	Limit LimitOpts
+
+	// Called whenever an event is suppressed by the Limit.
+	OnSuppress func(fn string)
+
+	// Tells the time and schedules the deferred events of the Debounce, Settle and Limit. Defaults to RealClock.
+	Clock Clock
+}
+
+func (e ExecuteFileOpts) client() actions2.Client {
+	if e.Client != nil {
+		return e.Client
+	}
+	return actions2.Default
 }
 
 // ExecuteFile executes the blueprint.FileTrigger using the root. The root is the base path of where to execute the action
 // e.g. for download or upload.
 func ExecuteFile(ctx context.Context, store variable.Store, root string, ft *reaction.FileReaction, opts ExecuteFileOpts) (context.Context, error) {
 	logrus.WithField("data", ft.String()).Debug("Starting file triggers.")
-	c, err := WatchFile(ctx, func(event fsnotify.Event) {
+	var callback WatchFileFunc = func(event fsnotify.Event) {
 		if opts.OnFileChange != nil {
 			opts.OnFileChange(event.Name)
 		}
@@ -36,28 +68,68 @@ func ExecuteFile(ctx context.Context, store variable.Store, root string, ft *rea
 				logrus.WithError(err).WithField("file", event.Name).Error("Failed to execute action.")
 			}
 		}
-	}, ft.GetWhen()...)
+	}
+
+	// The queue is stopped separately from the watch so it also stops if the watch fails.
+	var queue *FileQueue
+	queueCtx, stopQueue := context.WithCancel(ctx)
+	if opts.Queue.enabled() {
+		queue = NewFileQueue(queueCtx, opts.Queue, callback)
+		callback = queue.Push
+	}
+
+	c, err := WatchFileWithOpts(ctx, FileEventFunc(ctx, opts, callback), opts.Watch, ft.GetWhen()...)
 	if err != nil {
+		stopQueue()
 		return nil, err
 	}
 
-	return c, nil
+	if queue == nil {
+		stopQueue()
+		return c, nil
+	}
+
+	drained, cancel := context.WithCancelCause(context.WithoutCancel(c))
+	go func() {
+		<-c.Done()
+		stopQueue()
+		<-queue.Done()
+		cancel(context.Cause(c))
+	}()
+
+	return drained, nil
+}
+
+// FileEventFunc passes each event on to the callback after the Debounce, Settle and Limit of the opts, in that order,
+// the same as ExecuteFile e.g. for events that don't come from a watch. Deferred events are dropped once the context is
+// done.
+func FileEventFunc(ctx context.Context, opts ExecuteFileOpts, callback WatchFileFunc) WatchFileFunc {
+	clock := clockOrReal(opts.Clock)
+	if opts.Limit.enabled() {
+		callback = limitFile(ctx, clock, opts.Limit, callback, opts.OnSuppress)
+	}
+
+	if opts.Settle.enabled() {
+		callback = settleFile(ctx, clock, opts.Settle, callback)
+	}
+
+	if opts.Debounce > 0 {
+		callback = debounceFile(ctx, clock, opts.Debounce, callback)
+	}
+
+	return callback
 }
 
 // ExecuteFileReactionAction executes the reaction.FileReactionAction using the root. The root is the base path of where
 // to execute the action e.g. for download or upload.
 func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reaction.FileReactionAction, opts ExecuteFileOpts) error {
-	dir, filename := filepath.Split(fp)
-	name, ext := fileutils.SplitFile(filename)
-	templateEntries := variable.FileReactionTemplateDataEntries(&reaction.FileReactionTemplateData{
-		Dir:      filepath.Clean(dir),
-		Filename: filename,
-		Ext:      strings.TrimPrefix(ext, "."),
-		Abs:      fp,
-		Name:     name,
-	})
 	logrus.WithField("data", s.String()).WithField("action", action.String()).Debug("Executing file trigger.")
+	return executeFileReactionAction(root, RenderFileReactionAction(action, s, fileTemplateEntries(fp)...), opts)
+}
 
+// RenderFileReactionAction renders the templates within the action using the store and entries. The action is not
+// modified.
+func RenderFileReactionAction(action *reaction.FileReactionAction, s variable.Store, templateEntries ...*variable.Entry) *reaction.FileReactionAction {
 	// Required so the template rendering doesn't update the original.
 	action = proto.Clone(action).(*reaction.FileReactionAction)
 
@@ -71,16 +143,10 @@ func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reacti
 				t.Directory = variable.RenderString(t.Directory, s, templateEntries...)
 			}
 		}
-
-		logrus.WithField("data", v.String()).Debug("Triggering rename.")
-		return actions2.Rename(v)
 	} else if v := action.GetDownload(); v != nil {
 		if t := v.GetTo(); t != "" {
 			v.To = variable.RenderString(t, s, templateEntries...)
 		}
-
-		logrus.WithField("data", v.String()).Debug("Triggering download.")
-		return actions2.Download(root, v, opts.DownloadOpts)
 	} else if v := action.GetExtract(); v != nil {
 		if t := v.GetTo(); t != "" {
 			v.To = variable.RenderString(t, s, templateEntries...)
@@ -91,9 +157,6 @@ func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reacti
 				t.Directory = variable.RenderString(t.Directory, s, templateEntries...)
 			}
 		}
-
-		logrus.WithField("data", v.String()).Debug("Triggering extract.")
-		return actions2.Extract(v)
 	} else if v := action.GetUnzip(); v != nil {
 		if f := v.GetFrom(); f != "" {
 			v.From = variable.RenderString(f, s, templateEntries...)
@@ -102,9 +165,6 @@ func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reacti
 		if f := v.GetTo(); f != "" {
 			v.To = variable.RenderString(f, s, templateEntries...)
 		}
-
-		logrus.WithField("data", v.String()).Debug("Triggering unzip.")
-		return actions2.Unzip(v)
 	} else if v := action.GetZip(); v != nil {
 		if p := v.GetTo().GetPath(); p != "" {
 			v.To = &actions.ZipFile_Destination{Path: variable.RenderString(p, s, templateEntries...)}
@@ -118,9 +178,6 @@ func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reacti
 				v.From.Files[i].From = variable.RenderString(entry.From, s, templateEntries...)
 			}
 		}
-
-		logrus.WithField("data", v.String()).Debug("Triggering zip.")
-		return actions2.Zip(v)
 	} else if v := action.GetUpload(); v != nil {
 		if v.GetFrom().GetPath() != "" {
 			v.From = &actions.UploadFile_Source{Path: variable.RenderString(v.GetFrom().GetPath(), s, templateEntries...)}
@@ -129,9 +186,6 @@ func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reacti
 		if to := v.GetTo().GetBucketFile(); to != nil {
 			to.Name = variable.RenderString(to.Name, s, templateEntries...)
 		}
-
-		logrus.WithField("data", v.String()).Debug("Triggering upload.")
-		return actions2.Upload(root, v, opts.UploadOpts)
 	} else if v := action.GetMove(); v != nil {
 		if v.GetFrom().GetDirectory() != "" {
 			v.From.Directory = variable.RenderString(v.GetFrom().GetDirectory(), s, templateEntries...)
@@ -140,72 +194,150 @@ func ExecuteFileReactionAction(fp, root string, s variable.Store, action *reacti
 		if to := v.GetTo(); to != "" {
 			v.To = variable.RenderString(v.To, s, templateEntries...)
 		}
+	}
+
+	return action
+}
 
+// executeFileReactionAction executes an action that was already rendered.
+func executeFileReactionAction(root string, action *reaction.FileReactionAction, opts ExecuteFileOpts) error {
+	client := opts.client()
+	if v := action.GetRename(); v != nil {
+		logrus.WithField("data", v.String()).Debug("Triggering rename.")
+		return client.Rename(v)
+	} else if v := action.GetDownload(); v != nil {
+		logrus.WithField("data", v.String()).Debug("Triggering download.")
+		return client.Download(root, v, opts.DownloadOpts)
+	} else if v := action.GetExtract(); v != nil {
+		logrus.WithField("data", v.String()).Debug("Triggering extract.")
+		return client.Extract(v)
+	} else if v := action.GetUnzip(); v != nil {
+		logrus.WithField("data", v.String()).Debug("Triggering unzip.")
+		return client.Unzip(v)
+	} else if v := action.GetZip(); v != nil {
+		logrus.WithField("data", v.String()).Debug("Triggering zip.")
+		return client.Zip(v)
+	} else if v := action.GetUpload(); v != nil {
+		logrus.WithField("data", v.String()).Debug("Triggering upload.")
+		return client.Upload(root, v, opts.UploadOpts)
+	} else if v := action.GetMove(); v != nil {
 		logrus.WithField("data", v.String()).Debug("Triggering move.")
-		return actions2.Move(v)
+		return client.MoveFile(v)
 	}
 
 	return nil
 }
 
+func fileTemplateEntries(fp string) []*variable.Entry {
+	dir, filename := filepath.Split(fp)
+	name, ext := fileutils.SplitFile(filename)
+	return variable.FileReactionTemplateDataEntries(&reaction.FileReactionTemplateData{
+		Dir:      filepath.Clean(dir),
+		Filename: filename,
+		Ext:      strings.TrimPrefix(ext, "."),
+		Abs:      fp,
+		Name:     name,
+	})
+}
+
 type WatchFileFunc func(event fsnotify.Event)
 
 func WatchFile(ctx context.Context, callback WatchFileFunc, conds ...*reaction.FileReactionCondition) (context.Context, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, err
+	return WatchFileWithOpts(ctx, callback, WatchFileOpts{}, conds...)
+}
+
+// WatchFileWithOpts is the same as WatchFile but allows for configuring how the directories are watched.
+func WatchFileWithOpts(ctx context.Context, callback WatchFileFunc, opts WatchFileOpts, conds ...*reaction.FileReactionCondition) (context.Context, error) {
+	sources := &watchSources{Opts: opts}
+	for _, v := range conds {
+		for _, d := range v.GetDirectories() {
+			err := os.MkdirAll(d, os.ModePerm)
+			if err != nil {
+				logrus.WithError(err).WithField("directory", d).Warn("Failed to create dir. Waiting 10 seconds for the dir to appear.")
+			}
+
+			err = sources.AddRoot(d, opts.backend(d))
+			if err != nil {
+				logrus.WithError(err).WithField("directory", d).Error("Failed to watch directory.")
+				sources.Close()
+				return nil, err
+			}
+		}
 	}
 
 	ctx, cancel := context.WithCancelCause(ctx)
 
+	react := func(event fsnotify.Event) {
+		if event.Op&fsnotify.Chmod == fsnotify.Chmod || event.Op&fsnotify.Rename == fsnotify.Rename {
+			return
+		}
+
+		matches := false
+		for _, v := range conds {
+			matches = matches || FileReactionCondition(event, v)
+		}
+
+		if matches {
+			callback(event)
+		}
+	}
+
+	type sourceEvent struct {
+		Event fsnotify.Event
+		Dirs  *dirWatcher
+	}
+
+	// Events from every backend are funneled into a single loop so the callback is never called concurrently.
+	events := make(chan sourceEvent)
+	for _, v := range sources.List() {
+		go func(dirs *dirWatcher) {
+			errs := dirs.Watcher.Errors()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case err, ok := <-errs:
+					if !ok {
+						errs = nil
+						continue
+					}
+					logrus.WithError(err).Warn("Error while watching for file changes.")
+				case event, ok := <-dirs.Watcher.Events():
+					if !ok {
+						cancel(fmt.Errorf("watch closed"))
+						return
+					}
+
+					select {
+					case <-ctx.Done():
+						return
+					case events <- sourceEvent{Event: event, Dirs: dirs}:
+					}
+				}
+			}
+		}(v)
+	}
+
 	go func() {
 		defer func() {
-			cancel(err)
+			sources.Close()
+			cancel(nil)
 		}()
 		for {
 			select {
 			case <-ctx.Done():
-				err = context.Cause(ctx)
 				return
-			case event, ok := <-watcher.Events:
-				logrus.WithField("fp", event.Name).WithField("op", event.Op).Trace("Detected file change.")
-				if !ok {
-					err = fmt.Errorf("watch closed")
-					return
-				}
-
-				if event.Op&fsnotify.Chmod == fsnotify.Chmod || event.Op&fsnotify.Rename == fsnotify.Rename {
-					continue
-				}
-
-				matches := false
-				for _, v := range conds {
-					matches = matches || FileReactionCondition(event, v)
-				}
-
-				if matches {
-					callback(event)
+			case v := <-events:
+				logrus.WithField("fp", v.Event.Name).WithField("op", v.Event.Op).Trace("Detected file change.")
+				found := v.Dirs.Handle(v.Event)
+				react(v.Event)
+				for _, f := range found {
+					react(f)
 				}
 			}
 		}
 	}()
 
-	for _, v := range conds {
-		for _, d := range v.GetDirectories() {
-			err = os.MkdirAll(d, os.ModePerm)
-			if err != nil {
-				logrus.WithError(err).WithField("directory", d).Warn("Failed to create dir. Waiting 10 seconds for the dir to appear.")
-			}
-			logrus.WithField("directory", d).Debug("Watching directory for triggers.")
-
-			err = watcher.Add(d)
-			if err != nil {
-				logrus.WithError(err).WithField("directory", d).Error("Failed to watch directory.")
-				return nil, err
-			}
-		}
-	}
-
 	return ctx, nil
 }
 
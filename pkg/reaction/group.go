@@ -0,0 +1,180 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/diazo/pkg/except"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultGroupFlushTimeout = 500 * time.Millisecond
+)
+
+// GroupLinesOpts configures how physical log lines are grouped into a single logical event e.g. a stack trace. The
+// grouped lines are joined by newlines so regexes that should match across lines need the s flag e.g. (?s).
+type GroupLinesOpts struct {
+	// Lines matching the regex are appended to the previous event e.g. ^\s+ for indented lines.
+	Continuation string
+
+	// Lines matching the regex start a new event. Every other line is appended to the previous event e.g. ^\[\d{2}: for
+	// lines starting with a timestamp.
+	Start string
+
+	// How long to wait for another line before the event is passed on. Defaults to DefaultGroupFlushTimeout.
+	FlushTimeout time.Duration
+
+	// The max number of lines in a single event. Once reached, the event is passed on. If zero, there is no limit.
+	MaxLines int
+}
+
+func (g GroupLinesOpts) enabled() bool {
+	return g.Continuation != "" || g.Start != ""
+}
+
+// GroupLines calls the callback with events made up of every line that belongs together. The LogLine.Num of an event
+// is the number of its first line. A pending event is dropped once the context is done.
+func GroupLines(ctx context.Context, opts GroupLinesOpts, callback WatchLogFunc) (WatchLogFunc, error) {
+	return GroupLinesWithClock(ctx, RealClock, opts, callback)
+}
+
+// GroupLinesWithClock is the same as GroupLines but the flush timeout is measured by the clock.
+func GroupLinesWithClock(ctx context.Context, clock Clock, opts GroupLinesOpts, callback WatchLogFunc) (WatchLogFunc, error) {
+	g, err := newLineGrouper(ctx, clock, opts, callback)
+	if err != nil {
+		return nil, err
+	}
+	return g.Add, nil
+}
+
+func newLineGrouper(ctx context.Context, clock Clock, opts GroupLinesOpts, callback WatchLogFunc) (*lineGrouper, error) {
+	if !opts.enabled() {
+		return nil, except.NewInvalid("either a continuation or start regex is required to group lines")
+	}
+
+	var continuation, start *regexp.Regexp
+	var err error
+	if opts.Continuation != "" {
+		continuation, err = regexp.Compile(opts.Continuation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Start != "" {
+		start, err = regexp.Compile(opts.Start)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := opts.FlushTimeout
+	if timeout <= 0 {
+		timeout = DefaultGroupFlushTimeout
+	}
+
+	g := &lineGrouper{
+		Ctx:      ctx,
+		Clock:    clock,
+		Callback: callback,
+		MaxLines: opts.MaxLines,
+		Timeout:  timeout,
+		IsContinuation: func(text string) bool {
+			text = strings.TrimRight(text, "\r\n")
+			if continuation != nil && continuation.MatchString(text) {
+				return true
+			}
+			return start != nil && !start.MatchString(text)
+		},
+	}
+	context.AfterFunc(ctx, g.stop)
+
+	return g, nil
+}
+
+type lineGrouper struct {
+	Ctx            context.Context
+	Clock          Clock
+	Callback       WatchLogFunc
+	MaxLines       int
+	Timeout        time.Duration
+	IsContinuation func(text string) bool
+
+	lock  sync.Mutex
+	event *LogLine
+	lines int
+	timer ClockTimer
+	gen   int
+}
+
+func (l *lineGrouper) Add(ll LogLine) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.event != nil && l.IsContinuation(ll.Text) {
+		if !strings.HasSuffix(l.event.Text, "\n") {
+			l.event.Text += "\n"
+		}
+		l.event.Text += ll.Text
+		l.lines++
+	} else {
+		l.flush()
+		l.event = &ll
+		l.lines = 1
+	}
+
+	if l.MaxLines > 0 && l.lines >= l.MaxLines {
+		l.flush()
+		return
+	}
+
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+
+	// The generation prevents a timer that already fired from flushing a newer event.
+	l.gen++
+	gen := l.gen
+	l.timer = l.Clock.AfterFunc(l.Timeout, func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if l.gen == gen {
+			l.flush()
+		}
+	})
+}
+
+// Flush passes on the pending event.
+func (l *lineGrouper) Flush() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.flush()
+}
+
+// stop drops the pending event. Once stopped, no more events are passed on as the context is done.
+func (l *lineGrouper) stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.gen++
+	l.event = nil
+	l.lines = 0
+}
+
+// flush passes on the pending event. Must be called with the lock held so events are passed on in order.
+func (l *lineGrouper) flush() {
+	if l.event == nil {
+		return
+	}
+
+	ev := *l.event
+	l.event = nil
+	l.lines = 0
+	if l.Ctx.Err() == nil {
+		l.Callback(ev)
+	}
+}
@@ -0,0 +1,198 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type GroupTestSuite struct {
+	suite.Suite
+}
+
+func (g *GroupTestSuite) TestGroupLinesContinuation() {
+	// -- Given
+	//
+	actual := make([]LogLine, 0)
+	given, err := GroupLines(context.Background(), GroupLinesOpts{Continuation: `^\s+`, FlushTimeout: time.Hour}, func(ll LogLine) {
+		actual = append(actual, ll)
+	})
+	if !g.NoError(err) {
+		return
+	}
+
+	// -- When
+	//
+	given(LogLine{Text: "java.lang.NullPointerException: oops", Num: 1})
+	given(LogLine{Text: "\tat com.example.Main.run(Main.java:10)", Num: 2})
+	given(LogLine{Text: "\tat com.example.Main.main(Main.java:5)", Num: 3})
+	given(LogLine{Text: "Server stopped", Num: 4})
+	given(LogLine{Text: "Bye", Num: 5})
+
+	// -- Then
+	//
+	g.Equal([]LogLine{
+		{Text: "java.lang.NullPointerException: oops\n\tat com.example.Main.run(Main.java:10)\n\tat com.example.Main.main(Main.java:5)", Num: 1},
+		{Text: "Server stopped", Num: 4},
+	}, actual)
+}
+
+func (g *GroupTestSuite) TestGroupLinesStart() {
+	// -- Given
+	//
+	actual := make([]LogLine, 0)
+	given, err := GroupLines(context.Background(), GroupLinesOpts{Start: `^\[\d{2}:\d{2}:\d{2}\]`, FlushTimeout: time.Hour}, func(ll LogLine) {
+		actual = append(actual, ll)
+	})
+	if !g.NoError(err) {
+		return
+	}
+
+	// -- When
+	//
+	given(LogLine{Text: "[12:00:00] Players online:\n", Num: 1})
+	given(LogLine{Text: "steve\n", Num: 2})
+	given(LogLine{Text: "alex\n", Num: 3})
+	given(LogLine{Text: "[12:00:01] Saved\n", Num: 4})
+
+	// -- Then
+	//
+	g.Equal([]LogLine{
+		{Text: "[12:00:00] Players online:\nsteve\nalex\n", Num: 1},
+	}, actual)
+}
+
+func (g *GroupTestSuite) TestGroupLinesFlushTimeout() {
+	// -- Given
+	//
+	lock := sync.Mutex{}
+	actual := make([]LogLine, 0)
+	given, err := GroupLines(context.Background(), GroupLinesOpts{Continuation: `^\s+`, FlushTimeout: 20 * time.Millisecond}, func(ll LogLine) {
+		lock.Lock()
+		defer lock.Unlock()
+		actual = append(actual, ll)
+	})
+	if !g.NoError(err) {
+		return
+	}
+
+	// -- When
+	//
+	given(LogLine{Text: "Exception", Num: 1})
+	given(LogLine{Text: "  at here", Num: 2})
+
+	// -- Then
+	//
+	g.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(actual) == 1
+	}, time.Second, 5*time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	g.Equal(LogLine{Text: "Exception\n  at here", Num: 1}, actual[0])
+}
+
+func (g *GroupTestSuite) TestGroupLinesMaxLines() {
+	// -- Given
+	//
+	actual := make([]LogLine, 0)
+	given, err := GroupLines(context.Background(), GroupLinesOpts{Continuation: `^\s+`, MaxLines: 2, FlushTimeout: time.Hour}, func(ll LogLine) {
+		actual = append(actual, ll)
+	})
+	if !g.NoError(err) {
+		return
+	}
+
+	// -- When
+	//
+	given(LogLine{Text: "Exception", Num: 1})
+	given(LogLine{Text: "  at a", Num: 2})
+	given(LogLine{Text: "  at b", Num: 3})
+
+	// -- Then
+	//
+	g.Equal([]LogLine{
+		{Text: "Exception\n  at a", Num: 1},
+	}, actual)
+}
+
+func (g *GroupTestSuite) TestGroupLinesInvalid() {
+	// -- When
+	//
+	_, missingErr := GroupLines(context.Background(), GroupLinesOpts{}, func(ll LogLine) {})
+	_, regexErr := GroupLines(context.Background(), GroupLinesOpts{Start: "("}, func(ll LogLine) {})
+
+	// -- Then
+	//
+	g.ErrorIs(missingErr, except.ErrInvalid)
+	g.Error(regexErr)
+}
+
+func (g *GroupTestSuite) TestExecuteLogReaderGrouped() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	reader := strings.NewReader("Starting\nException in thread main java.lang.IllegalStateException\n\tat com.example.World.load(World.java:42)\nDone\n")
+	rx := []*reaction.LogReaction{
+		{
+			When: []*reaction.LogReactionCondition{
+				{Matches: &reaction.LogMatcher{Regex: `(?s)Exception.*World\.load`}},
+			},
+			Then: []*reaction.LogReactionAction{
+				{SetVariable: &actions.SetVariable{Name: "crash", Value: "{{line}}"}},
+			},
+		},
+	}
+
+	rx = append(rx, &reaction.LogReaction{
+		When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: `^Done`}}},
+		Then: []*reaction.LogReactionAction{{SetVariable: &actions.SetVariable{Name: "done", Value: "yes"}}},
+	})
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, rx, ExecuteLogOpts{
+		Group: GroupLinesOpts{Continuation: `^\s+at `, FlushTimeout: time.Hour},
+	})
+
+	// -- Then
+	//
+	if g.NoError(err) {
+		<-c.Done()
+		g.Equal("yes", store.GetStringValue("done"))
+		g.Equal("Exception in thread main java.lang.IllegalStateException\n\tat com.example.World.load(World.java:42)\n", store.GetStringValue("crash"))
+	}
+}
+
+func (g *GroupTestSuite) TestGroupLinesCancelled() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	given, err := GroupLines(ctx, GroupLinesOpts{Continuation: `^\s+`, FlushTimeout: 10 * time.Millisecond}, func(ll LogLine) {
+		calls++
+	})
+	g.Require().NoError(err)
+	given(LogLine{Text: "Exception", Num: 1})
+
+	// -- When
+	//
+	cancel()
+	time.Sleep(30 * time.Millisecond)
+
+	// -- Then
+	//
+	g.Zero(calls)
+}
+
+func TestGroupTestSuite(t *testing.T) {
+	suite.Run(t, new(GroupTestSuite))
+}
@@ -0,0 +1,302 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/diazo/pkg/gamequery"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	// IdleSourceLog is the source of the players counted by IdleDetector.WatchLog.
+	IdleSourceLog = "log"
+
+	// IdleSourceQuery is the source of the players counted by IdleOpts.Query.
+	IdleSourceQuery = "query"
+
+	DefaultIdleQueryInterval = 30 * time.Second
+)
+
+// IdleState is whether an IdleDetector considers the server idle.
+type IdleState int
+
+const (
+	// IdleActive has players or has not been empty for the IdleOpts.Period.
+	IdleActive IdleState = iota
+
+	// IdleWarning has been empty for the IdleOpts.Period and becomes idle once the IdleOpts.Grace has passed.
+	IdleWarning
+
+	// Idle has been empty for the IdleOpts.Period and IdleOpts.Grace and should be shut down.
+	Idle
+)
+
+func (i IdleState) String() string {
+	switch i {
+	case IdleWarning:
+		return "warning"
+	case Idle:
+		return "idle"
+	default:
+		return "active"
+	}
+}
+
+// IdleEvent is a change of the IdleState.
+type IdleEvent struct {
+	From IdleState
+	To   IdleState
+	At   time.Time
+
+	// The time left until the server is idle. Only set for IdleWarning.
+	Remaining time.Duration
+
+	Players int
+}
+
+type IdleOpts struct {
+	// How long the server must be empty before it's idle.
+	Period time.Duration
+
+	// How long after the warning the server becomes idle. If a player joins within the grace, the server is active
+	// again. If zero, the server becomes idle without a warning.
+	Grace time.Duration
+
+	// Called for every IdleEvent e.g. to warn players of the shutdown on IdleWarning and to shut down on Idle.
+	OnEvent func(ev IdleEvent)
+
+	// When set, polled for the number of players every QueryInterval e.g. using QueryPlayers. Errors are logged and
+	// the last count is kept.
+	Query func(ctx context.Context) (int, error)
+
+	// Defaults to DefaultIdleQueryInterval.
+	QueryInterval time.Duration
+
+	// Tells the time and schedules the Period, Grace and Query. Defaults to RealClock.
+	Clock Clock
+}
+
+// IdleDetector tracks the number of players across sources e.g. join and leave lines in the log, game queries or
+// connection counts. The server has players while any source has players. The detector starts empty so a server that
+// nobody joins also becomes idle.
+type IdleDetector struct {
+	Opts IdleOpts
+
+	ctx     context.Context
+	lock    sync.Mutex
+	players map[string]int
+	state   IdleState
+	timer   ClockTimer
+
+	// Incremented whenever the timer is replaced so a stale timer does nothing.
+	gen int
+}
+
+// NewIdleDetector starts the idle timer and the Query. Both are stopped once the context is done.
+func NewIdleDetector(ctx context.Context, opts IdleOpts) *IdleDetector {
+	opts.Clock = clockOrReal(opts.Clock)
+	d := &IdleDetector{
+		Opts:    opts,
+		ctx:     ctx,
+		players: map[string]int{},
+	}
+
+	d.lock.Lock()
+	d.startTimer(opts.Period, IdleWarning)
+	d.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		d.lock.Lock()
+		d.stopTimer()
+		d.lock.Unlock()
+	}()
+
+	if opts.Query != nil {
+		go d.poll()
+	}
+
+	return d
+}
+
+// Set the number of players reported by the source.
+func (d *IdleDetector) Set(source string, players int) {
+	if players < 0 {
+		players = 0
+	}
+
+	d.lock.Lock()
+	d.players[source] = players
+	d.update()
+}
+
+// Add the delta to the number of players reported by the source e.g. 1 for a join and -1 for a leave. The count never
+// goes below zero.
+func (d *IdleDetector) Add(source string, delta int) {
+	d.lock.Lock()
+	players := d.players[source] + delta
+	if players < 0 {
+		players = 0
+	}
+	d.players[source] = players
+	d.update()
+}
+
+// Players is the highest number of players reported by any source.
+func (d *IdleDetector) Players() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.count()
+}
+
+func (d *IdleDetector) State() IdleState {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.state
+}
+
+// WatchLog counts a player for every line that meets the join condition and removes one for every line that meets the
+// leave condition. Can be used as the ExecuteLogOpts.Watcher. The conditions are cloned so each watched log has its own
+// state.
+func (d *IdleDetector) WatchLog(join, leave LogCondition) WatchLogFunc {
+	if join != nil {
+		join = CloneLogCondition(join)
+	}
+	if leave != nil {
+		leave = CloneLogCondition(leave)
+	}
+
+	return func(ll LogLine) {
+		now := d.Opts.Clock.Now()
+		if join != nil && len(join.Match(ll.Text, now)) > 0 {
+			d.Add(IdleSourceLog, 1)
+		}
+
+		if leave != nil && len(leave.Match(ll.Text, now)) > 0 {
+			d.Add(IdleSourceLog, -1)
+		}
+	}
+}
+
+// update must be called with the lock held and unlocks it.
+func (d *IdleDetector) update() {
+	players := d.count()
+	from := d.state
+	if players == 0 {
+		if from == IdleActive && d.timer == nil {
+			d.startTimer(d.Opts.Period, IdleWarning)
+		}
+		d.lock.Unlock()
+		return
+	}
+
+	d.stopTimer()
+	d.state = IdleActive
+	d.lock.Unlock()
+
+	if from != IdleActive {
+		d.emit(IdleEvent{From: from, To: IdleActive, Players: players})
+	}
+}
+
+func (d *IdleDetector) count() int {
+	out := 0
+	for _, v := range d.players {
+		if v > out {
+			out = v
+		}
+	}
+	return out
+}
+
+// startTimer moves the detector to the state once the duration has passed. Must be called with the lock held.
+func (d *IdleDetector) startTimer(dur time.Duration, to IdleState) {
+	d.stopTimer()
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	gen := d.gen
+	d.timer = d.Opts.Clock.AfterFunc(dur, func() {
+		d.lock.Lock()
+		if gen != d.gen || d.ctx.Err() != nil {
+			d.lock.Unlock()
+			return
+		}
+		d.timer = nil
+
+		if to == IdleWarning && d.Opts.Grace <= 0 {
+			to = Idle
+		}
+
+		ev := IdleEvent{From: d.state, To: to}
+		d.state = to
+		if to == IdleWarning {
+			ev.Remaining = d.Opts.Grace
+			d.startTimer(d.Opts.Grace, Idle)
+		}
+		d.lock.Unlock()
+
+		d.emit(ev)
+	})
+}
+
+// stopTimer must be called with the lock held.
+func (d *IdleDetector) stopTimer() {
+	d.gen++
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+func (d *IdleDetector) emit(ev IdleEvent) {
+	ev.At = d.Opts.Clock.Now()
+	logrus.WithField("from", ev.From.String()).WithField("to", ev.To.String()).Info("Server idle state changed.")
+	if d.Opts.OnEvent != nil {
+		d.Opts.OnEvent(ev)
+	}
+}
+
+func (d *IdleDetector) poll() {
+	interval := d.Opts.QueryInterval
+	if interval <= 0 {
+		interval = DefaultIdleQueryInterval
+	}
+
+	for {
+		players, err := d.Opts.Query(d.ctx)
+		if d.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			logrus.WithError(err).Debug("Failed to query the number of players.")
+		} else {
+			d.Set(IdleSourceQuery, players)
+		}
+
+		due := make(chan struct{})
+		timer := d.Opts.Clock.AfterFunc(interval, func() {
+			close(due)
+		})
+		select {
+		case <-d.ctx.Done():
+			timer.Stop()
+			return
+		case <-due:
+		}
+	}
+}
+
+// QueryPlayers adapts a game query e.g. gamequery.QueryA2S into an IdleOpts.Query.
+func QueryPlayers(query func(ctx context.Context, addr string) (*gamequery.Info, error), addr string) func(ctx context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		info, err := query(ctx, addr)
+		if err != nil {
+			return 0, err
+		}
+		return info.Players, nil
+	}
+}
@@ -0,0 +1,260 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"github.com/hostfactor/diazo/pkg/gamequery"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type IdleTestSuite struct {
+	suite.Suite
+
+	lock   sync.Mutex
+	Events []IdleEvent
+	Clock  *ManualClock
+	Start  time.Time
+}
+
+func (i *IdleTestSuite) BeforeTest(_, _ string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.Events = nil
+	i.Start = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	i.Clock = NewManualClock(i.Start)
+}
+
+func (i *IdleTestSuite) TestIdle() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	given := NewIdleDetector(ctx, IdleOpts{
+		Period:  10 * time.Minute,
+		Grace:   5 * time.Minute,
+		OnEvent: i.onEvent,
+		Clock:   i.Clock,
+	})
+	i.Clock.Advance(10 * time.Minute)
+
+	// -- Then
+	//
+	i.Equal(IdleWarning, given.State())
+	i.Clock.Advance(5 * time.Minute)
+	i.Equal(Idle, given.State())
+	actual := i.events()
+	if i.Len(actual, 2) {
+		i.Equal(IdleWarning, actual[0].To)
+		i.Equal(5*time.Minute, actual[0].Remaining)
+		i.Equal(i.Start.Add(10*time.Minute), actual[0].At)
+		i.Equal(IdleWarning, actual[1].From)
+		i.Equal(Idle, actual[1].To)
+		i.Equal(i.Start.Add(15*time.Minute), actual[1].At)
+	}
+}
+
+func (i *IdleTestSuite) TestIdleNoGrace() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	given := NewIdleDetector(ctx, IdleOpts{
+		Period:  10 * time.Minute,
+		OnEvent: i.onEvent,
+		Clock:   i.Clock,
+	})
+	i.Clock.Advance(10 * time.Minute)
+
+	// -- Then
+	//
+	i.Equal(Idle, given.State())
+	actual := i.events()
+	if i.Len(actual, 1) {
+		i.Equal(IdleActive, actual[0].From)
+	}
+}
+
+func (i *IdleTestSuite) TestJoinWithinGrace() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := NewIdleDetector(ctx, IdleOpts{
+		Period:  10 * time.Minute,
+		Grace:   time.Hour,
+		OnEvent: i.onEvent,
+		Clock:   i.Clock,
+	})
+	i.Clock.Advance(10 * time.Minute)
+
+	// -- When
+	//
+	given.Add(IdleSourceLog, 1)
+
+	// -- Then
+	//
+	i.Clock.Advance(time.Hour)
+	i.Equal(IdleActive, given.State())
+	actual := i.events()
+	if i.Len(actual, 2) {
+		i.Equal(IdleWarning, actual[1].From)
+		i.Equal(IdleActive, actual[1].To)
+		i.Equal(1, actual[1].Players)
+	}
+}
+
+func (i *IdleTestSuite) TestPlayersAcrossSources() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := NewIdleDetector(ctx, IdleOpts{Period: time.Hour})
+
+	// -- When
+	//
+	given.Add(IdleSourceLog, 1)
+	given.Add(IdleSourceLog, -2)
+	given.Set(IdleSourceQuery, 3)
+	given.Set("connections", 2)
+
+	// -- Then
+	//
+	i.Equal(3, given.Players())
+	given.Set(IdleSourceQuery, 0)
+	i.Equal(2, given.Players())
+}
+
+func (i *IdleTestSuite) TestLeaveRestartsPeriod() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := NewIdleDetector(ctx, IdleOpts{
+		Period:  10 * time.Minute,
+		OnEvent: i.onEvent,
+		Clock:   i.Clock,
+	})
+	given.Add(IdleSourceLog, 1)
+
+	// -- When
+	//
+	i.Clock.Advance(15 * time.Minute)
+	given.Add(IdleSourceLog, -1)
+
+	// -- Then
+	//
+	i.Clock.Advance(9 * time.Minute)
+	i.Equal(IdleActive, given.State())
+	i.Clock.Advance(time.Minute)
+	i.Equal(Idle, given.State())
+	actual := i.events()
+	if i.Len(actual, 1) {
+		i.Equal(i.Start.Add(25*time.Minute), actual[0].At)
+	}
+}
+
+func (i *IdleTestSuite) TestWatchLog() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := NewIdleDetector(ctx, IdleOpts{Period: time.Hour})
+	join, err := Regex(`(\w+) joined the game`)
+	i.Require().NoError(err)
+	leave, err := Regex(`(\w+) left the game`)
+	i.Require().NoError(err)
+	watch := given.WatchLog(join, leave)
+
+	// -- When
+	//
+	for _, v := range []string{"steve joined the game", "alex joined the game", "steve left the game", "Saving chunks"} {
+		watch(LogLine{Text: v})
+	}
+
+	// -- Then
+	//
+	i.Equal(1, given.Players())
+}
+
+func (i *IdleTestSuite) TestQuery() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := atomic.Int32{}
+	query := func(ctx context.Context, addr string) (*gamequery.Info, error) {
+		if calls.Add(1) == 1 {
+			return nil, errors.New("not started")
+		}
+		return &gamequery.Info{Players: 4}, nil
+	}
+
+	// -- When
+	//
+	given := NewIdleDetector(ctx, IdleOpts{
+		Period:        time.Hour,
+		Query:         QueryPlayers(query, "localhost:27015"),
+		QueryInterval: time.Minute,
+		Clock:         i.Clock,
+	})
+
+	// -- Then
+	//
+	i.Eventually(func() bool {
+		next, ok := i.Clock.Next()
+		return ok && next.Equal(i.Start.Add(time.Minute))
+	}, 5*time.Second, time.Millisecond)
+	i.Zero(given.Players())
+	i.Clock.Advance(time.Minute)
+	i.Eventually(func() bool {
+		return given.Players() == 4
+	}, 5*time.Second, time.Millisecond)
+	i.EqualValues(2, calls.Load())
+}
+
+func (i *IdleTestSuite) TestCancelled() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewIdleDetector(ctx, IdleOpts{
+		Period:  10 * time.Minute,
+		OnEvent: i.onEvent,
+		Clock:   i.Clock,
+	})
+
+	// -- When
+	//
+	cancel()
+	i.Clock.Advance(10 * time.Minute)
+
+	// -- Then
+	//
+	i.Equal(IdleActive, given.State())
+	i.Empty(i.events())
+}
+
+func (i *IdleTestSuite) onEvent(ev IdleEvent) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.Events = append(i.Events, ev)
+}
+
+func (i *IdleTestSuite) events() []IdleEvent {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return append([]IdleEvent(nil), i.Events...)
+}
+
+func TestIdleTestSuite(t *testing.T) {
+	suite.Run(t, new(IdleTestSuite))
+}
@@ -0,0 +1,238 @@
+package reaction
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Edge is which fires are kept when a reaction is limited.
+type Edge int
+
+const (
+	// EdgeLeading executes the first fire and suppresses any more until the limits allow it.
+	EdgeLeading Edge = iota
+
+	// EdgeTrailing defers each fire until the limits allow it. If the reaction fires again while deferred, the latest
+	// fire replaces the deferred one.
+	EdgeTrailing
+
+	// EdgeBoth executes the first fire like EdgeLeading and defers the latest of any more like EdgeTrailing.
+	EdgeBoth
+)
+
+func (e Edge) leading() bool {
+	return e == EdgeLeading || e == EdgeBoth
+}
+
+func (e Edge) trailing() bool {
+	return e == EdgeTrailing || e == EdgeBoth
+}
+
+// LimitOpts limits how often a reaction fires e.g. for a chatty log line or a save that's rewritten every second.
+type LimitOpts struct {
+	// The min amount of time between fires.
+	Cooldown time.Duration
+
+	// The max number of fires within the Window. Ignored if Window is zero.
+	MaxFires int
+	Window   time.Duration
+
+	Edge Edge
+}
+
+func (l LimitOpts) enabled() bool {
+	return l.Cooldown > 0 || l.MaxFires > 0 && l.Window > 0
+}
+
+// LimiterStats are the number of fires a Limiter executed and suppressed.
+type LimiterStats struct {
+	Fired      int
+	Suppressed int
+}
+
+// Limiter enforces the LimitOpts of a single reaction.
+type Limiter struct {
+	Opts LimitOpts
+
+	// Schedules deferred fires.
+	Clock Clock
+
+	lock     sync.Mutex
+	fires    []time.Time
+	pending  *limitedFire
+	timer    ClockTimer
+	stopped  bool
+	fired    int
+	suppress int
+}
+
+type limitedFire struct {
+	Fn         func() error
+	OnSuppress func()
+}
+
+func NewLimiter(opts LimitOpts) *Limiter {
+	return NewLimiterWithClock(opts, RealClock)
+}
+
+// NewLimiterWithClock creates a Limiter whose deferred fires are scheduled by the clock. The times passed to Fire
+// should come from the same clock.
+func NewLimiterWithClock(opts LimitOpts, clock Clock) *Limiter {
+	return &Limiter{Opts: opts, Clock: clockOrReal(clock)}
+}
+
+// Fire executes the fn if the limits allow a fire at the time. Otherwise, depending on the Edge, the fire is either
+// suppressed or deferred until the limits allow it. The onSuppress func, which may be nil, is called if the fire is
+// suppressed, including when a deferred fire is replaced.
+//
+// The error of the fn is returned if it was executed immediately. Errors of deferred fires are logged.
+func (l *Limiter) Fire(now time.Time, fn func() error, onSuppress func()) error {
+	l.lock.Lock()
+	if l.stopped {
+		l.lock.Unlock()
+		l.suppressed(onSuppress)
+		return nil
+	}
+
+	at := l.allowedAt(now)
+	if l.pending == nil && !at.After(now) && (l.Opts.Edge.leading() || l.Opts.Cooldown == 0) {
+		l.record(now)
+		l.lock.Unlock()
+		return fn()
+	}
+
+	if !l.Opts.Edge.trailing() {
+		l.lock.Unlock()
+		l.suppressed(onSuppress)
+		return nil
+	}
+
+	// A trailing fire waits out the cooldown so later fires can replace it.
+	if !at.After(now) {
+		at = now.Add(l.Opts.Cooldown)
+	}
+
+	replaced := l.pending
+	l.pending = &limitedFire{Fn: fn, OnSuppress: onSuppress}
+	if l.timer == nil {
+		l.timer = clockOrReal(l.Clock).AfterFunc(at.Sub(now), func() {
+			l.flush(at)
+		})
+	}
+	l.lock.Unlock()
+
+	if replaced != nil {
+		l.suppressed(replaced.OnSuppress)
+	}
+	return nil
+}
+
+// Stop suppresses the deferred fire and any future fires.
+func (l *Limiter) Stop() {
+	l.lock.Lock()
+	l.stopped = true
+	pending := l.pending
+	l.pending = nil
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.lock.Unlock()
+
+	if pending != nil {
+		l.suppressed(pending.OnSuppress)
+	}
+}
+
+func (l *Limiter) Stats() LimiterStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return LimiterStats{Fired: l.fired, Suppressed: l.suppress}
+}
+
+func (l *Limiter) flush(at time.Time) {
+	l.lock.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.timer = nil
+	if pending == nil || l.stopped {
+		l.lock.Unlock()
+		return
+	}
+	l.record(at)
+	l.lock.Unlock()
+
+	err := pending.Fn()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to execute deferred reaction.")
+	}
+}
+
+func (l *Limiter) suppressed(onSuppress func()) {
+	l.lock.Lock()
+	l.suppress++
+	l.lock.Unlock()
+
+	if onSuppress != nil {
+		onSuppress()
+	}
+}
+
+// allowedAt is the earliest time from now that the limits allow a fire.
+func (l *Limiter) allowedAt(now time.Time) time.Time {
+	at := now
+	if n := len(l.fires); n > 0 && l.Opts.Cooldown > 0 {
+		if next := l.fires[n-1].Add(l.Opts.Cooldown); next.After(at) {
+			at = next
+		}
+	}
+
+	if l.Opts.MaxFires > 0 && l.Opts.Window > 0 && len(l.fires) >= l.Opts.MaxFires {
+		// The oldest fire within the window must expire first.
+		if next := l.fires[len(l.fires)-l.Opts.MaxFires].Add(l.Opts.Window); next.After(at) {
+			at = next
+		}
+	}
+
+	return at
+}
+
+func (l *Limiter) record(at time.Time) {
+	l.fired++
+	l.fires = append(l.fires, at)
+
+	keep := 1
+	if l.Opts.MaxFires > keep && l.Opts.Window > 0 {
+		keep = l.Opts.MaxFires
+	}
+	if len(l.fires) > keep {
+		l.fires = append(l.fires[:0], l.fires[len(l.fires)-keep:]...)
+	}
+}
+
+// LimitFile limits how often the callback is called. Deferred events are dropped once the context is done.
+func LimitFile(ctx context.Context, opts LimitOpts, callback WatchFileFunc, onSuppress func(fn string)) WatchFileFunc {
+	return limitFile(ctx, RealClock, opts, callback, onSuppress)
+}
+
+func limitFile(ctx context.Context, clock Clock, opts LimitOpts, callback WatchFileFunc, onSuppress func(fn string)) WatchFileFunc {
+	limiter := NewLimiterWithClock(opts, clock)
+	context.AfterFunc(ctx, limiter.Stop)
+
+	return func(event fsnotify.Event) {
+		var suppressed func()
+		if onSuppress != nil {
+			suppressed = func() {
+				onSuppress(event.Name)
+			}
+		}
+
+		_ = limiter.Fire(limiter.Clock.Now(), func() error {
+			callback(event)
+			return nil
+		}, suppressed)
+	}
+}
@@ -0,0 +1,330 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type LimitTestSuite struct {
+	suite.Suite
+
+	Now time.Time
+}
+
+func (l *LimitTestSuite) BeforeTest(_, _ string) {
+	l.Now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (l *LimitTestSuite) TestLeadingCooldown() {
+	// -- Given
+	//
+	given := NewLimiter(LimitOpts{Cooldown: 10 * time.Second})
+	var actual []int
+	suppressed := 0
+
+	// -- When
+	//
+	for i, v := range []time.Duration{0, time.Second, 5 * time.Second, 11 * time.Second} {
+		i := i
+		_ = given.Fire(l.Now.Add(v), func() error {
+			actual = append(actual, i)
+			return nil
+		}, func() {
+			suppressed++
+		})
+	}
+
+	// -- Then
+	//
+	l.Equal([]int{0, 3}, actual)
+	l.Equal(2, suppressed)
+	l.Equal(LimiterStats{Fired: 2, Suppressed: 2}, given.Stats())
+}
+
+func (l *LimitTestSuite) TestMaxFires() {
+	// -- Given
+	//
+	given := NewLimiter(LimitOpts{MaxFires: 2, Window: 10 * time.Second})
+	var actual []int
+
+	// -- When
+	//
+	for i, v := range []time.Duration{0, time.Second, 2 * time.Second, 10 * time.Second, 10500 * time.Millisecond, 11 * time.Second} {
+		i := i
+		_ = given.Fire(l.Now.Add(v), func() error {
+			actual = append(actual, i)
+			return nil
+		}, nil)
+	}
+
+	// -- Then
+	//
+	l.Equal([]int{0, 1, 3, 5}, actual)
+	l.Equal(LimiterStats{Fired: 4, Suppressed: 2}, given.Stats())
+}
+
+func (l *LimitTestSuite) TestFireError() {
+	// -- Given
+	//
+	expected := errors.New("failed")
+	given := NewLimiter(LimitOpts{Cooldown: time.Second})
+
+	// -- When
+	//
+	err := given.Fire(l.Now, func() error {
+		return expected
+	}, nil)
+
+	// -- Then
+	//
+	l.ErrorIs(err, expected)
+}
+
+func (l *LimitTestSuite) TestTrailing() {
+	// -- Given
+	//
+	given := NewLimiter(LimitOpts{Cooldown: 20 * time.Millisecond, Edge: EdgeTrailing})
+	fired := make(chan int, 3)
+
+	// -- When
+	//
+	for i := 0; i < 3; i++ {
+		i := i
+		_ = given.Fire(time.Now(), func() error {
+			fired <- i
+			return nil
+		}, nil)
+	}
+
+	// -- Then
+	//
+	l.Empty(fired)
+	select {
+	case actual := <-fired:
+		l.Equal(2, actual)
+	case <-time.After(5 * time.Second):
+		l.Fail("trailing fire was not executed")
+	}
+	l.Equal(LimiterStats{Fired: 1, Suppressed: 2}, given.Stats())
+}
+
+func (l *LimitTestSuite) TestBoth() {
+	// -- Given
+	//
+	given := NewLimiter(LimitOpts{Cooldown: 20 * time.Millisecond, Edge: EdgeBoth})
+	fired := make(chan int, 3)
+
+	// -- When
+	//
+	for i := 0; i < 3; i++ {
+		i := i
+		_ = given.Fire(time.Now(), func() error {
+			fired <- i
+			return nil
+		}, nil)
+	}
+
+	// -- Then
+	//
+	l.Equal(0, <-fired)
+	select {
+	case actual := <-fired:
+		l.Equal(2, actual)
+	case <-time.After(5 * time.Second):
+		l.Fail("trailing fire was not executed")
+	}
+	l.Equal(LimiterStats{Fired: 2, Suppressed: 1}, given.Stats())
+}
+
+func (l *LimitTestSuite) TestStop() {
+	// -- Given
+	//
+	given := NewLimiter(LimitOpts{Cooldown: 10 * time.Millisecond, Edge: EdgeTrailing})
+	fired := make(chan struct{}, 1)
+	_ = given.Fire(time.Now(), func() error {
+		fired <- struct{}{}
+		return nil
+	}, nil)
+
+	// -- When
+	//
+	given.Stop()
+
+	// -- Then
+	//
+	select {
+	case <-fired:
+		l.Fail("deferred fire should have been dropped")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.Equal(LimiterStats{Suppressed: 1}, given.Stats())
+}
+
+func (l *LimitTestSuite) TestLimitFile() {
+	// -- Given
+	//
+	lock := sync.Mutex{}
+	var actual []string
+	var suppressed []string
+	given := LimitFile(context.Background(), LimitOpts{Cooldown: time.Hour}, func(event fsnotify.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		actual = append(actual, event.Name)
+	}, func(fn string) {
+		suppressed = append(suppressed, fn)
+	})
+
+	// -- When
+	//
+	given(fsnotify.Event{Name: "save.1", Op: fsnotify.Write})
+	given(fsnotify.Event{Name: "save.2", Op: fsnotify.Write})
+
+	// -- Then
+	//
+	l.Equal([]string{"save.1"}, actual)
+	l.Equal([]string{"save.2"}, suppressed)
+}
+
+func (l *LimitTestSuite) TestExecuteLogReaderLimit() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	cond, err := Regex(`ERROR (\w+)`)
+	l.Require().NoError(err)
+	given := &CompiledLogReaction{
+		Condition: cond,
+		Limit:     LimitOpts{Cooldown: time.Hour},
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "error", Value: "{{first_match}}"}},
+		},
+	}
+	matched := 0
+	suppressed := 0
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), strings.NewReader("ERROR a\nERROR b\nERROR c\n"), store, nil, nil, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+		OnMatch: func(ll LogLine, m *LogMatch) {
+			matched++
+		},
+		OnSuppress: func(ll LogLine, m *LogMatch) {
+			suppressed++
+		},
+	})
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		<-c.Done()
+		l.Equal("a", store.GetStringValue("error"))
+		l.Equal(1, matched)
+		l.Equal(2, suppressed)
+	}
+}
+
+func (l *LimitTestSuite) TestExecuteLogReaderLimitStopped() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	cond, err := Regex(`ERROR (\w+)`)
+	l.Require().NoError(err)
+	given := &CompiledLogReaction{
+		Condition: cond,
+		Limit:     LimitOpts{Cooldown: 20 * time.Millisecond, Edge: EdgeTrailing},
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "error", Value: "{{first_match}}"}},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suppressed := make(chan struct{}, 1)
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(ctx, strings.NewReader("ERROR a\n"), store, nil, nil, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+		OnSuppress: func(ll LogLine, m *LogMatch) {
+			suppressed <- struct{}{}
+		},
+	})
+	l.Require().NoError(err)
+	<-c.Done()
+	cancel()
+
+	// -- Then
+	//
+	select {
+	case <-suppressed:
+	case <-time.After(5 * time.Second):
+		l.Fail("deferred fire was not dropped")
+	}
+	time.Sleep(50 * time.Millisecond)
+	l.Empty(store.GetStringValue("error"))
+}
+
+func (l *LimitTestSuite) TestLogReactorClock() {
+	// -- Given
+	//
+	clock := &scheduledClock{At: l.Now}
+	cond, err := Regex(`ERROR`)
+	l.Require().NoError(err)
+	given := &CompiledLogReaction{
+		Condition: cond,
+		Limit:     LimitOpts{Cooldown: time.Minute, Edge: EdgeBoth},
+	}
+	fired := 0
+	reactor := NewLogReactor(context.Background(), variable.NewStore(), nil, []*CompiledLogReaction{given}, ExecuteLogOpts{
+		Clock: clock,
+		OnMatch: func(ll LogLine, m *LogMatch) {
+			fired++
+		},
+	})
+
+	// -- When
+	//
+	l.NoError(reactor.React(LogLine{Text: "ERROR"}))
+	clock.At = clock.At.Add(10 * time.Second)
+	l.NoError(reactor.React(LogLine{Text: "ERROR"}))
+
+	// -- Then
+	//
+	l.Equal(1, fired)
+	l.Equal([]time.Duration{50 * time.Second}, clock.Scheduled)
+	clock.Fns[0]()
+	l.Equal(2, fired)
+	l.Equal(LimiterStats{Fired: 2}, reactor.Limiter(given).Stats())
+}
+
+// scheduledClock records every call it schedules without calling it.
+type scheduledClock struct {
+	At        time.Time
+	Scheduled []time.Duration
+	Fns       []func()
+}
+
+func (s *scheduledClock) Now() time.Time {
+	return s.At
+}
+
+func (s *scheduledClock) AfterFunc(d time.Duration, fn func()) ClockTimer {
+	s.Scheduled = append(s.Scheduled, d)
+	s.Fns = append(s.Fns, fn)
+	return s
+}
+
+func (s *scheduledClock) Stop() bool {
+	return true
+}
+
+func TestLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitTestSuite))
+}
@@ -12,15 +12,41 @@ import (
 	"github.com/nxadm/tail"
 	"github.com/sirupsen/logrus"
 	"io"
+	"path/filepath"
 	"regexp"
+	"sync"
+	"time"
 )
 
 type ExecuteLogOpts struct {
 	Watcher WatchLogFunc
 
 	// Called whenever the server is set to change its status. This func could be called with the same status multiple times.
-	// It is up to the caller to track these status changes.
+	// It is up to the caller to track these status changes e.g. using StatusTracker.Set.
 	OnStatusChange StatusChangeFunc
+
+	// Configures how the log is tailed by ExecuteLog.
+	Tail WatchLogOpts
+
+	// Groups multiple lines into a single event before they're matched e.g. stack traces.
+	Group GroupLinesOpts
+
+	// Reactions that were already compiled e.g. ones with a composite Condition. These are executed alongside the
+	// reactions passed to ExecuteLog and ExecuteLogReader.
+	Reactions []*CompiledLogReaction
+
+	// Configures how the CompiledLogReaction.Actions are executed.
+	Actions ActionOpts
+
+	// Called whenever a reaction fires for a line, before its actions are executed. Deferred fires of a limited reaction
+	// are called once they're executed.
+	OnMatch func(ll LogLine, m *LogMatch)
+
+	// Called whenever a fire is suppressed by the reaction's Limit.
+	OnSuppress func(ll LogLine, m *LogMatch)
+
+	// When each line was logged and the scheduler of deferred fires. Defaults to RealClock.
+	Clock Clock
 }
 
 type WatchLogFunc func(ll LogLine)
@@ -32,34 +58,40 @@ type LogLine struct {
 	Num  int
 }
 
+// Watch calls the callback with every line of the reader. The returned context is done once the reader exits and every
+// line it read was passed to the callback, or once the ctx is done. Lines read after the ctx is done are dropped.
 func Watch(ctx context.Context, r io.Reader, callback WatchLogFunc) context.Context {
 	lines := make(chan LogLine, 100)
 
+	parent := ctx
 	ctx, cancel := context.WithCancelCause(ctx)
 
 	reader := bufio.NewReader(r)
+	var readErr error
 	go func() {
 		line := 1
-		var err error
-		defer func() {
-			cancel(err)
-			close(lines)
-		}()
+		defer close(lines)
 		var text string
 		for {
-			text, err = reader.ReadString('\n')
-			if err != nil {
-				logrus.WithError(err).Error("Watcher is exiting.")
+			text, readErr = reader.ReadString('\n')
+			if readErr != nil {
+				logrus.WithError(readErr).Error("Watcher is exiting.")
 				return
 			}
-			lines <- LogLine{
+			select {
+			case <-parent.Done():
+				return
+			case lines <- LogLine{
 				Text: text,
 				Num:  line,
+			}:
 			}
 			line++
 		}
 	}()
 
+	// The returned context is only cancelled once every line read before the reader exited has been passed to the
+	// callback.
 	go func() {
 		defer func() {
 			err := context.Cause(ctx)
@@ -67,10 +99,12 @@ func Watch(ctx context.Context, r io.Reader, callback WatchLogFunc) context.Cont
 		}()
 		for {
 			select {
-			case <-ctx.Done():
+			case <-parent.Done():
+				cancel(context.Cause(parent))
 				return
 			case ll, ok := <-lines:
 				if !ok {
+					cancel(readErr)
 					return
 				}
 				callback(ll)
@@ -81,27 +115,106 @@ func Watch(ctx context.Context, r io.Reader, callback WatchLogFunc) context.Cont
 	return ctx
 }
 
+type WatchLogOpts struct {
+	// A file the position of the last handled line is saved to. When set, the log is read from the saved position
+	// rather than from the beginning unless the log was replaced or truncated since.
+	OffsetFile string
+
+	// How often the position is saved to the OffsetFile. Defaults to DefaultOffsetInterval. The position is always
+	// saved once the watch stops.
+	OffsetInterval time.Duration
+
+	// How the log is watched for new lines. Defaults to WatchBackendAuto.
+	Backend WatchBackend
+}
+
 func WatchLog(ctx context.Context, fp string, callback WatchLogFunc) error {
+	return WatchLogWithOpts(ctx, fp, callback, WatchLogOpts{})
+}
+
+// WatchLogWithOpts is the same as WatchLog but allows for configuring how the log is tailed. The log is reopened if
+// it's rotated or truncated. The tailer is stopped once the context is done.
+func WatchLogWithOpts(ctx context.Context, fp string, callback WatchLogFunc, opts WatchLogOpts) error {
+	var offsets *offsetTracker
+	var location *tail.SeekInfo
+	start := logOffset{}
+	if opts.OffsetFile != "" {
+		start = loadLogOffset(opts.OffsetFile, fp)
+		offsets = &offsetTracker{OffsetFile: opts.OffsetFile, LogFile: fp, saved: start, current: start}
+		if start.Offset > 0 {
+			logrus.WithField("log", fp).WithField("offset", start.Offset).Debug("Resuming log from saved offset.")
+			location = &tail.SeekInfo{Offset: start.Offset, Whence: io.SeekStart}
+		}
+	}
+
+	poll := opts.Backend == WatchBackendPoll || opts.Backend == WatchBackendAuto && !notifySupported(filepath.Dir(fp))
 	tailer, err := tail.TailFile(fp, tail.Config{
-		Follow: true,
-		Logger: logrus.StandardLogger(),
+		Location: location,
+		Follow:   true,
+		ReOpen:   true,
+		Poll:     poll,
+		Logger:   logrus.StandardLogger(),
 	})
 	if err != nil {
 		return err
 	}
 
+	offsetInterval := opts.OffsetInterval
+	if offsetInterval <= 0 {
+		offsetInterval = DefaultOffsetInterval
+	}
+
 	go func() {
+		lastNum := 0
+		ticker := time.NewTicker(offsetInterval)
+		defer func() {
+			ticker.Stop()
+			if offsets != nil {
+				offsets.Save()
+			}
+			_ = tailer.Stop()
+			tailer.Cleanup()
+		}()
 		for {
 			select {
 			case <-ctx.Done():
 				err := ctx.Err()
 				logrus.WithError(err).WithField("log", fp).Info("Stopping log watcher.")
 				return
-			case line := <-tailer.Lines:
+			case <-ticker.C:
+				if offsets != nil {
+					offsets.Save()
+				}
+			case line, ok := <-tailer.Lines:
+				if !ok {
+					logrus.WithError(tailer.Err()).WithField("log", fp).Error("Log watcher exited.")
+					return
+				}
+
+				if line.Err != nil {
+					logrus.WithError(line.Err).WithField("log", fp).Warn("Failed to read log line.")
+					continue
+				}
+
+				// The tailer restarts its line numbers once it reopens the log e.g. after it was rotated. The lines of
+				// the new log are numbered from the start and its offset replaces the resumed one.
+				reopened := line.Num <= lastNum
+				if reopened {
+					start = logOffset{}
+				}
+				if offsets != nil && (reopened || lastNum == 0) {
+					offsets.Opened(statInode(fp))
+				}
+				lastNum = line.Num
+
 				callback(LogLine{
 					Text: line.Text,
-					Num:  line.Num,
+					Num:  start.Line + line.Num,
 				})
+
+				if offsets != nil {
+					offsets.Set(line.SeekInfo.Offset, start.Line+line.Num)
+				}
 			}
 		}
 	}()
@@ -110,46 +223,204 @@ func WatchLog(ctx context.Context, fp string, callback WatchLogFunc) error {
 }
 
 func ExecuteLogReader(ctx context.Context, reader io.Reader, store variable.Store, appClient app.AppServiceClient, rx []*reaction.LogReaction, opts ExecuteLogOpts) (context.Context, error) {
-	matchers, err := CompileLogReactions(rx...)
+	callback, grouper, err := logReactionFunc(ctx, store, appClient, rx, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	watchCtx := Watch(ctx, reader, func(ll LogLine) {
-		err := ReactToLog(ll, store, appClient, matchers, opts)
-		if err != nil {
-			logrus.WithError(err).Error("Failed to execute log action.")
+	watchCtx := Watch(ctx, reader, callback)
+	if grouper == nil {
+		return watchCtx, nil
+	}
+
+	// Once the reader is done, its pending event is reacted to before the returned context is done rather than after
+	// the flush timeout.
+	out, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	go func() {
+		<-watchCtx.Done()
+		if ctx.Err() == nil {
+			grouper.Flush()
 		}
-	})
-	return watchCtx, nil
+		cancel(context.Cause(watchCtx))
+	}()
+	return out, nil
 }
 
 func ExecuteLog(ctx context.Context, logPath string, store variable.Store, appClient app.AppServiceClient, rx []*reaction.LogReaction, opts ExecuteLogOpts) error {
-	matchers, err := CompileLogReactions(rx...)
+	callback, _, err := logReactionFunc(ctx, store, appClient, rx, opts)
 	if err != nil {
 		return err
 	}
 
-	return WatchLog(ctx, logPath, func(ll LogLine) {
-		err := ReactToLog(ll, store, appClient, matchers, opts)
+	return WatchLogWithOpts(ctx, logPath, callback, opts.Tail)
+}
+
+// logReactionFunc reacts to every line. If the lines are grouped, the grouper is also returned.
+func logReactionFunc(ctx context.Context, store variable.Store, appClient app.AppServiceClient, rx []*reaction.LogReaction, opts ExecuteLogOpts) (WatchLogFunc, *lineGrouper, error) {
+	matchers, err := CompileLogReactions(rx...)
+	if err != nil {
+		return nil, nil, err
+	}
+	matchers = append(matchers, opts.Reactions...)
+
+	reactor := NewLogReactor(ctx, store, appClient, matchers, opts)
+	var callback WatchLogFunc = func(ll LogLine) {
+		err := reactor.React(ll)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to execute log action.")
 		}
-	})
+	}
+
+	if opts.Group.enabled() {
+		g, err := newLineGrouper(ctx, reactor.Opts.Clock, opts.Group, callback)
+		if err != nil {
+			return nil, nil, err
+		}
+		return g.Add, g, nil
+	}
+
+	return callback, nil, nil
 }
 
+// ReactToLog reacts to a single line on its own. The limits and condition state of the reactions only apply to this
+// line e.g. a trailing fire is still deferred but a Count never reaches past one. Use a LogReactor to react across
+// lines.
 func ReactToLog(l LogLine, store variable.Store, appClient app.AppServiceClient, rx []*CompiledLogReaction, opts ExecuteLogOpts) error {
-	if opts.Watcher != nil {
-		opts.Watcher(l)
+	return NewLogReactor(context.Background(), store, appClient, rx, opts).React(l)
+}
+
+// LogReactor reacts to every line of a single log. Each reactor has its own Limiter and clone of the Condition for each
+// reaction so logs and runs never share limits or condition state. Once the context is done, every Limiter is stopped so deferred fires are dropped.
+type LogReactor struct {
+	Ctx       context.Context
+	Store     variable.Store
+	AppClient app.AppServiceClient
+	Reactions []*CompiledLogReaction
+	Opts      ExecuteLogOpts
+
+	lock     sync.Mutex
+	limiters map[*CompiledLogReaction]*Limiter
+
+	// The reactor's own copy of each reaction's Condition so its state isn't shared with other logs.
+	conditions map[*CompiledLogReaction]LogCondition
+}
+
+func NewLogReactor(ctx context.Context, store variable.Store, appClient app.AppServiceClient, rx []*CompiledLogReaction, opts ExecuteLogOpts) *LogReactor {
+	opts.Clock = clockOrReal(opts.Clock)
+	out := &LogReactor{
+		Ctx:       ctx,
+		Store:     store,
+		AppClient: appClient,
+		Reactions: rx,
+		Opts:      opts,
+		limiters:  make(map[*CompiledLogReaction]*Limiter, len(rx)),
+
+		conditions: make(map[*CompiledLogReaction]LogCondition, len(rx)),
 	}
 
-	matches := AllMatches(l.Text, rx...)
+	for _, v := range rx {
+		if v.Limit.enabled() {
+			out.limiters[v] = NewLimiterWithClock(v.Limit, opts.Clock)
+		}
+		if v.Condition != nil {
+			out.conditions[v] = CloneLogCondition(v.Condition)
+		}
+	}
+
+	context.AfterFunc(ctx, out.Stop)
+	return out
+}
+
+// Limiter is the Limiter of the reaction within the reactor. If the reaction isn't limited, nil is returned.
+func (r *LogReactor) Limiter(rx *CompiledLogReaction) *Limiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.limiters[rx]
+}
+
+// Stop stops every Limiter so deferred fires are dropped.
+func (r *LogReactor) Stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, v := range r.limiters {
+		v.Stop()
+	}
+}
+
+// React reacts to the line as if it was logged now.
+func (r *LogReactor) React(l LogLine) error {
+	if r.Opts.Watcher != nil {
+		r.Opts.Watcher(l)
+	}
+
+	now := r.Opts.Clock.Now()
+	matches := allMatchesAt(l.Text, now, func(rx *CompiledLogReaction) LogCondition {
+		return r.conditions[rx]
+	}, r.Reactions...)
 	if len(matches) == 0 {
 		return nil
 	}
 
 	for _, match := range matches {
-		err := ExecuteLogActions(l.Text, appClient, store, match.RegexMatches, opts, match.Reaction.Then...)
+		match := match
+		fire := func() error {
+			return executeLogMatch(r.Ctx, l, r.Store, r.AppClient, match, r.Opts)
+		}
+
+		limiter := r.Limiter(match.Reaction)
+		if limiter == nil {
+			err := fire()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var onSuppress func()
+		if r.Opts.OnSuppress != nil {
+			onSuppress = func() {
+				r.Opts.OnSuppress(l, match)
+			}
+		}
+
+		err := limiter.Fire(now, fire, onSuppress)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func executeLogMatch(ctx context.Context, l LogLine, store variable.Store, appClient app.AppServiceClient, match *LogMatch, opts ExecuteLogOpts) error {
+	if opts.OnMatch != nil {
+		opts.OnMatch(l, match)
+	}
+
+	// Later entries take precedence so the order is fields, named groups, then the line and matches.
+	entries := append(variable.LogNamedGroupEntries(match.Names, match.RegexMatches), logTemplateEntries(l.Text, match.RegexMatches)...)
+	if match.Reaction.Format != LogFormatText {
+		line := match.Line
+		if line == nil {
+			line = NewDecodedLine(l.Text)
+		}
+
+		fields, err := line.Fields(match.Reaction.Format)
+		if err != nil {
+			logrus.WithError(err).WithField("format", match.Reaction.Format.String()).Debug("Failed to decode log line fields.")
+		} else {
+			entries = append(FieldEntries(fields), entries...)
+		}
+	}
+
+	entries = variable.CoerceEntries(match.Reaction.Types, entries...)
+
+	err := executeLogActions(l.Text, appClient, store, match.RegexMatches, entries, opts, match.Reaction.Then...)
+	if err != nil {
+		return err
+	}
+
+	for _, act := range match.Reaction.Actions {
+		err = ExecuteAction(ctx, store, act, opts.Actions, entries...)
 		if err != nil {
 			return err
 		}
@@ -160,6 +431,28 @@ func ReactToLog(l LogLine, store variable.Store, appClient app.AppServiceClient,
 type CompiledLogReaction struct {
 	When []*CompiledLogCondition
 	Then []*reaction.LogReactionAction
+
+	// When set, the reaction is executed whenever the Condition is met rather than whenever any of When match. Each
+	// LogReactor checks its own clone of the Condition so a reaction can be shared between logs.
+	Condition LogCondition
+
+	// Executed after Then with the line, matches and first_match available to their templates.
+	Actions []*Action
+
+	// When set, every field of the line is also available to the templates of Then and Actions. The line, matches and
+	// first_match take precedence over fields with the same name.
+	//
+	// Named groups e.g. (?P<player>\w+) are also available to the templates by name and within the groups map e.g.
+	// {{groups.player}}. Named groups take precedence over fields and store variables with the same name but not over
+	// the line, matches and first_match. Use groups when a name may collide.
+	Format LogFormat
+
+	// Limits how often the reaction fires. The limits are enforced by each LogReactor separately.
+	Limit LimitOpts
+
+	// Converts the named groups and fields with the same name to the type so templates can compare them and do math
+	// e.g. {"players": variable.TypeInt} for (?P<players>\d+). Values that can't be converted are kept as strings.
+	Types map[string]variable.Type
 }
 
 type CompiledLogCondition struct {
@@ -178,17 +471,51 @@ func (c *CompiledLogCondition) Matches(line string) []string {
 type LogMatch struct {
 	Reaction     *CompiledLogReaction
 	RegexMatches []string
+
+	// The names of the groups within the RegexMatches in the same order. Unnamed groups are empty.
+	Names []string
+
+	// The line that was matched. Its fields are shared with the conditions that matched it.
+	Line *DecodedLine
 }
 
 func AllMatches(line string, reactions ...*CompiledLogReaction) []*LogMatch {
+	return AllMatchesAt(line, time.Now(), reactions...)
+}
+
+// AllMatchesAt is the same as AllMatches but for a line that was logged at the time. The Condition of each reaction is
+// checked directly so its state is updated. Use a LogReactor for reactions that are shared between logs.
+func AllMatchesAt(line string, now time.Time, reactions ...*CompiledLogReaction) []*LogMatch {
+	return allMatchesAt(line, now, func(rx *CompiledLogReaction) LogCondition {
+		return rx.Condition
+	}, reactions...)
+}
+
+// allMatchesAt matches the line against the reactions. The conditionOf is the Condition checked for the reaction.
+func allMatchesAt(line string, now time.Time, conditionOf func(rx *CompiledLogReaction) LogCondition, reactions ...*CompiledLogReaction) []*LogMatch {
+	decoded := NewDecodedLine(line)
 	matches := make([]*LogMatch, 0, len(reactions))
 	for i, r := range reactions {
+		if cond := conditionOf(r); cond != nil {
+			if out := MatchLine(cond, decoded, now); len(out) > 0 {
+				matches = append(matches, &LogMatch{
+					Reaction:     reactions[i],
+					RegexMatches: out,
+					Names:        SubexpNames(cond),
+					Line:         decoded,
+				})
+			}
+			continue
+		}
+
 		for _, v := range r.When {
 			out := v.Matches(line)
 			if len(out) > 0 {
 				matches = append(matches, &LogMatch{
 					Reaction:     reactions[i],
 					RegexMatches: out,
+					Names:        v.SubexpNames(),
+					Line:         decoded,
 				})
 			}
 		}
@@ -201,6 +528,14 @@ func ExecuteLogActions(line string, appClient app.AppServiceClient, store variab
 		return nil
 	}
 
+	return executeLogActions(line, appClient, store, m, logTemplateEntries(line, m), opts, a...)
+}
+
+func executeLogActions(line string, appClient app.AppServiceClient, store variable.Store, m []string, entries []*variable.Entry, opts ExecuteLogOpts, a ...*reaction.LogReactionAction) error {
+	if len(m) == 0 {
+		return nil
+	}
+
 	for _, act := range a {
 		logrus.
 			WithField("variable_store", store.String()).
@@ -209,14 +544,7 @@ func ExecuteLogActions(line string, appClient app.AppServiceClient, store variab
 			WithField("matches", m).
 			Debug("Executing log action.")
 		if v := act.GetSetVariable(); v != nil {
-			if len(m) > 1 {
-				m = m[1:]
-			}
-			err := diazoactions.SetVariable(appClient, store, v, variable.LogReactionTemplateDataEntries(&reaction.LogReactionTemplateData{
-				Line:       line,
-				Matches:    m,
-				FirstMatch: m[0],
-			})...)
+			err := diazoactions.SetVariable(appClient, store, v, entries...)
 			if err != nil {
 				return err
 			}
@@ -231,6 +559,20 @@ func ExecuteLogActions(line string, appClient app.AppServiceClient, store variab
 	return nil
 }
 
+// logTemplateEntries are the template entries for the regex matches of the line. If there are groups, the full match is
+// dropped so matches.0 is the first group.
+func logTemplateEntries(line string, m []string) []*variable.Entry {
+	if len(m) > 1 {
+		m = m[1:]
+	}
+
+	return variable.LogReactionTemplateDataEntries(&reaction.LogReactionTemplateData{
+		Line:       line,
+		Matches:    m,
+		FirstMatch: m[0],
+	})
+}
+
 func CompileLogReactions(reactions ...*reaction.LogReaction) ([]*CompiledLogReaction, error) {
 	out := make([]*CompiledLogReaction, 0, len(reactions))
 	for _, v := range reactions {
@@ -263,7 +605,8 @@ func CompileLogConditions(conds ...*reaction.LogReactionCondition) ([]*CompiledL
 	return out, nil
 }
 
-// ReadyCheckToLogReaction maintains backwards compatibility with the old ready check system and the new one.
+// ReadyCheckToLogReaction maintains backwards compatibility with the old ready check system and the new one. A Probe
+// can be used instead when the log is unreliable.
 func ReadyCheckToLogReaction(rc *blueprint.ReadyCheck) *reaction.LogReaction {
 	return &reaction.LogReaction{
 		When: []*reaction.LogReactionCondition{
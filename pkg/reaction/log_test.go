@@ -0,0 +1,252 @@
+package reaction
+
+import (
+	"context"
+	"github.com/bxcodec/faker/v3"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type LogTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (l *LogTestSuite) BeforeTest(_, _ string) {
+	l.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(l.Dir, os.ModePerm)
+}
+
+func (l *LogTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(l.Dir)
+}
+
+func (l *LogTestSuite) TestWatchLogRotated() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	_ = os.WriteFile(fp, []byte("first\n"), os.ModePerm)
+	lines := make(chan LogLine, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	err := WatchLog(ctx, fp, func(ll LogLine) {
+		lines <- ll
+	})
+	if !l.NoError(err) {
+		return
+	}
+	l.Equal("first", l.next(lines).Text)
+	l.waitForEOF()
+	_ = os.Rename(fp, filepath.Join(l.Dir, "latest.log.1"))
+	_ = os.WriteFile(fp, []byte("second\n"), os.ModePerm)
+
+	// -- Then
+	//
+	l.Equal("second", l.next(lines).Text)
+}
+
+func (l *LogTestSuite) TestWatchLogTruncated() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	_ = os.WriteFile(fp, []byte("a long first line\n"), os.ModePerm)
+	lines := make(chan LogLine, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	err := WatchLog(ctx, fp, func(ll LogLine) {
+		lines <- ll
+	})
+	if !l.NoError(err) {
+		return
+	}
+	l.Equal("a long first line", l.next(lines).Text)
+	l.waitForEOF()
+	_ = os.WriteFile(fp, []byte("short\n"), os.ModePerm)
+
+	// -- Then
+	//
+	l.Equal("short", l.next(lines).Text)
+}
+
+func (l *LogTestSuite) TestWatchLogStopped() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	f, _ := os.Create(fp)
+	defer f.Close()
+	lines := make(chan LogLine, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// -- When
+	//
+	err := WatchLog(ctx, fp, func(ll LogLine) {
+		lines <- ll
+	})
+	cancel()
+	if !l.NoError(err) {
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+	_, _ = f.WriteString("ignored\n")
+
+	// -- Then
+	//
+	select {
+	case ll := <-lines:
+		l.Fail("unexpected line", ll.Text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (l *LogTestSuite) TestWatchLogOffset() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	opts := WatchLogOpts{OffsetFile: filepath.Join(l.Dir, "offsets", "latest.json"), OffsetInterval: 10 * time.Millisecond}
+	f, _ := os.Create(fp)
+	defer f.Close()
+	_, _ = f.WriteString("one\ntwo\n")
+	lines := make(chan LogLine, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := WatchLogWithOpts(ctx, fp, func(ll LogLine) {
+		lines <- ll
+	}, opts)
+	if !l.NoError(err) {
+		cancel()
+		return
+	}
+	l.Equal("one", l.next(lines).Text)
+	l.Equal("two", l.next(lines).Text)
+	cancel()
+	l.Eventually(func() bool {
+		return loadLogOffset(opts.OffsetFile, fp).Line == 2
+	}, time.Second, 10*time.Millisecond)
+	_, _ = f.WriteString("three\n")
+
+	// -- When
+	//
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	err = WatchLogWithOpts(ctx, fp, func(ll LogLine) {
+		lines <- ll
+	}, opts)
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		l.Equal(LogLine{Text: "three", Num: 3}, l.next(lines))
+	}
+}
+
+func (l *LogTestSuite) TestLoadLogOffsetReplaced() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	offsetFile := filepath.Join(l.Dir, "latest.json")
+	_ = os.WriteFile(fp, []byte("one\n"), os.ModePerm)
+	info, _ := os.Stat(fp)
+	_ = saveLogOffset(offsetFile, logOffset{Inode: fileInode(info), Offset: 4, Line: 1})
+	saved := loadLogOffset(offsetFile, fp)
+
+	// -- When
+	//
+	_ = os.Rename(fp, filepath.Join(l.Dir, "latest.log.1"))
+	_ = os.WriteFile(fp, []byte("two\n"), os.ModePerm)
+	actual := loadLogOffset(offsetFile, fp)
+
+	// -- Then
+	//
+	l.Equal(logOffset{Inode: fileInode(info), Offset: 4, Line: 1}, saved)
+	l.Equal(logOffset{}, actual)
+}
+
+func (l *LogTestSuite) TestWatchLogOffsetRotated() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	opts := WatchLogOpts{OffsetFile: filepath.Join(l.Dir, "latest.json"), OffsetInterval: 10 * time.Millisecond}
+	_ = os.WriteFile(fp, []byte("one\ntwo\n"), os.ModePerm)
+	old, _ := os.Stat(fp)
+	_ = saveLogOffset(opts.OffsetFile, logOffset{Inode: fileInode(old), Offset: 4, Line: 1})
+	lines := make(chan LogLine, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// -- When
+	//
+	err := WatchLogWithOpts(ctx, fp, func(ll LogLine) {
+		lines <- ll
+	}, opts)
+	if !l.NoError(err) {
+		cancel()
+		return
+	}
+	resumed := l.next(lines)
+	l.Eventually(func() bool {
+		return loadLogOffset(opts.OffsetFile, fp).Line == 2
+	}, time.Second, 5*time.Millisecond)
+	l.waitForEOF()
+	_ = os.Rename(fp, filepath.Join(l.Dir, "latest.log.1"))
+	_ = os.WriteFile(fp, []byte("three\n"), os.ModePerm)
+	rotated := l.next(lines)
+	current, _ := os.Stat(fp)
+	l.Eventually(func() bool {
+		return loadLogOffset(opts.OffsetFile, fp).Inode == fileInode(current)
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+
+	// -- Then
+	//
+	l.Equal(LogLine{Text: "two", Num: 2}, resumed)
+	l.Equal(LogLine{Text: "three", Num: 1}, rotated)
+	l.Equal(1, loadLogOffset(opts.OffsetFile, fp).Line)
+}
+
+func (l *LogTestSuite) TestOffsetTrackerRotated() {
+	// -- Given
+	//
+	fp := filepath.Join(l.Dir, "latest.log")
+	_ = os.WriteFile(fp, []byte("one\ntwo\n"), os.ModePerm)
+	given := &offsetTracker{OffsetFile: filepath.Join(l.Dir, "latest.json"), LogFile: fp}
+	given.Opened(statInode(fp))
+	given.Set(8, 2)
+
+	// -- When
+	//
+	_ = os.Rename(fp, filepath.Join(l.Dir, "latest.log.1"))
+	_ = os.WriteFile(fp, []byte("three\nfour\nfive\n"), os.ModePerm)
+	given.Save()
+
+	// -- Then
+	//
+	l.Equal(logOffset{}, loadLogOffset(given.OffsetFile, fp))
+}
+
+// waitForEOF gives the tailer time to reach the end of the log. Changes are only watched for once it does.
+func (l *LogTestSuite) waitForEOF() {
+	time.Sleep(50 * time.Millisecond)
+}
+
+func (l *LogTestSuite) next(lines chan LogLine) LogLine {
+	select {
+	case ll := <-lines:
+		return ll
+	case <-time.After(2 * time.Second):
+		l.Fail("timed out waiting for log line")
+		return LogLine{}
+	}
+}
+
+func TestLogTestSuite(t *testing.T) {
+	suite.Run(t, new(LogTestSuite))
+}
@@ -0,0 +1,345 @@
+package reaction
+
+import (
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogCondition is a condition that's checked against every log line in order. Conditions may keep state between
+// lines e.g. to count matches so every line must be passed to Match. Conditions are not safe for concurrent use. A
+// condition with state implements StatefulLogCondition so each log it's checked against gets its own copy e.g. by a
+// LogReactor.
+type LogCondition interface {
+	// Match checks the line that was logged at the time. If the condition is met, the regex matches that met it are
+	// returned with the full match first followed by any groups. Otherwise, nil is returned.
+	Match(line string, now time.Time) []string
+}
+
+// NamedLogCondition is a LogCondition that knows the names of the regex groups within its matches e.g.
+// (?P<player>\w+).
+type NamedLogCondition interface {
+	LogCondition
+
+	// SubexpNames are the names of the groups within the matches last returned by Match in the same order. Unnamed
+	// groups are empty.
+	SubexpNames() []string
+}
+
+// StatefulLogCondition is a LogCondition that keeps state between lines e.g. Count.
+type StatefulLogCondition interface {
+	LogCondition
+
+	// Clone is a copy of the condition, and of every condition it wraps, without any state.
+	Clone() LogCondition
+}
+
+// CloneLogCondition is a copy of the condition without any state. Conditions without state are returned as-is.
+func CloneLogCondition(cond LogCondition) LogCondition {
+	if v, ok := cond.(StatefulLogCondition); ok {
+		return v.Clone()
+	}
+	return cond
+}
+
+// SubexpNames are the names of the groups within the matches last returned by the condition. If the condition is not a
+// NamedLogCondition, nil is returned.
+func SubexpNames(cond LogCondition) []string {
+	if v, ok := cond.(NamedLogCondition); ok {
+		return v.SubexpNames()
+	}
+	return nil
+}
+
+// LineLogCondition is a LogCondition that shares the decoded fields of the line with the other conditions checking
+// it so each line is decoded at most once per format.
+type LineLogCondition interface {
+	LogCondition
+
+	// MatchLine is the same as Match but for a line whose fields may already be decoded.
+	MatchLine(line *DecodedLine, now time.Time) []string
+}
+
+// MatchLine checks the line against the condition. The decoded fields of the line are shared if the condition is a
+// LineLogCondition.
+func MatchLine(cond LogCondition, line *DecodedLine, now time.Time) []string {
+	if v, ok := cond.(LineLogCondition); ok {
+		return v.MatchLine(line, now)
+	}
+	return cond.Match(line.Text, now)
+}
+
+// lineConditionFunc adapts a func into a LineLogCondition.
+type lineConditionFunc func(line *DecodedLine, now time.Time) []string
+
+func (l lineConditionFunc) Match(line string, now time.Time) []string {
+	return l(NewDecodedLine(line), now)
+}
+
+func (l lineConditionFunc) MatchLine(line *DecodedLine, now time.Time) []string {
+	return l(line, now)
+}
+
+// namedCondition is a lineConditionFunc whose group names come from the conditions it wraps.
+type namedCondition struct {
+	lineConditionFunc
+	Names func() []string
+
+	// Creates a copy of the condition without any state.
+	New func() LogCondition
+}
+
+func (n *namedCondition) SubexpNames() []string {
+	if n.Names == nil {
+		return nil
+	}
+	return n.Names()
+}
+
+func (n *namedCondition) Clone() LogCondition {
+	return n.New()
+}
+
+// LogConditionFunc adapts a func into a stateless LogCondition.
+type LogConditionFunc func(line string, now time.Time) []string
+
+func (l LogConditionFunc) Match(line string, now time.Time) []string {
+	return l(line, now)
+}
+
+// Regex is met by every line matching the regex.
+func Regex(expr string) (*CompiledLogCondition, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompiledLogCondition{
+		Regex: re,
+		Cond:  &reaction.LogReactionCondition{Matches: &reaction.LogMatcher{Regex: expr}},
+	}, nil
+}
+
+func (c *CompiledLogCondition) Match(line string, _ time.Time) []string {
+	return c.Matches(line)
+}
+
+func (c *CompiledLogCondition) SubexpNames() []string {
+	if c.Regex == nil {
+		return nil
+	}
+	return c.Regex.SubexpNames()
+}
+
+// And is met when every condition is met by the same line. The matches of the first condition are returned.
+func And(conds ...LogCondition) LogCondition {
+	return &namedCondition{Names: namesOf(condAt(conds, 0)), New: func() LogCondition {
+		return And(cloneAll(conds)...)
+	}, lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+		var out []string
+		met := len(conds) > 0
+		for i, v := range all(conds, line, now) {
+			if len(v) == 0 {
+				met = false
+			} else if i == 0 {
+				out = v
+			}
+		}
+
+		if !met {
+			return nil
+		}
+		return out
+	}}
+}
+
+// Or is met when any condition is met. The matches of the first condition that's met are returned.
+func Or(conds ...LogCondition) LogCondition {
+	var names []string
+	return &namedCondition{
+		Names: func() []string {
+			return names
+		},
+		New: func() LogCondition {
+			return Or(cloneAll(conds)...)
+		},
+		lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+			var out []string
+			for i, v := range all(conds, line, now) {
+				if out == nil && len(v) > 0 {
+					out = v
+					names = SubexpNames(conds[i])
+				}
+			}
+			return out
+		},
+	}
+}
+
+// Not is met for every line that doesn't meet the condition. The whole line is returned as the match.
+func Not(cond LogCondition) LogCondition {
+	return &namedCondition{New: func() LogCondition {
+		return Not(CloneLogCondition(cond))
+	}, lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+		if len(MatchLine(cond, line, now)) > 0 {
+			return nil
+		}
+		return []string{strings.TrimRight(line.Text, "\r\n")}
+	}}
+}
+
+// Seen is met for as long as the condition was met within the window, including by the current line. If the window is
+// zero, Seen is met forever once the condition has been met. The most recent matches of the condition are returned.
+//
+// For example, to match X unless Y has been logged: And(X, Not(Seen(Y, 0))).
+func Seen(cond LogCondition, within time.Duration) LogCondition {
+	var last []string
+	var names []string
+	var at time.Time
+	return &namedCondition{
+		Names: func() []string {
+			return names
+		},
+		New: func() LogCondition {
+			return Seen(CloneLogCondition(cond), within)
+		},
+		lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+			if m := MatchLine(cond, line, now); len(m) > 0 {
+				last = m
+				names = SubexpNames(cond)
+				at = now
+			}
+
+			if last == nil || within > 0 && now.Sub(at) > within {
+				return nil
+			}
+			return last
+		},
+	}
+}
+
+// Sequence is met once each of the conditions has been met in order, one after the other, within the window of the
+// first condition being met. If the window is zero, there is no time limit. The matches of the last condition are
+// returned. The sequence starts over once it's met.
+func Sequence(within time.Duration, conds ...LogCondition) LogCondition {
+	step := 0
+	var started time.Time
+	return &namedCondition{Names: namesOf(condAt(conds, len(conds)-1)), New: func() LogCondition {
+		return Sequence(within, cloneAll(conds)...)
+	}, lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+		if len(conds) == 0 {
+			return nil
+		}
+
+		results := all(conds, line, now)
+		if step > 0 && within > 0 && now.Sub(started) > within {
+			step = 0
+		}
+
+		// The sequence can always restart from the first condition e.g. if the window expired.
+		if step > 0 && len(results[step]) == 0 && len(results[0]) > 0 {
+			step = 0
+		}
+
+		if len(results[step]) == 0 {
+			return nil
+		}
+
+		if step == 0 {
+			started = now
+		}
+
+		step++
+		if step < len(conds) {
+			return nil
+		}
+
+		step = 0
+		return results[len(conds)-1]
+	}}
+}
+
+// Count is met every n-th time the condition is met. The matches of the n-th time are returned.
+func Count(cond LogCondition, n int) LogCondition {
+	count := 0
+	return &namedCondition{Names: namesOf(cond), New: func() LogCondition {
+		return Count(CloneLogCondition(cond), n)
+	}, lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+		m := MatchLine(cond, line, now)
+		if len(m) == 0 {
+			return nil
+		}
+
+		count++
+		if count < n {
+			return nil
+		}
+
+		count = 0
+		return m
+	}}
+}
+
+// Rate is met once the condition has been met n times within the window e.g. ERROR logged 5 times within a minute.
+// The count starts over once it's met. The matches of the n-th time are returned.
+func Rate(cond LogCondition, n int, within time.Duration) LogCondition {
+	times := make([]time.Time, 0, n)
+	return &namedCondition{Names: namesOf(cond), New: func() LogCondition {
+		return Rate(CloneLogCondition(cond), n, within)
+	}, lineConditionFunc: func(line *DecodedLine, now time.Time) []string {
+		m := MatchLine(cond, line, now)
+		if len(m) == 0 {
+			return nil
+		}
+
+		cutoff := now.Add(-within)
+		kept := times[:0]
+		for _, v := range times {
+			if v.After(cutoff) {
+				kept = append(kept, v)
+			}
+		}
+		times = append(kept, now)
+
+		if len(times) < n {
+			return nil
+		}
+
+		times = times[:0]
+		return m
+	}}
+}
+
+// namesOf are the group names of the condition's last matches.
+func namesOf(cond LogCondition) func() []string {
+	return func() []string {
+		return SubexpNames(cond)
+	}
+}
+
+// cloneAll clones every condition.
+func cloneAll(conds []LogCondition) []LogCondition {
+	out := make([]LogCondition, 0, len(conds))
+	for _, v := range conds {
+		out = append(out, CloneLogCondition(v))
+	}
+	return out
+}
+
+// condAt is the condition at the index or nil if it's out of range.
+func condAt(conds []LogCondition, i int) LogCondition {
+	if i < 0 || i >= len(conds) {
+		return nil
+	}
+	return conds[i]
+}
+
+// all checks every condition against the line so each can update its state.
+func all(conds []LogCondition, line *DecodedLine, now time.Time) [][]string {
+	out := make([][]string, len(conds))
+	for i, v := range conds {
+		out[i] = MatchLine(v, line, now)
+	}
+	return out
+}
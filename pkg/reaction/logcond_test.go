@@ -0,0 +1,359 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+type LogConditionTestSuite struct {
+	suite.Suite
+
+	Now time.Time
+}
+
+func (l *LogConditionTestSuite) BeforeTest(_, _ string) {
+	l.Now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (l *LogConditionTestSuite) TestAnd() {
+	// -- Given
+	//
+	given := And(l.regex(`player (\w+)`), l.regex(`joined`))
+
+	// -- When
+	//
+	joined := given.Match("player steve joined", l.Now)
+	left := given.Match("player steve left", l.Now)
+
+	// -- Then
+	//
+	l.Equal([]string{"player steve", "steve"}, joined)
+	l.Nil(left)
+}
+
+func (l *LogConditionTestSuite) TestOr() {
+	// -- Given
+	//
+	given := Or(l.regex(`ERROR`), l.regex(`FATAL`))
+
+	// -- When
+	//
+	fatal := given.Match("FATAL out of memory", l.Now)
+	info := given.Match("INFO saved", l.Now)
+
+	// -- Then
+	//
+	l.Equal([]string{"FATAL"}, fatal)
+	l.Nil(info)
+}
+
+func (l *LogConditionTestSuite) TestNotSeen() {
+	// -- Given
+	//
+	given := And(l.regex(`Stopping`), Not(Seen(l.regex(`Restart requested`), 0)))
+
+	// -- When
+	//
+	crashed := given.Match("Stopping server", l.Now)
+	requested := given.Match("Restart requested", l.Now)
+	restarted := given.Match("Stopping server\n", l.Now)
+
+	// -- Then
+	//
+	l.Equal([]string{"Stopping"}, crashed)
+	l.Nil(requested)
+	l.Nil(restarted)
+}
+
+func (l *LogConditionTestSuite) TestSeenWithin() {
+	// -- Given
+	//
+	given := Seen(l.regex(`saving`), time.Minute)
+
+	// -- When
+	//
+	seen := given.Match("saving", l.Now)
+	stillSeen := given.Match("other", l.Now.Add(time.Minute))
+	expired := given.Match("other", l.Now.Add(time.Minute+time.Second))
+
+	// -- Then
+	//
+	l.Equal([]string{"saving"}, seen)
+	l.Equal([]string{"saving"}, stillSeen)
+	l.Nil(expired)
+}
+
+func (l *LogConditionTestSuite) TestSequence() {
+	// -- Given
+	//
+	given := Sequence(10*time.Second, l.regex(`Saving`), l.regex(`Saved (\w+)`))
+
+	// -- When
+	//
+	actual := [][]string{
+		given.Match("Saved early", l.Now),
+		given.Match("Saving", l.Now),
+		given.Match("Other", l.Now.Add(time.Second)),
+		given.Match("Saved world", l.Now.Add(2*time.Second)),
+		given.Match("Saving", l.Now.Add(3*time.Second)),
+		given.Match("Saved late", l.Now.Add(14*time.Second)),
+	}
+
+	// -- Then
+	//
+	l.Equal([][]string{nil, nil, nil, {"Saved world", "world"}, nil, nil}, actual)
+}
+
+func (l *LogConditionTestSuite) TestSequenceRestarts() {
+	// -- Given
+	//
+	given := Sequence(10*time.Second, l.regex(`A`), l.regex(`B`))
+
+	// -- When
+	//
+	first := given.Match("A", l.Now)
+	restarted := given.Match("A", l.Now.Add(9*time.Second))
+	actual := given.Match("B", l.Now.Add(15*time.Second))
+
+	// -- Then
+	//
+	l.Nil(first)
+	l.Nil(restarted)
+	l.Equal([]string{"B"}, actual)
+}
+
+func (l *LogConditionTestSuite) TestCount() {
+	// -- Given
+	//
+	given := Count(l.regex(`joined`), 2)
+
+	// -- When
+	//
+	actual := [][]string{
+		given.Match("joined", l.Now),
+		given.Match("joined", l.Now),
+		given.Match("joined", l.Now),
+		given.Match("joined", l.Now),
+	}
+
+	// -- Then
+	//
+	l.Equal([][]string{nil, {"joined"}, nil, {"joined"}}, actual)
+}
+
+func (l *LogConditionTestSuite) TestRate() {
+	// -- Given
+	//
+	given := Rate(l.regex(`ERROR`), 3, time.Minute)
+
+	// -- When
+	//
+	actual := [][]string{
+		given.Match("ERROR", l.Now),
+		given.Match("ERROR", l.Now.Add(30*time.Second)),
+		given.Match("ERROR", l.Now.Add(61*time.Second)),
+		given.Match("INFO", l.Now.Add(62*time.Second)),
+		given.Match("ERROR", l.Now.Add(63*time.Second)),
+		given.Match("ERROR", l.Now.Add(64*time.Second)),
+	}
+
+	// -- Then
+	//
+	l.Equal([][]string{nil, nil, nil, nil, {"ERROR"}, nil}, actual)
+}
+
+func (l *LogConditionTestSuite) TestExecuteLogReaderCondition() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	reader := strings.NewReader("ERROR a\nERROR b\nINFO c\nERROR d\n")
+	given := &CompiledLogReaction{
+		Condition: Count(l.regex(`ERROR (\w)`), 3),
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "last_error", Value: "{{first_match}}"}},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, nil, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+	})
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		<-c.Done()
+		l.Equal("d", store.GetStringValue("last_error"))
+	}
+}
+
+func (l *LogConditionTestSuite) TestSubexpNames() {
+	// -- Given
+	//
+	joined := l.regex(`(?P<player>\w+) joined`)
+	left := l.regex(`(?P<player>\w+) left (?P<world>\w+)`)
+	given := Or(joined, Count(left, 1))
+
+	// -- When
+	//
+	m := given.Match("steve left nether", l.Now)
+
+	// -- Then
+	//
+	l.Equal([]string{"steve left nether", "steve", "nether"}, m)
+	l.Equal([]string{"", "player", "world"}, SubexpNames(given))
+	l.Nil(SubexpNames(Not(joined)))
+}
+
+func (l *LogConditionTestSuite) TestExecuteLogReaderNamedGroups() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	store.AddEntries(&variable.Entry{Key: "player", Val: "nobody"}, &variable.Entry{Key: "server", Val: "main"})
+	reader := strings.NewReader("steve joined\nalex joined\n")
+	given := &CompiledLogReaction{
+		Condition: Count(l.regex(`(?P<player>\w+) (\w+)`), 2),
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "last", Value: "{{player}} {{groups.player}} {{first_match}} {{server}}"}},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, []*reaction.LogReaction{
+		{
+			When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: `(?P<first>\w+) joined`}}},
+			Then: []*reaction.LogReactionAction{
+				{SetVariable: &actions.SetVariable{Name: "joined", Value: "{{first}}"}},
+			},
+		},
+	}, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+	})
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		<-c.Done()
+		l.Equal("alex alex alex main", store.GetStringValue("last"))
+		l.Equal("alex", store.GetStringValue("joined"))
+	}
+}
+
+func (l *LogConditionTestSuite) TestExecuteLogReaderNamedGroupPrecedence() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	reader := strings.NewReader("matched line\n")
+	given := &CompiledLogReaction{
+		Condition: l.regex(`(?P<line>\w+) line`),
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "out", Value: "{{line}}/{{groups.line}}"}},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, nil, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+	})
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		<-c.Done()
+		l.Equal("matched line\n/matched", store.GetStringValue("out"))
+	}
+}
+
+func (l *LogConditionTestSuite) TestExecuteLogReaderTypes() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	reader := strings.NewReader("players online: 9 tps: 19.50\n")
+	given := &CompiledLogReaction{
+		Condition: l.regex(`players online: (?P<players>\d+) tps: (?P<tps>[\d.]+)`),
+		Types:     map[string]variable.Type{"players": variable.TypeInt, "tps": variable.TypeFloat},
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "out", Value: "{{players + 1}} {% if players > 10 %}full{% else %}open{% endif %} {{groups.tps}}"}},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteLogReader(context.Background(), reader, store, nil, nil, ExecuteLogOpts{
+		Reactions: []*CompiledLogReaction{given},
+	})
+
+	// -- Then
+	//
+	if l.NoError(err) {
+		<-c.Done()
+		l.Equal("10 open 19.5", store.GetStringValue("out"))
+	}
+}
+
+func (l *LogConditionTestSuite) TestClone() {
+	// -- Given
+	//
+	count := Count(l.regex("b"), 2)
+	count.Match("b", l.Now)
+	seq := Sequence(time.Minute, l.regex("a"), l.regex("b"))
+	seq.Match("a", l.Now)
+
+	// -- When
+	//
+	countClone := CloneLogCondition(count)
+	seqClone := CloneLogCondition(seq)
+
+	// -- Then
+	//
+	l.Nil(countClone.Match("b", l.Now))
+	l.Nil(seqClone.Match("b", l.Now))
+	l.Equal([]string{"b"}, count.Match("b", l.Now))
+	l.Equal([]string{"b"}, seq.Match("b", l.Now))
+	l.Equal([]string{"b"}, countClone.Match("b", l.Now))
+}
+
+func (l *LogConditionTestSuite) TestSharedReactionState() {
+	// -- Given
+	//
+	store := variable.NewStore()
+	given := &CompiledLogReaction{
+		Condition: Count(l.regex(`ERROR`), 2),
+		Then: []*reaction.LogReactionAction{
+			{SetVariable: &actions.SetVariable{Name: "errors", Value: "{{line}}"}},
+		},
+	}
+
+	// -- When
+	//
+	for _, v := range []string{"ERROR a\n", "ERROR b\n"} {
+		c, err := ExecuteLogReader(context.Background(), strings.NewReader(v), store, nil, nil, ExecuteLogOpts{
+			Reactions: []*CompiledLogReaction{given},
+		})
+		l.Require().NoError(err)
+		<-c.Done()
+	}
+
+	// -- Then
+	//
+	l.Empty(store.GetStringValue("errors"))
+}
+
+func (l *LogConditionTestSuite) regex(expr string) LogCondition {
+	c, err := Regex(expr)
+	l.Require().NoError(err)
+	return c
+}
+
+func TestLogConditionTestSuite(t *testing.T) {
+	suite.Run(t, new(LogConditionTestSuite))
+}
@@ -0,0 +1,125 @@
+package reaction
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOffsetInterval = time.Second
+)
+
+// logOffset is the position within a log of the last line that was handled.
+type logOffset struct {
+	// The inode of the log. Used to detect whether the log was replaced e.g. rotated.
+	Inode uint64 `json:"inode"`
+
+	// The byte offset after the last line that was handled.
+	Offset int64 `json:"offset"`
+
+	// The number of the last line that was handled.
+	Line int `json:"line"`
+}
+
+// loadLogOffset reads the saved offset for the log. If nothing was saved, or the log has since been replaced or
+// truncated, the zero value is returned so the log is read from the beginning.
+func loadLogOffset(offsetFile, logFile string) logOffset {
+	b, err := os.ReadFile(offsetFile)
+	if err != nil {
+		return logOffset{}
+	}
+
+	out := logOffset{}
+	err = json.Unmarshal(b, &out)
+	if err != nil {
+		logrus.WithError(err).WithField("file", offsetFile).Warn("Invalid log offset file. Reading log from the beginning.")
+		return logOffset{}
+	}
+
+	info, err := os.Stat(logFile)
+	if err != nil {
+		return logOffset{}
+	}
+
+	if fileInode(info) != out.Inode || info.Size() < out.Offset {
+		logrus.WithField("log", logFile).Info("Log was replaced since the offset was saved. Reading log from the beginning.")
+		return logOffset{}
+	}
+
+	return out
+}
+
+// saveLogOffset atomically writes the offset so a crash never leaves a partially written file.
+func saveLogOffset(offsetFile string, o logOffset) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+
+	tmp := offsetFile + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, offsetFile)
+}
+
+// offsetTracker records the offset of the last handled line and periodically saves it.
+type offsetTracker struct {
+	OffsetFile string
+	LogFile    string
+
+	lock    sync.Mutex
+	current logOffset
+	saved   logOffset
+}
+
+// Opened resets the offset for a log the tailer opened, or reopened e.g. after it was rotated. The inode is of the log
+// the tailer is reading so an offset is never saved with the inode of a log that replaced it.
+func (o *offsetTracker) Opened(inode uint64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.current = logOffset{Inode: inode}
+}
+
+func (o *offsetTracker) Set(offset int64, line int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.current.Offset = offset
+	o.current.Line = line
+}
+
+// Save writes the offset if it changed since the last save.
+func (o *offsetTracker) Save() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.current == o.saved {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(o.OffsetFile), os.ModePerm)
+	if err == nil {
+		err = saveLogOffset(o.OffsetFile, o.current)
+	}
+
+	if err != nil {
+		logrus.WithError(err).WithField("file", o.OffsetFile).Warn("Failed to save log offset.")
+		return
+	}
+
+	o.saved = o.current
+}
+
+// statInode is the inode of the file at the path. Zero if it doesn't exist.
+func statInode(fp string) uint64 {
+	info, err := os.Stat(fp)
+	if err != nil {
+		return 0
+	}
+	return fileInode(info)
+}
@@ -0,0 +1,214 @@
+package reaction
+
+import (
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPollInterval = 2 * time.Second
+)
+
+// pollWatcher is an eventWatcher that scans directories on an interval. Changes to the size, modification time or
+// inode of a file between scans are emitted as the same events inotify would emit. Unlike inotify, a directory that's
+// removed is still watched so its files are emitted as created once it's recreated.
+type pollWatcher struct {
+	Interval time.Duration
+
+	// A nil scan is a watched dir that doesn't exist.
+	lock   sync.Mutex
+	dirs   map[string]map[string]pollEntry
+	events chan fsnotify.Event
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+}
+
+type pollEntry struct {
+	Size    int64
+	ModTime time.Time
+	Inode   uint64
+	IsDir   bool
+}
+
+func newPollWatcher(interval time.Duration) *pollWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	p := &pollWatcher{
+		Interval: interval,
+		dirs:     map[string]map[string]pollEntry{},
+		events:   make(chan fsnotify.Event),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+// Add takes a snapshot of the dir. Only changes made after the snapshot are emitted.
+func (p *pollWatcher) Add(dir string) error {
+	entries, err := scanDir(dir)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dirs[dir] = entries
+	return nil
+}
+
+func (p *pollWatcher) Remove(dir string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.dirs, dir)
+	return nil
+}
+
+func (p *pollWatcher) Events() <-chan fsnotify.Event {
+	return p.events
+}
+
+func (p *pollWatcher) Errors() <-chan error {
+	return p.errors
+}
+
+func (p *pollWatcher) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
+
+func (p *pollWatcher) run() {
+	defer close(p.events)
+	defer close(p.errors)
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, ev := range p.scan() {
+			select {
+			case <-p.done:
+				return
+			case p.events <- ev:
+			}
+		}
+	}
+}
+
+// scan rescans every watched dir and returns the changes since the last scan.
+func (p *pollWatcher) scan() []fsnotify.Event {
+	p.lock.Lock()
+	dirs := make([]string, 0, len(p.dirs))
+	for k := range p.dirs {
+		dirs = append(dirs, k)
+	}
+	p.lock.Unlock()
+	sort.Strings(dirs)
+
+	out := make([]fsnotify.Event, 0)
+	for _, dir := range dirs {
+		entries, err := scanDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logrus.WithError(err).WithField("directory", dir).Debug("Failed to scan directory.")
+			continue
+		}
+
+		p.lock.Lock()
+		prev, ok := p.dirs[dir]
+		if !ok {
+			// Removed while scanning.
+			p.lock.Unlock()
+			continue
+		}
+
+		p.dirs[dir] = entries
+		p.lock.Unlock()
+
+		out = append(out, diffDir(dir, prev, entries)...)
+		if entries == nil && prev != nil {
+			out = append(out, fsnotify.Event{Name: dir, Op: fsnotify.Remove})
+		}
+	}
+
+	return out
+}
+
+// diffDir compares two scans of the dir. Directories only emit create and remove events as their modification time
+// changes whenever their contents do.
+func diffDir(dir string, prev, cur map[string]pollEntry) []fsnotify.Event {
+	names := make([]string, 0, len(prev)+len(cur))
+	for k := range prev {
+		names = append(names, k)
+	}
+	for k := range cur {
+		if _, ok := prev[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	out := make([]fsnotify.Event, 0)
+	for _, name := range names {
+		fp := filepath.Join(dir, name)
+		before, existed := prev[name]
+		after, exists := cur[name]
+		switch {
+		case existed && !exists:
+			out = append(out, fsnotify.Event{Name: fp, Op: fsnotify.Remove})
+		case !existed && exists:
+			out = append(out, fsnotify.Event{Name: fp, Op: fsnotify.Create})
+		case before.Inode != after.Inode || before.IsDir != after.IsDir:
+			// Replaced e.g. by a rename over the top of the old file.
+			out = append(out, fsnotify.Event{Name: fp, Op: fsnotify.Create})
+		case !after.IsDir && (before.Size != after.Size || !before.ModTime.Equal(after.ModTime)):
+			out = append(out, fsnotify.Event{Name: fp, Op: fsnotify.Write})
+		}
+	}
+
+	return out
+}
+
+// scanDir returns the direct children of the dir keyed by name.
+func scanDir(dir string) (map[string]pollEntry, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]pollEntry, len(des))
+	for _, de := range des {
+		info, err := de.Info()
+		if err != nil {
+			// Removed since the dir was read.
+			continue
+		}
+
+		out[de.Name()] = pollEntry{
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Inode:   fileInode(info),
+			IsDir:   info.IsDir(),
+		}
+	}
+
+	return out, nil
+}
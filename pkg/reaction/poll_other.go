@@ -0,0 +1,12 @@
+//go:build !unix
+
+package reaction
+
+import (
+	"io/fs"
+)
+
+// fileInode is not supported so replaced files are only detected by their size and modification time.
+func fileInode(_ fs.FileInfo) uint64 {
+	return 0
+}
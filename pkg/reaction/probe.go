@@ -0,0 +1,359 @@
+package reaction
+
+import (
+	"context"
+	"fmt"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProbeInterval = 5 * time.Second
+
+	// The max number of bytes of an HTTP body or UDP response that's read by a probe.
+	maxProbeRead = 64 * 1024
+)
+
+// Probe actively checks whether the server is ready rather than relying on its log. Only one of Tcp, Http or Udp should
+// be set.
+type Probe struct {
+	// Succeeds when the address e.g. "localhost:25565" accepts TCP connections.
+	Tcp string
+
+	Http *HttpProbe
+	Udp  *UdpProbe
+
+	// How often the probe is checked. Defaults to DefaultProbeInterval.
+	Interval time.Duration
+
+	// The max amount of time a single check can take. Defaults to the Interval.
+	Timeout time.Duration
+
+	// The number of consecutive failures before a ready server is no longer ready. Defaults to 1.
+	FailureThreshold int
+
+	// The number of consecutive successes before the server is ready. Defaults to 1.
+	SuccessThreshold int
+}
+
+type HttpProbe struct {
+	Url string
+
+	// The expected status code. If zero, any 2xx succeeds.
+	Status int
+
+	// When set, the body must match the regex.
+	Body string
+}
+
+type UdpProbe struct {
+	// The address e.g. "localhost:27015".
+	Addr string
+
+	// Sent to the address for every check.
+	Request []byte
+
+	// The response must match the regex. Each byte of the response is matched as the character with the same value so
+	// bytes can be matched with escapes e.g. ^\xff\xff\xff\xffI. When empty, any response succeeds.
+	Response string
+}
+
+func (p *Probe) String() string {
+	if p.Tcp != "" {
+		return fmt.Sprintf("tcp %s", p.Tcp)
+	} else if p.Http != nil {
+		return fmt.Sprintf("http %s", p.Http.Url)
+	} else if p.Udp != nil {
+		return fmt.Sprintf("udp %s", p.Udp.Addr)
+	}
+	return ""
+}
+
+type CompiledProbe struct {
+	Probe *Probe
+
+	body     *regexp.Regexp
+	response *regexp.Regexp
+}
+
+type ExecuteProbeOpts struct {
+	// Called with the ready status once every probe has met its success threshold and with the unknown status once any
+	// probe has met its failure threshold afterwards.
+	OnStatusChange StatusChangeFunc
+
+	// Called after every check. The err is nil if the check succeeded.
+	OnResult func(p *Probe, err error)
+}
+
+func CompileProbes(probes ...*Probe) ([]*CompiledProbe, error) {
+	out := make([]*CompiledProbe, 0, len(probes))
+	for _, v := range probes {
+		c, err := CompileProbe(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func CompileProbe(p *Probe) (*CompiledProbe, error) {
+	set := 0
+	for _, v := range []bool{p.Tcp != "", p.Http != nil, p.Udp != nil} {
+		if v {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, except.NewInvalid("exactly one of tcp, http or udp is required for a probe")
+	}
+
+	if p.Interval < 0 || p.Timeout < 0 {
+		return nil, except.NewInvalid("probe interval and timeout cannot be negative")
+	}
+
+	if p.FailureThreshold < 0 || p.SuccessThreshold < 0 {
+		return nil, except.NewInvalid("probe thresholds cannot be negative")
+	}
+
+	out := &CompiledProbe{Probe: p}
+	var err error
+	if p.Http != nil && p.Http.Body != "" {
+		out.body, err = regexp.Compile(p.Http.Body)
+		if err != nil {
+			return nil, except.NewInvalid("invalid http probe body regex %s: %s", p.Http.Body, err.Error())
+		}
+	}
+
+	if p.Udp != nil && p.Udp.Response != "" {
+		out.response, err = regexp.Compile(p.Udp.Response)
+		if err != nil {
+			return nil, except.NewInvalid("invalid udp probe response regex %s: %s", p.Udp.Response, err.Error())
+		}
+	}
+
+	return out, nil
+}
+
+func (c *CompiledProbe) interval() time.Duration {
+	if c.Probe.Interval > 0 {
+		return c.Probe.Interval
+	}
+	return DefaultProbeInterval
+}
+
+func (c *CompiledProbe) timeout() time.Duration {
+	if c.Probe.Timeout > 0 {
+		return c.Probe.Timeout
+	}
+	return c.interval()
+}
+
+// Check runs the probe once. A nil error means the probe succeeded.
+func (c *CompiledProbe) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	if c.Probe.Tcp != "" {
+		return probeTcp(ctx, c.Probe.Tcp)
+	} else if c.Probe.Http != nil {
+		return probeHttp(ctx, c.Probe.Http, c.body)
+	}
+	return probeUdp(ctx, c.Probe.Udp, c.response)
+}
+
+// ExecuteProbes checks every probe on its interval and changes the status of the server through the
+// ExecuteProbeOpts.OnStatusChange. The returned context is done once every probe has stopped.
+func ExecuteProbes(ctx context.Context, probes []*Probe, opts ExecuteProbeOpts) (context.Context, error) {
+	compiled, err := CompileProbes(probes...)
+	if err != nil {
+		return nil, err
+	}
+
+	done, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	agg := &probeAggregate{
+		ready: make([]bool, len(compiled)),
+		opts:  opts,
+	}
+	wg := sync.WaitGroup{}
+	for i, v := range compiled {
+		wg.Add(1)
+		go func(idx int, c *CompiledProbe) {
+			defer wg.Done()
+			runProbe(ctx, c, opts, func(ready bool) {
+				agg.Set(idx, ready)
+			})
+		}(i, v)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel(context.Cause(ctx))
+	}()
+
+	return done, nil
+}
+
+func runProbe(ctx context.Context, c *CompiledProbe, opts ExecuteProbeOpts, onReady func(ready bool)) {
+	successes, failures := 0, 0
+	ready := false
+	ticker := time.NewTicker(c.interval())
+	defer ticker.Stop()
+	for {
+		err := c.Check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if opts.OnResult != nil {
+			opts.OnResult(c.Probe, err)
+		}
+
+		if err == nil {
+			successes++
+			failures = 0
+			if !ready && successes >= threshold(c.Probe.SuccessThreshold) {
+				ready = true
+				onReady(ready)
+			}
+		} else {
+			logrus.WithError(err).WithField("probe", c.Probe.String()).Trace("Probe failed.")
+			failures++
+			successes = 0
+			if ready && failures >= threshold(c.Probe.FailureThreshold) {
+				ready = false
+				onReady(ready)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func threshold(t int) int {
+	if t > 0 {
+		return t
+	}
+	return 1
+}
+
+// probeAggregate is ready while every probe is ready.
+type probeAggregate struct {
+	lock  sync.Mutex
+	ready []bool
+	all   bool
+	opts  ExecuteProbeOpts
+}
+
+// Set changes whether the probe is ready. The lock is held while the status changes so they're always in order.
+func (p *probeAggregate) Set(idx int, ready bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ready[idx] = ready
+	all := true
+	for _, v := range p.ready {
+		all = all && v
+	}
+	if all == p.all || p.opts.OnStatusChange == nil {
+		p.all = all
+		return
+	}
+	p.all = all
+
+	if all {
+		p.opts.OnStatusChange(actions.SetStatus_ready)
+	} else {
+		p.opts.OnStatusChange(actions.SetStatus_unknown)
+	}
+}
+
+func probeTcp(ctx context.Context, addr string) error {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeHttp(ctx context.Context, h *HttpProbe, body *regexp.Regexp) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.Url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if h.Status != 0 && resp.StatusCode != h.Status {
+		return fmt.Errorf("expected status %d but got %d", h.Status, resp.StatusCode)
+	} else if h.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("expected a 2xx status but got %d", resp.StatusCode)
+	}
+
+	if body == nil {
+		return nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeRead))
+	if err != nil {
+		return err
+	}
+
+	if !body.Match(b) {
+		return fmt.Errorf("body does not match %s", body.String())
+	}
+	return nil
+}
+
+func probeUdp(ctx context.Context, u *UdpProbe, response *regexp.Regexp) error {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "udp", u.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	_, err = conn.Write(u.Request)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, maxProbeRead)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+
+	if response != nil && !response.MatchString(byteString(buf[:n])) {
+		return fmt.Errorf("response does not match %s", response.String())
+	}
+	return nil
+}
+
+// byteString maps every byte to the rune with the same value so a regex can match any byte.
+func byteString(b []byte) string {
+	out := make([]rune, len(b))
+	for i, v := range b {
+		out[i] = rune(v)
+	}
+	return string(out)
+}
@@ -0,0 +1,262 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type ProbeTestSuite struct {
+	suite.Suite
+
+	lock     sync.Mutex
+	Statuses []actions.SetStatus_Status
+}
+
+func (p *ProbeTestSuite) BeforeTest(_, _ string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.Statuses = nil
+}
+
+func (p *ProbeTestSuite) TestCompileProbeInvalid() {
+	// -- Given
+	//
+	type test struct {
+		Given *Probe
+	}
+
+	tests := []test{
+		{Given: &Probe{}},
+		{Given: &Probe{Tcp: "localhost:25565", Http: &HttpProbe{Url: "http://localhost"}}},
+		{Given: &Probe{Tcp: "localhost:25565", Interval: -time.Second}},
+		{Given: &Probe{Tcp: "localhost:25565", FailureThreshold: -1}},
+		{Given: &Probe{Http: &HttpProbe{Url: "http://localhost", Body: "("}}},
+		{Given: &Probe{Udp: &UdpProbe{Addr: "localhost:27015", Response: "("}}},
+	}
+
+	for i, v := range tests {
+		// -- When
+		//
+		_, err := CompileProbe(v.Given)
+
+		// -- Then
+		//
+		p.ErrorIs(err, except.ErrInvalid, "test %d", i)
+	}
+}
+
+func (p *ProbeTestSuite) TestCheckTcp() {
+	// -- Given
+	//
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	p.Require().NoError(err)
+	given, err := CompileProbe(&Probe{Tcp: l.Addr().String(), Timeout: time.Second})
+	p.Require().NoError(err)
+
+	// -- When
+	//
+	open := given.Check(context.Background())
+	_ = l.Close()
+	closed := given.Check(context.Background())
+
+	// -- Then
+	//
+	p.NoError(open)
+	p.Error(closed)
+}
+
+func (p *ProbeTestSuite) TestCheckHttp() {
+	// -- Given
+	//
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/starting" {
+			_, _ = rw.Write([]byte(`{"state": "starting"}`))
+			return
+		}
+		rw.WriteHeader(http.StatusAccepted)
+		_, _ = rw.Write([]byte(`{"state": "running"}`))
+	}))
+	defer s.Close()
+
+	type test struct {
+		Given    *HttpProbe
+		Expected bool
+	}
+
+	tests := []test{
+		{Given: &HttpProbe{Url: s.URL}, Expected: true},
+		{Given: &HttpProbe{Url: s.URL, Status: http.StatusAccepted, Body: `"running"`}, Expected: true},
+		{Given: &HttpProbe{Url: s.URL, Status: http.StatusOK}},
+		{Given: &HttpProbe{Url: s.URL + "/starting", Body: `"running"`}},
+	}
+
+	for i, v := range tests {
+		given, err := CompileProbe(&Probe{Http: v.Given, Timeout: time.Second})
+		p.Require().NoError(err)
+
+		// -- When
+		//
+		err = given.Check(context.Background())
+
+		// -- Then
+		//
+		p.Equal(v.Expected, err == nil, "test %d: %v", i, err)
+	}
+}
+
+func (p *ProbeTestSuite) TestCheckUdp() {
+	// -- Given
+	//
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	p.Require().NoError(err)
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if string(buf[:n]) == "\xff\xff\xff\xffTSource Engine Query\x00" {
+				_, _ = conn.WriteTo([]byte("\xff\xff\xff\xffI\x11server"), addr)
+			}
+		}
+	}()
+
+	type test struct {
+		Given    *UdpProbe
+		Expected bool
+	}
+
+	tests := []test{
+		{Given: &UdpProbe{Addr: conn.LocalAddr().String(), Request: []byte("\xff\xff\xff\xffTSource Engine Query\x00"), Response: `^\xff\xff\xff\xffI`}, Expected: true},
+		{Given: &UdpProbe{Addr: conn.LocalAddr().String(), Request: []byte("\xff\xff\xff\xffTSource Engine Query\x00"), Response: `^\xff\xff\xff\xffA`}},
+		{Given: &UdpProbe{Addr: conn.LocalAddr().String(), Request: []byte("ping")}},
+	}
+
+	for i, v := range tests {
+		given, err := CompileProbe(&Probe{Udp: v.Given, Timeout: 100 * time.Millisecond})
+		p.Require().NoError(err)
+
+		// -- When
+		//
+		err = given.Check(context.Background())
+
+		// -- Then
+		//
+		p.Equal(v.Expected, err == nil, "test %d: %v", i, err)
+	}
+}
+
+func (p *ProbeTestSuite) TestExecuteProbesThresholds() {
+	// -- Given
+	//
+	healthy := atomic.Bool{}
+	healthy.Store(true)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checks := atomic.Int32{}
+
+	// -- When
+	//
+	c, err := ExecuteProbes(ctx, []*Probe{
+		{
+			Http:             &HttpProbe{Url: s.URL},
+			Interval:         5 * time.Millisecond,
+			Timeout:          time.Second,
+			SuccessThreshold: 3,
+			FailureThreshold: 2,
+		},
+	}, ExecuteProbeOpts{
+		OnStatusChange: p.onStatusChange,
+		OnResult: func(_ *Probe, _ error) {
+			checks.Add(1)
+		},
+	})
+	p.Require().NoError(err)
+
+	// -- Then
+	//
+	p.Eventually(func() bool {
+		return len(p.statuses()) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	p.GreaterOrEqual(checks.Load(), int32(3))
+
+	healthy.Store(false)
+	p.Eventually(func() bool {
+		return len(p.statuses()) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	p.Equal([]actions.SetStatus_Status{actions.SetStatus_ready, actions.SetStatus_unknown}, p.statuses())
+
+	cancel()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		p.Fail("probes were not stopped")
+	}
+}
+
+func (p *ProbeTestSuite) TestExecuteProbesAll() {
+	// -- Given
+	//
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	p.Require().NoError(err)
+	addr := l.Addr().String()
+	_ = l.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {}))
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	_, err = ExecuteProbes(ctx, []*Probe{
+		{Tcp: addr, Interval: 5 * time.Millisecond, Timeout: time.Second},
+		{Http: &HttpProbe{Url: s.URL}, Interval: 5 * time.Millisecond, Timeout: time.Second},
+	}, ExecuteProbeOpts{OnStatusChange: p.onStatusChange})
+	p.Require().NoError(err)
+
+	// -- Then
+	//
+	time.Sleep(50 * time.Millisecond)
+	p.Empty(p.statuses())
+
+	l, err = net.Listen("tcp", addr)
+	p.Require().NoError(err)
+	defer l.Close()
+	p.Eventually(func() bool {
+		return len(p.statuses()) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	p.Equal(actions.SetStatus_ready, p.statuses()[0])
+}
+
+func (p *ProbeTestSuite) onStatusChange(s actions.SetStatus_Status) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.Statuses = append(p.Statuses, s)
+}
+
+func (p *ProbeTestSuite) statuses() []actions.SetStatus_Status {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]actions.SetStatus_Status(nil), p.Statuses...)
+}
+
+func TestProbeTestSuite(t *testing.T) {
+	suite.Run(t, new(ProbeTestSuite))
+}
@@ -4,12 +4,9 @@ import (
 	"context"
 	"github.com/fsnotify/fsnotify"
 	"github.com/hostfactor/api/go/blueprint"
-	"github.com/hostfactor/diazo/pkg/actions"
 	"github.com/hostfactor/diazo/pkg/fileutils"
 	"github.com/hostfactor/diazo/pkg/ptr"
 	"github.com/sirupsen/logrus"
-	"math"
-	"sync"
 	"time"
 )
 
@@ -21,24 +18,25 @@ type ExecuteOpts struct {
 }
 
 func ExecuteSetupAction(ctx context.Context, folder string, act *blueprint.SetupAction, opts ExecuteOpts) (err error) {
+	client := opts.File.client()
 	var createdDir string
 	if v := act.GetUnzip(); v != nil {
 		createdDir = v.To
-		err = actions.Unzip(v)
+		err = client.Unzip(v)
 	} else if v := act.GetRename(); v != nil {
 		createdDir = v.To
-		err = actions.Rename(v)
+		err = client.Rename(v)
 	} else if v := act.GetExtract(); v != nil {
 		createdDir = v.To
-		err = actions.Extract(v)
+		err = client.Extract(v)
 	} else if v := act.GetDownload(); v != nil {
 		createdDir = v.To
-		err = actions.Download(folder, v, opts.File.DownloadOpts)
+		err = client.Download(folder, v, opts.File.DownloadOpts)
 	} else if v := act.GetMove(); v != nil {
 		createdDir = v.To
-		err = actions.Move(v)
+		err = client.MoveFile(v)
 	} else if v := act.GetShell(); v != nil {
-		_, err = actions.Shell(ctx, v)
+		_, err = client.Shell(ctx, v)
 	}
 	if err != nil {
 		return
@@ -55,39 +53,27 @@ func ExecuteSetupAction(ctx context.Context, folder string, act *blueprint.Setup
 	return
 }
 
-type debouncer struct {
-	Ev        *fsnotify.Event
-	Triggered time.Time
-	Interval  time.Duration
-	lock      sync.RWMutex
-}
-
+// Debounce collapses every event from the channel that happens within the duration of each other into the last event.
+// Use DebounceFile to debounce each file separately.
 func Debounce(ctx context.Context, c chan fsnotify.Event, dur time.Duration) chan fsnotify.Event {
-	deb := &debouncer{Interval: dur}
-	return deb.Debounce(ctx, c)
-}
-
-func (d *debouncer) Debounce(ctx context.Context, c chan fsnotify.Event) chan fsnotify.Event {
 	out := make(chan fsnotify.Event, 1)
+	d := newDebouncer(ctx, RealClock, dur, func(event fsnotify.Event) {
+		select {
+		case out <- event:
+		case <-ctx.Done():
+		}
+	})
 
 	go func() {
-		timer := time.NewTimer(math.MaxInt64)
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-timer.C:
-				if d.Ev != nil {
-					out <- *d.Ev
-					d.Ev = nil
-				}
 			case ev, ok := <-c:
 				if !ok {
 					return
 				}
-
-				d.Ev = &ev
-				timer.Reset(d.Interval)
+				d.Add("", ev)
 			}
 		}
 	}()
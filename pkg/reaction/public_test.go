@@ -15,9 +15,11 @@ import (
 	"github.com/hostfactor/diazo/pkg/variable"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -38,16 +40,21 @@ func (p *PublicTestSuite) TestWatch() {
 	defer cancel()
 	cmd := exec.CommandContext(ctx, "sh", "-c", "echo 123 && sleep 1 && echo 456")
 	stdout, _ := cmd.StdoutPipe()
-	str := stdout
 	actual := make([]LogLine, 0)
-	go func() {
-		c := Watch(ctx, str, func(ll LogLine) {
-			actual = append(actual, ll)
-		})
-		<-c.Done()
-	}()
 
-	err := cmd.Run()
+	err := cmd.Start()
+	if err != nil {
+		p.NoError(err)
+		return
+	}
+
+	// The pipe must be fully read before waiting on the command as Wait closes it.
+	c := Watch(ctx, stdout, func(ll LogLine) {
+		actual = append(actual, ll)
+	})
+	<-c.Done()
+
+	err = cmd.Wait()
 	if err != nil {
 		p.NoError(err)
 		return
@@ -61,6 +68,25 @@ func (p *PublicTestSuite) TestWatch() {
 	p.Equal(expected, actual)
 }
 
+func (p *PublicTestSuite) TestWatchDeliversEveryLine() {
+	// -- Given
+	//
+	given := strings.Repeat("line\n", 1000)
+	count := 0
+
+	// -- When
+	//
+	c := Watch(context.Background(), strings.NewReader(given), func(ll LogLine) {
+		count++
+	})
+	<-c.Done()
+
+	// -- Then
+	//
+	p.Equal(1000, count)
+	p.ErrorIs(context.Cause(c), io.EOF)
+}
+
 func (p *PublicTestSuite) TestExecuteFileTriggerAction() {
 	// -- Given
 	//
@@ -303,6 +329,22 @@ func (p *PublicTestSuite) TestDebounce() {
 	p.True(count > 1)
 }
 
+func (p *PublicTestSuite) TestRenderFileReactionActionFuncs() {
+	// -- Given
+	//
+	given := &reaction.FileReactionAction{
+		Download: &actions.DownloadFile{To: `/backups/{{name}}-{{ now_timestamp("2006") }}.{{ext}}{{ path_ext("world.tar.gz") }}`},
+	}
+
+	// -- When
+	//
+	actual := RenderFileReactionAction(given, variable.NewStore(), fileTemplateEntries("/saves/world.zip")...)
+
+	// -- Then
+	//
+	p.Equal("/backups/world-"+time.Now().UTC().Format("2006")+".zip.gz", actual.GetDownload().GetTo())
+}
+
 func TestPublicTestSuite(t *testing.T) {
 	suite.Run(t, new(PublicTestSuite))
 }
@@ -0,0 +1,205 @@
+package reaction
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultQueueSize = 100
+)
+
+type QueueOpts struct {
+	// The max number of events that are handled at once. Events for the same file are never handled at the same time.
+	// Defaults to 1.
+	Concurrency int
+
+	// The max number of events waiting to be handled. Once full, adding an event blocks until there's space. Events
+	// for a file that's already waiting replace the waiting event and don't take up space. Defaults to DefaultQueueSize.
+	Size int
+
+	// Once the context is cancelled, the max amount of time to keep handling events that were already queued. Events
+	// still waiting afterwards are dropped. If zero, every queued event is handled.
+	DrainTimeout time.Duration
+}
+
+func (q QueueOpts) enabled() bool {
+	return q.Concurrency > 0 || q.Size > 0
+}
+
+// FileQueue hands events off to a pool of workers so the callback doesn't block the watch.
+type FileQueue struct {
+	Opts QueueOpts
+
+	ctx      context.Context
+	callback WatchFileFunc
+	lock     sync.Mutex
+	order    []string
+	pending  map[string]fsnotify.Event
+	running  map[string]bool
+	changed  chan struct{}
+	closed   bool
+	done     chan struct{}
+}
+
+// NewFileQueue starts the workers for the queue. Once the context is cancelled, no new events are accepted and the
+// workers exit after the queued events are handled.
+func NewFileQueue(ctx context.Context, opts QueueOpts, callback WatchFileFunc) *FileQueue {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	if opts.Size <= 0 {
+		opts.Size = DefaultQueueSize
+	}
+
+	q := &FileQueue{
+		Opts:     opts,
+		ctx:      ctx,
+		callback: callback,
+		pending:  map[string]fsnotify.Event{},
+		running:  map[string]bool{},
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work()
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		q.close()
+		wg.Wait()
+		close(q.done)
+	}()
+
+	return q
+}
+
+// Push queues the event. If the queue is full, Push blocks until there's space or the queue is closed.
+func (q *FileQueue) Push(event fsnotify.Event) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for {
+		if q.closed || q.ctx.Err() != nil {
+			logrus.WithField("file", event.Name).Debug("Queue is closed. Dropping event.")
+			return
+		}
+
+		if _, ok := q.pending[event.Name]; ok {
+			q.pending[event.Name] = event
+			return
+		}
+
+		if len(q.order) < q.Opts.Size {
+			break
+		}
+
+		q.wait()
+	}
+
+	q.order = append(q.order, event.Name)
+	q.pending[event.Name] = event
+	q.broadcast()
+}
+
+// Len is the number of events waiting to be handled.
+func (q *FileQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.order)
+}
+
+// Done is closed once the queue has been closed and every worker has exited.
+func (q *FileQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+func (q *FileQueue) work() {
+	for {
+		ev, ok := q.next()
+		if !ok {
+			return
+		}
+
+		q.callback(ev)
+
+		q.lock.Lock()
+		delete(q.running, ev.Name)
+		q.broadcast()
+		q.lock.Unlock()
+	}
+}
+
+// next blocks until there's an event for a file that isn't already being handled. Returns false once the queue is
+// closed and empty.
+func (q *FileQueue) next() (fsnotify.Event, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for {
+		for i, name := range q.order {
+			if q.running[name] {
+				continue
+			}
+
+			ev := q.pending[name]
+			delete(q.pending, name)
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			q.running[name] = true
+			q.broadcast()
+			return ev, true
+		}
+
+		if q.closed && len(q.order) == 0 {
+			return fsnotify.Event{}, false
+		}
+
+		q.wait()
+	}
+}
+
+func (q *FileQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	q.broadcast()
+
+	if q.Opts.DrainTimeout > 0 {
+		time.AfterFunc(q.Opts.DrainTimeout, q.drop)
+	}
+}
+
+// drop discards every event still waiting to be handled.
+func (q *FileQueue) drop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.order) > 0 {
+		logrus.WithField("dropped", len(q.order)).Warn("Queue did not drain in time. Dropping events.")
+	}
+	q.order = nil
+	q.pending = map[string]fsnotify.Event{}
+	q.broadcast()
+}
+
+// wait releases the lock until the state of the queue changes. Must be called with the lock held.
+func (q *FileQueue) wait() {
+	c := q.changed
+	q.lock.Unlock()
+	<-c
+	q.lock.Lock()
+}
+
+// broadcast wakes everything waiting on the queue. Must be called with the lock held.
+func (q *FileQueue) broadcast() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
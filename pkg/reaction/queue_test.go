@@ -0,0 +1,255 @@
+package reaction
+
+import (
+	"context"
+	"github.com/bxcodec/faker/v3"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/mocks/actionsmocks"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type QueueTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (q *QueueTestSuite) BeforeTest(_, _ string) {
+	q.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(q.Dir, os.ModePerm)
+}
+
+func (q *QueueTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(q.Dir)
+}
+
+func (q *QueueTestSuite) TestCoalesce() {
+	// -- Given
+	//
+	release := make(chan struct{})
+	lock := sync.Mutex{}
+	actual := make([]fsnotify.Event, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewFileQueue(ctx, QueueOpts{Concurrency: 1}, func(event fsnotify.Event) {
+		<-release
+		lock.Lock()
+		defer lock.Unlock()
+		actual = append(actual, event)
+	})
+
+	// -- When
+	//
+	given.Push(fsnotify.Event{Name: "a", Op: fsnotify.Create})
+	q.Eventually(func() bool {
+		return given.Len() == 0
+	}, time.Second, time.Millisecond)
+	given.Push(fsnotify.Event{Name: "b", Op: fsnotify.Create})
+	given.Push(fsnotify.Event{Name: "b", Op: fsnotify.Write})
+	given.Push(fsnotify.Event{Name: "b", Op: fsnotify.Write})
+	queued := given.Len()
+	close(release)
+	cancel()
+	<-given.Done()
+
+	// -- Then
+	//
+	q.Equal(1, queued)
+	q.Equal([]fsnotify.Event{
+		{Name: "a", Op: fsnotify.Create},
+		{Name: "b", Op: fsnotify.Write},
+	}, actual)
+}
+
+func (q *QueueTestSuite) TestBackpressure() {
+	// -- Given
+	//
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := NewFileQueue(ctx, QueueOpts{Concurrency: 1, Size: 1}, func(event fsnotify.Event) {
+		<-release
+	})
+	given.Push(fsnotify.Event{Name: "a"})
+	q.Eventually(func() bool {
+		return given.Len() == 0
+	}, time.Second, time.Millisecond)
+	given.Push(fsnotify.Event{Name: "b"})
+
+	// -- When
+	//
+	pushed := make(chan struct{})
+	go func() {
+		given.Push(fsnotify.Event{Name: "c"})
+		close(pushed)
+	}()
+
+	// -- Then
+	//
+	select {
+	case <-pushed:
+		q.Fail("push should block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release <- struct{}{}
+	q.Eventually(func() bool {
+		select {
+		case <-pushed:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	close(release)
+}
+
+func (q *QueueTestSuite) TestSameFileNotConcurrent() {
+	// -- Given
+	//
+	running := atomic.Int32{}
+	overlapped := atomic.Bool{}
+	calls := atomic.Int32{}
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewFileQueue(ctx, QueueOpts{Concurrency: 4}, func(event fsnotify.Event) {
+		if running.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		calls.Add(1)
+	})
+
+	// -- When
+	//
+	for i := 0; i < 5; i++ {
+		given.Push(fsnotify.Event{Name: "a"})
+		time.Sleep(2 * time.Millisecond)
+	}
+	cancel()
+	<-given.Done()
+
+	// -- Then
+	//
+	q.False(overlapped.Load())
+	q.GreaterOrEqual(calls.Load(), int32(2))
+}
+
+func (q *QueueTestSuite) TestDrain() {
+	// -- Given
+	//
+	release := make(chan struct{})
+	calls := atomic.Int32{}
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewFileQueue(ctx, QueueOpts{Concurrency: 1}, func(event fsnotify.Event) {
+		<-release
+		calls.Add(1)
+	})
+	given.Push(fsnotify.Event{Name: "a"})
+	given.Push(fsnotify.Event{Name: "b"})
+	given.Push(fsnotify.Event{Name: "c"})
+
+	// -- When
+	//
+	cancel()
+	given.Push(fsnotify.Event{Name: "d"})
+	close(release)
+	<-given.Done()
+
+	// -- Then
+	//
+	q.Equal(int32(3), calls.Load())
+}
+
+func (q *QueueTestSuite) TestDrainTimeout() {
+	// -- Given
+	//
+	release := make(chan struct{})
+	calls := atomic.Int32{}
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewFileQueue(ctx, QueueOpts{Concurrency: 1, DrainTimeout: 10 * time.Millisecond}, func(event fsnotify.Event) {
+		<-release
+		calls.Add(1)
+	})
+	given.Push(fsnotify.Event{Name: "a"})
+	q.Eventually(func() bool {
+		return given.Len() == 0
+	}, time.Second, time.Millisecond)
+	given.Push(fsnotify.Event{Name: "b"})
+
+	// -- When
+	//
+	cancel()
+	time.Sleep(30 * time.Millisecond)
+	close(release)
+	<-given.Done()
+
+	// -- Then
+	//
+	q.Equal(int32(1), calls.Load())
+}
+
+func (q *QueueTestSuite) TestExecuteFileQueued() {
+	// -- Given
+	//
+	fileActions := new(actionsmocks.Client)
+	actions2.Default = fileActions
+	uploaded := atomic.Bool{}
+	started := make(chan struct{})
+	fileActions.On("Upload", "root", mock.Anything, actions2.UploadOpts{}).Run(func(_ mock.Arguments) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		uploaded.Store(true)
+	}).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := &reaction.FileReaction{
+		When: []*reaction.FileReactionCondition{
+			{
+				Directories: []string{q.Dir},
+				Op:          []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_create},
+			},
+		},
+		Then: []*reaction.FileReactionAction{
+			{
+				Upload: &actions.UploadFile{
+					From: &actions.UploadFile_Source{Path: "{{abs}}"},
+					To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{filename}}"}},
+				},
+			},
+		},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteFile(ctx, variable.NewStore(), "root", given, ExecuteFileOpts{
+		Queue: QueueOpts{Concurrency: 1},
+	})
+	if !q.NoError(err) {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(q.Dir, "world.sav"), []byte("save"), os.ModePerm)
+	<-started
+	cancel()
+	<-c.Done()
+
+	// -- Then
+	//
+	q.True(uploaded.Load())
+	q.ErrorIs(context.Cause(c), context.Canceled)
+}
+
+func TestQueueTestSuite(t *testing.T) {
+	suite.Run(t, new(QueueTestSuite))
+}
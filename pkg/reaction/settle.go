@@ -0,0 +1,379 @@
+package reaction
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSettleInterval = 100 * time.Millisecond
+)
+
+type SettleOpts struct {
+	// The amount of time the size and modification time of the file must remain unchanged for it to be considered
+	// settled.
+	Stable time.Duration
+
+	// The file is only considered settled once no process has it open for writing. Only supported on systems with a
+	// /proc filesystem. Elsewhere, files are always considered closed.
+	Closed bool
+
+	// How often the file is checked. Defaults to DefaultSettleInterval.
+	Interval time.Duration
+
+	// The max amount of time to wait for the file to settle. If zero, there is no limit.
+	Timeout time.Duration
+
+	// Gets the size and modification time of the file. Defaults to os.Stat e.g. a replay stats files that don't
+	// exist.
+	Stat func(fp string) (os.FileInfo, error)
+}
+
+func (s SettleOpts) enabled() bool {
+	return s.Stable > 0 || s.Closed
+}
+
+// DebounceFile collapses events for the same file that happen within the duration of each other into the last event.
+// The callback is called once no new events have been seen for the file for the duration.
+func DebounceFile(ctx context.Context, dur time.Duration, callback WatchFileFunc) WatchFileFunc {
+	return debounceFile(ctx, RealClock, dur, callback)
+}
+
+func debounceFile(ctx context.Context, clock Clock, dur time.Duration, callback WatchFileFunc) WatchFileFunc {
+	d := newDebouncer(ctx, clock, dur, callback)
+	return func(event fsnotify.Event) {
+		d.Add(event.Name, event)
+	}
+}
+
+// debouncer passes on the last event of each key once no new events have been added for the key for the duration.
+type debouncer struct {
+	Ctx      context.Context
+	Clock    Clock
+	Duration time.Duration
+	Callback WatchFileFunc
+
+	lock    sync.Mutex
+	pending map[string]*debouncedEvent
+	gen     int
+}
+
+type debouncedEvent struct {
+	Event fsnotify.Event
+	timer ClockTimer
+	gen   int
+}
+
+func newDebouncer(ctx context.Context, clock Clock, dur time.Duration, callback WatchFileFunc) *debouncer {
+	return &debouncer{
+		Ctx:      ctx,
+		Clock:    clock,
+		Duration: dur,
+		Callback: callback,
+		pending:  map[string]*debouncedEvent{},
+	}
+}
+
+func (d *debouncer) Add(key string, event fsnotify.Event) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	p, ok := d.pending[key]
+	if !ok {
+		p = &debouncedEvent{}
+		d.pending[key] = p
+	}
+	p.Event = event
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+
+	// The generation prevents a timer that already fired from passing on a newer event or one that was passed on. It's
+	// shared by every key so it's never reused once a key's event is passed on.
+	d.gen++
+	gen := d.gen
+	p.gen = gen
+	p.timer = d.Clock.AfterFunc(d.Duration, func() {
+		d.fire(key, gen)
+	})
+}
+
+func (d *debouncer) fire(key string, gen int) {
+	d.lock.Lock()
+	p, ok := d.pending[key]
+	if !ok || p.gen != gen {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	d.lock.Unlock()
+
+	if d.Ctx.Err() == nil {
+		d.Callback(p.Event)
+	}
+}
+
+// SettleFile calls the callback once the file from an event has settled. While a file is settling, new events for it
+// replace the pending event rather than triggering the callback again. Remove events are not delayed.
+func SettleFile(ctx context.Context, opts SettleOpts, callback WatchFileFunc) WatchFileFunc {
+	return settleFile(ctx, RealClock, opts, callback)
+}
+
+func settleFile(ctx context.Context, clock Clock, opts SettleOpts, callback WatchFileFunc) WatchFileFunc {
+	s := newSettler(ctx, clock, opts, callback, func(fp string, err error) {
+		logrus.WithError(err).WithField("file", fp).Warn("File did not settle.")
+	})
+
+	return func(event fsnotify.Event) {
+		if event.Op&fsnotify.Remove == fsnotify.Remove {
+			callback(event)
+			return
+		}
+		s.Add(event)
+	}
+}
+
+// WaitForSettle blocks until the file's size and modification time have not changed for SettleOpts.Stable and, if
+// SettleOpts.Closed is set, until the file is not open for writing.
+func WaitForSettle(ctx context.Context, fp string, opts SettleOpts) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	s := newSettler(ctx, RealClock, opts, func(_ fsnotify.Event) {
+		done <- nil
+	}, func(_ string, err error) {
+		done <- err
+	})
+	s.Add(fsnotify.Event{Name: fp, Op: fsnotify.Write})
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// settler checks each file every interval of its Clock until it has settled.
+type settler struct {
+	Ctx      context.Context
+	Clock    Clock
+	Opts     SettleOpts
+	Callback WatchFileFunc
+	OnError  func(fp string, err error)
+
+	lock    sync.Mutex
+	pending map[string]*settlingFile
+}
+
+type settlingFile struct {
+	Event       fsnotify.Event
+	Last        os.FileInfo
+	Started     time.Time
+	StableSince time.Time
+	timer       ClockTimer
+}
+
+func newSettler(ctx context.Context, clock Clock, opts SettleOpts, callback WatchFileFunc, onError func(fp string, err error)) *settler {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultSettleInterval
+	}
+
+	s := &settler{
+		Ctx:      ctx,
+		Clock:    clock,
+		Opts:     opts,
+		Callback: callback,
+		OnError:  onError,
+		pending:  map[string]*settlingFile{},
+	}
+	context.AfterFunc(ctx, s.stop)
+	return s
+}
+
+// Add waits for the file of the event to settle. If the file is already settling, the event replaces its pending
+// event. The file is checked and added under the same lock so concurrent events of a file only settle it once.
+func (s *settler) Add(event fsnotify.Event) {
+	s.lock.Lock()
+	if p, ok := s.pending[event.Name]; ok {
+		p.Event = event
+		s.lock.Unlock()
+		return
+	}
+
+	if s.Ctx.Err() != nil {
+		s.lock.Unlock()
+		return
+	}
+
+	info, err := s.stat(event.Name)
+	if err != nil {
+		s.lock.Unlock()
+		s.OnError(event.Name, err)
+		return
+	}
+
+	now := s.Clock.Now()
+	p := &settlingFile{Event: event, Last: info, Started: now, StableSince: now}
+	s.pending[event.Name] = p
+	s.schedule(event.Name, p)
+	s.lock.Unlock()
+}
+
+func (s *settler) check(fp string) {
+	s.lock.Lock()
+	p, ok := s.pending[fp]
+	if !ok {
+		s.lock.Unlock()
+		return
+	}
+	last, stableSince, started := p.Last, p.StableSince, p.Started
+	s.lock.Unlock()
+
+	now := s.Clock.Now()
+	info, err := s.stat(fp)
+	if err != nil {
+		s.done(fp, err)
+		return
+	}
+
+	settled := false
+	if info.Size() != last.Size() || !info.ModTime().Equal(last.ModTime()) {
+		last, stableSince = info, now
+	} else if now.Sub(stableSince) >= s.Opts.Stable {
+		settled = !s.Opts.Closed || !isOpenForWrite(fp)
+	}
+
+	if settled {
+		s.done(fp, nil)
+		return
+	}
+
+	if s.Opts.Timeout > 0 && now.Sub(started) >= s.Opts.Timeout {
+		s.done(fp, except.NewTimeout("%s did not settle within %s", fp, s.Opts.Timeout))
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if p, ok := s.pending[fp]; ok {
+		p.Last, p.StableSince = last, stableSince
+		s.schedule(fp, p)
+	}
+}
+
+// schedule checks the file again after the interval. Must be called with the lock held.
+func (s *settler) schedule(fp string, p *settlingFile) {
+	p.timer = s.Clock.AfterFunc(s.Opts.Interval, func() {
+		s.check(fp)
+	})
+}
+
+// done stops waiting for the file. If the file settled, the callback is called with its latest event.
+func (s *settler) done(fp string, err error) {
+	s.lock.Lock()
+	p, ok := s.pending[fp]
+	delete(s.pending, fp)
+	s.lock.Unlock()
+
+	if !ok || s.Ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		s.OnError(fp, err)
+		return
+	}
+	s.Callback(p.Event)
+}
+
+// stop stops waiting for every file as the context is done.
+func (s *settler) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k, v := range s.pending {
+		if v.timer != nil {
+			v.timer.Stop()
+		}
+		delete(s.pending, k)
+	}
+}
+
+func (s *settler) stat(fp string) (os.FileInfo, error) {
+	if s.Opts.Stat != nil {
+		return s.Opts.Stat(fp)
+	}
+	return os.Stat(fp)
+}
+
+// isOpenForWrite checks whether any process has the file open for writing by inspecting /proc.
+func isOpenForWrite(fp string) bool {
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return false
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false
+	}
+
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || target != abs {
+				continue
+			}
+
+			if fdOpenForWrite(filepath.Join("/proc", p.Name(), "fdinfo", fd.Name())) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func fdOpenForWrite(fdInfo string) bool {
+	b, err := os.ReadFile(fdInfo)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		v, ok := strings.CutPrefix(line, "flags:")
+		if !ok {
+			continue
+		}
+
+		flags, err := strconv.ParseInt(strings.TrimSpace(v), 8, 64)
+		if err != nil {
+			return false
+		}
+
+		// Either O_WRONLY or O_RDWR.
+		return int(flags)&(os.O_WRONLY|os.O_RDWR) != 0
+	}
+
+	return false
+}
@@ -0,0 +1,272 @@
+package reaction
+
+import (
+	"context"
+	"github.com/bxcodec/faker/v3"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/mocks/actionsmocks"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type SettleTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (s *SettleTestSuite) BeforeTest(_, _ string) {
+	s.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(s.Dir, os.ModePerm)
+}
+
+func (s *SettleTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(s.Dir)
+}
+
+func (s *SettleTestSuite) TestDebounceFile() {
+	// -- Given
+	//
+	lock := sync.Mutex{}
+	actual := make([]fsnotify.Event, 0)
+	given := DebounceFile(context.Background(), 20*time.Millisecond, func(event fsnotify.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		actual = append(actual, event)
+	})
+
+	// -- When
+	//
+	given(fsnotify.Event{Name: "a", Op: fsnotify.Create})
+	for i := 0; i < 5; i++ {
+		given(fsnotify.Event{Name: "a", Op: fsnotify.Write})
+		time.Sleep(5 * time.Millisecond)
+	}
+	given(fsnotify.Event{Name: "b", Op: fsnotify.Create})
+
+	// -- Then
+	//
+	time.Sleep(60 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	s.ElementsMatch([]fsnotify.Event{
+		{Name: "a", Op: fsnotify.Write},
+		{Name: "b", Op: fsnotify.Create},
+	}, actual)
+}
+
+func (s *SettleTestSuite) TestDebounceFileConcurrent() {
+	// -- Given
+	//
+	empty := atomic.Int32{}
+	calls := atomic.Int32{}
+	given := DebounceFile(context.Background(), 20*time.Microsecond, func(event fsnotify.Event) {
+		calls.Add(1)
+		if event.Name == "" {
+			empty.Add(1)
+		}
+	})
+
+	// -- When
+	//
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				given(fsnotify.Event{Name: "a", Op: fsnotify.Write})
+				if j%10 == 0 {
+					time.Sleep(20 * time.Microsecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// -- Then
+	//
+	s.Eventually(func() bool {
+		return calls.Load() > 0
+	}, 5*time.Second, 5*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	s.Zero(empty.Load())
+}
+
+func (s *SettleTestSuite) TestSettleFileConcurrent() {
+	// -- Given
+	//
+	fp := filepath.Join(s.Dir, "world.zip")
+	s.Require().NoError(os.WriteFile(fp, []byte("world"), os.ModePerm))
+	clock := NewManualClock(time.Now())
+	calls := atomic.Int32{}
+	given := settleFile(context.Background(), clock, SettleOpts{
+		Stable:   time.Second,
+		Interval: time.Second,
+		Stat: func(fp string) (os.FileInfo, error) {
+			time.Sleep(time.Millisecond)
+			return os.Stat(fp)
+		},
+	}, func(_ fsnotify.Event) {
+		calls.Add(1)
+	})
+
+	// -- When
+	//
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			given(fsnotify.Event{Name: fp, Op: fsnotify.Write})
+		}()
+	}
+	wg.Wait()
+	scheduled := len(clock.timers)
+	clock.Advance(5 * time.Second)
+
+	// -- Then
+	//
+	s.Equal(1, scheduled)
+	s.Equal(int32(1), calls.Load())
+}
+
+func (s *SettleTestSuite) TestWaitForSettle() {
+	// -- Given
+	//
+	fp := filepath.Join(s.Dir, "save.dat")
+	f, _ := os.Create(fp)
+	go func() {
+		defer f.Close()
+		for i := 0; i < 5; i++ {
+			_, _ = f.WriteString("chunk")
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	// -- When
+	//
+	err := WaitForSettle(context.Background(), fp, SettleOpts{Stable: 50 * time.Millisecond, Interval: 5 * time.Millisecond})
+
+	// -- Then
+	//
+	if s.NoError(err) {
+		info, _ := os.Stat(fp)
+		s.Equal(int64(25), info.Size())
+	}
+}
+
+func (s *SettleTestSuite) TestWaitForSettleClosed() {
+	// -- Given
+	//
+	fp := filepath.Join(s.Dir, "save.dat")
+	f, _ := os.Create(fp)
+	_, _ = f.WriteString("data")
+	opts := SettleOpts{Closed: true, Interval: 5 * time.Millisecond, Timeout: 50 * time.Millisecond}
+
+	// -- When
+	//
+	openErr := WaitForSettle(context.Background(), fp, opts)
+	_ = f.Close()
+	closedErr := WaitForSettle(context.Background(), fp, opts)
+
+	// -- Then
+	//
+	s.ErrorIs(openErr, except.ErrTimeout)
+	s.NoError(closedErr)
+}
+
+func (s *SettleTestSuite) TestWaitForSettleRemoved() {
+	// -- Given
+	//
+	fp := filepath.Join(s.Dir, "save.dat")
+	_ = os.WriteFile(fp, []byte("data"), os.ModePerm)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = os.Remove(fp)
+	}()
+
+	// -- When
+	//
+	err := WaitForSettle(context.Background(), fp, SettleOpts{Stable: time.Second, Interval: 5 * time.Millisecond})
+
+	// -- Then
+	//
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *SettleTestSuite) TestExecuteFileSettled() {
+	// -- Given
+	//
+	fileActions := new(actionsmocks.Client)
+	actions2.Default = fileActions
+	fp := filepath.Join(s.Dir, "world.sav")
+	calls := atomic.Int32{}
+	fileActions.On("Upload", "root", mock.Anything, actions2.UploadOpts{}).Run(func(_ mock.Arguments) {
+		calls.Add(1)
+	}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given := &reaction.FileReaction{
+		When: []*reaction.FileReactionCondition{
+			{
+				Directories: []string{s.Dir},
+				Matches:     &filesystem.FileMatcher{Name: "world.sav"},
+			},
+		},
+		Then: []*reaction.FileReactionAction{
+			{
+				Upload: &actions.UploadFile{
+					From: &actions.UploadFile_Source{Path: "{{abs}}"},
+					To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{filename}}"}},
+				},
+			},
+		},
+	}
+
+	// -- When
+	//
+	_, err := ExecuteFile(ctx, variable.NewStore(), "root", given, ExecuteFileOpts{
+		Debounce: 10 * time.Millisecond,
+		Settle:   SettleOpts{Stable: 40 * time.Millisecond, Interval: 5 * time.Millisecond},
+	})
+	if !s.NoError(err) {
+		return
+	}
+
+	f, _ := os.Create(fp)
+	for i := 0; i < 3; i++ {
+		_, _ = f.WriteString("burst")
+		time.Sleep(15 * time.Millisecond)
+	}
+	_ = f.Close()
+
+	// -- Then
+	//
+	s.Eventually(func() bool {
+		return calls.Load() > 0
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	s.Equal(int32(1), calls.Load())
+	fileActions.AssertCalled(s.T(), "Upload", "root", &actions.UploadFile{
+		From: &actions.UploadFile_Source{Path: fp},
+		To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "world.sav"}},
+	}, actions2.UploadOpts{})
+}
+
+func TestSettleTestSuite(t *testing.T) {
+	suite.Run(t, new(SettleTestSuite))
+}
@@ -0,0 +1,243 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// DefaultStatusTransitions are the statuses each status can move to.
+var DefaultStatusTransitions = map[actions.SetStatus_Status][]actions.SetStatus_Status{
+	actions.SetStatus_unknown: {actions.SetStatus_ready},
+	actions.SetStatus_ready:   {actions.SetStatus_unknown},
+}
+
+// StatusEventType is what happened to the status of a StatusTracker.
+type StatusEventType int
+
+const (
+	// StatusChanged is a valid transition to a new status.
+	StatusChanged StatusEventType = iota
+
+	// StatusInvalid is a transition that's not allowed. The status is not changed.
+	StatusInvalid
+
+	// StatusTimedOut is raised once the server has not become ready within the startup timeout.
+	StatusTimedOut
+)
+
+func (s StatusEventType) String() string {
+	switch s {
+	case StatusInvalid:
+		return "invalid"
+	case StatusTimedOut:
+		return "timed_out"
+	default:
+		return "changed"
+	}
+}
+
+type StatusEvent struct {
+	Type StatusEventType
+	From actions.SetStatus_Status
+	To   actions.SetStatus_Status
+	At   time.Time
+
+	// Set for StatusInvalid and StatusTimedOut.
+	Err error
+}
+
+// TrackerStatus is the status of a StatusTracker. Err is set while the tracker is in the error state e.g. the server
+// has not become ready within the startup timeout.
+type TrackerStatus struct {
+	Status actions.SetStatus_Status
+	Err    error
+}
+
+func (t TrackerStatus) String() string {
+	if t.Err != nil {
+		return "error"
+	}
+	return t.Status.String()
+}
+
+type StatusTrackerOpts struct {
+	// The statuses each status can move to. Defaults to DefaultStatusTransitions.
+	Transitions map[actions.SetStatus_Status][]actions.SetStatus_Status
+
+	// The max amount of time to wait for the server to become ready, starting from when the tracker is created or
+	// whenever the server leaves the ready status. If zero, there is no limit.
+	StartupTimeout time.Duration
+
+	// Called for every StatusEvent.
+	OnEvent func(ev StatusEvent)
+
+	// Called once for every change of the TrackerStatus, including when the tracker enters the error state, so callers
+	// don't need to track the status themselves.
+	OnStatusChange func(s TrackerStatus)
+
+	// Tells the time and schedules the StartupTimeout. Defaults to RealClock.
+	Clock Clock
+}
+
+// StatusTracker tracks the status of a server e.g. from ExecuteLogOpts.OnStatusChange. Repeated statuses are ignored.
+type StatusTracker struct {
+	Opts StatusTrackerOpts
+
+	ctx    context.Context
+	lock   sync.Mutex
+	status actions.SetStatus_Status
+	err    error
+	timer  ClockTimer
+
+	// Incremented whenever the timer is replaced so a stale timer does nothing.
+	gen int
+}
+
+// NewStatusTracker creates a tracker with the unknown status. The startup timeout is stopped once the context is done.
+func NewStatusTracker(ctx context.Context, opts StatusTrackerOpts) *StatusTracker {
+	if opts.Transitions == nil {
+		opts.Transitions = DefaultStatusTransitions
+	}
+	opts.Clock = clockOrReal(opts.Clock)
+
+	s := &StatusTracker{
+		Opts: opts,
+		ctx:  ctx,
+	}
+
+	s.lock.Lock()
+	s.startTimer()
+	s.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.lock.Lock()
+		s.stopTimer()
+		s.lock.Unlock()
+	}()
+
+	return s
+}
+
+// Set moves the tracker to the status if the transition is allowed. Can be used as a StatusChangeFunc.
+func (s *StatusTracker) Set(status actions.SetStatus_Status) {
+	s.lock.Lock()
+	from := s.status
+	if status == from {
+		s.lock.Unlock()
+		return
+	}
+
+	if !s.allowed(from, status) {
+		s.lock.Unlock()
+		s.emit(StatusEvent{
+			Type: StatusInvalid,
+			From: from,
+			To:   status,
+			Err:  except.NewInvalid("status cannot change from %s to %s", from.String(), status.String()),
+		})
+		return
+	}
+
+	s.status = status
+	if status == actions.SetStatus_ready {
+		s.err = nil
+		s.stopTimer()
+	} else if from == actions.SetStatus_ready {
+		s.startTimer()
+	}
+	s.lock.Unlock()
+
+	s.emit(StatusEvent{
+		Type: StatusChanged,
+		From: from,
+		To:   status,
+	})
+}
+
+// State is the status and the error of the tracker's error state.
+func (s *StatusTracker) State() TrackerStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return TrackerStatus{Status: s.status, Err: s.err}
+}
+
+func (s *StatusTracker) Status() actions.SetStatus_Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.status
+}
+
+// Err is set while the tracker is in the error state i.e. the server has not become ready within the startup timeout.
+// The error is cleared once the server becomes ready.
+func (s *StatusTracker) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *StatusTracker) allowed(from, to actions.SetStatus_Status) bool {
+	for _, v := range s.Opts.Transitions[from] {
+		if v == to {
+			return true
+		}
+	}
+	return false
+}
+
+// startTimer must be called with the lock held.
+func (s *StatusTracker) startTimer() {
+	s.stopTimer()
+	if s.Opts.StartupTimeout <= 0 || s.ctx.Err() != nil {
+		return
+	}
+
+	gen := s.gen
+	timeout := s.Opts.StartupTimeout
+	s.timer = s.Opts.Clock.AfterFunc(timeout, func() {
+		s.lock.Lock()
+		if gen != s.gen || s.ctx.Err() != nil {
+			s.lock.Unlock()
+			return
+		}
+		s.timer = nil
+		s.err = except.NewTimeout("server did not become ready within %s", timeout)
+		ev := StatusEvent{
+			Type: StatusTimedOut,
+			From: s.status,
+			To:   s.status,
+			Err:  s.err,
+		}
+		s.lock.Unlock()
+
+		s.emit(ev)
+	})
+}
+
+// stopTimer must be called with the lock held.
+func (s *StatusTracker) stopTimer() {
+	s.gen++
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+func (s *StatusTracker) emit(ev StatusEvent) {
+	ev.At = s.Opts.Clock.Now()
+	if ev.Err != nil {
+		logrus.WithError(ev.Err).WithField("status", ev.From.String()).Warn("Server status error.")
+	}
+
+	if s.Opts.OnEvent != nil {
+		s.Opts.OnEvent(ev)
+	}
+
+	if s.Opts.OnStatusChange != nil && ev.Type != StatusInvalid {
+		s.Opts.OnStatusChange(TrackerStatus{Status: ev.To, Err: ev.Err})
+	}
+}
@@ -0,0 +1,230 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"testing"
+	"time"
+)
+
+type StatusTestSuite struct {
+	suite.Suite
+
+	lock   sync.Mutex
+	Events []StatusEvent
+	Clock  *ManualClock
+	Start  time.Time
+}
+
+func (s *StatusTestSuite) BeforeTest(_, _ string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Events = nil
+	s.Start = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Clock = NewManualClock(s.Start)
+}
+
+func (s *StatusTestSuite) TestSetDedupes() {
+	// -- Given
+	//
+	given := NewStatusTracker(context.Background(), StatusTrackerOpts{OnEvent: s.onEvent})
+
+	// -- When
+	//
+	given.Set(actions.SetStatus_ready)
+	given.Set(actions.SetStatus_ready)
+	given.Set(actions.SetStatus_unknown)
+
+	// -- Then
+	//
+	actual := s.events()
+	if s.Len(actual, 2) {
+		s.Equal(StatusChanged, actual[0].Type)
+		s.Equal(actions.SetStatus_unknown, actual[0].From)
+		s.Equal(actions.SetStatus_ready, actual[0].To)
+		s.Equal(StatusChanged, actual[1].Type)
+		s.Equal(actions.SetStatus_unknown, actual[1].To)
+	}
+	s.Equal(actions.SetStatus_unknown, given.Status())
+}
+
+func (s *StatusTestSuite) TestSetInvalid() {
+	// -- Given
+	//
+	given := NewStatusTracker(context.Background(), StatusTrackerOpts{
+		OnEvent: s.onEvent,
+		Transitions: map[actions.SetStatus_Status][]actions.SetStatus_Status{
+			actions.SetStatus_unknown: {actions.SetStatus_ready},
+		},
+	})
+
+	// -- When
+	//
+	given.Set(actions.SetStatus_ready)
+	given.Set(actions.SetStatus_unknown)
+
+	// -- Then
+	//
+	actual := s.events()
+	if s.Len(actual, 2) {
+		s.Equal(StatusInvalid, actual[1].Type)
+		s.Equal(actions.SetStatus_ready, actual[1].From)
+		s.Equal(actions.SetStatus_unknown, actual[1].To)
+		s.ErrorIs(actual[1].Err, except.ErrInvalid)
+	}
+	s.Equal(actions.SetStatus_ready, given.Status())
+}
+
+func (s *StatusTestSuite) TestStartupTimeout() {
+	// -- Given
+	//
+	given := NewStatusTracker(context.Background(), StatusTrackerOpts{
+		OnEvent:        s.onEvent,
+		StartupTimeout: 10 * time.Minute,
+		Clock:          s.Clock,
+	})
+
+	// -- When
+	//
+	s.Clock.Advance(10 * time.Minute)
+	s.Error(given.Err())
+	given.Set(actions.SetStatus_ready)
+
+	// -- Then
+	//
+	actual := s.events()
+	if s.Len(actual, 2) {
+		s.Equal(StatusTimedOut, actual[0].Type)
+		s.ErrorIs(actual[0].Err, except.ErrTimeout)
+		s.Equal(s.Start.Add(10*time.Minute), actual[0].At)
+		s.Equal(StatusChanged, actual[1].Type)
+	}
+	s.NoError(given.Err())
+}
+
+func (s *StatusTestSuite) TestStartupTimeoutReady() {
+	// -- Given
+	//
+	given := NewStatusTracker(context.Background(), StatusTrackerOpts{
+		OnEvent:        s.onEvent,
+		StartupTimeout: 10 * time.Minute,
+		Clock:          s.Clock,
+	})
+
+	// -- When
+	//
+	given.Set(actions.SetStatus_ready)
+	s.Clock.Advance(time.Hour)
+
+	// -- Then
+	//
+	s.NoError(given.Err())
+	s.Len(s.events(), 1)
+}
+
+func (s *StatusTestSuite) TestStartupTimeoutRestart() {
+	// -- Given
+	//
+	given := NewStatusTracker(context.Background(), StatusTrackerOpts{
+		OnEvent:        s.onEvent,
+		StartupTimeout: 10 * time.Minute,
+		Clock:          s.Clock,
+	})
+	s.Clock.Advance(5 * time.Minute)
+	given.Set(actions.SetStatus_ready)
+
+	// -- When
+	//
+	given.Set(actions.SetStatus_unknown)
+
+	// -- Then
+	//
+	s.Clock.Advance(9 * time.Minute)
+	s.NoError(given.Err())
+	s.Clock.Advance(time.Minute)
+	s.Error(given.Err())
+	actual := s.events()
+	if s.Len(actual, 3) {
+		s.Equal(s.Start.Add(15*time.Minute), actual[2].At)
+		s.Equal(StatusTimedOut, actual[2].Type)
+		s.Equal(actions.SetStatus_unknown, actual[2].From)
+	}
+}
+
+func (s *StatusTestSuite) TestStartupTimeoutCancelled() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewStatusTracker(ctx, StatusTrackerOpts{
+		OnEvent:        s.onEvent,
+		StartupTimeout: 10 * time.Minute,
+		Clock:          s.Clock,
+	})
+
+	// -- When
+	//
+	cancel()
+	s.Clock.Advance(time.Hour)
+
+	// -- Then
+	//
+	s.NoError(given.Err())
+	s.Empty(s.events())
+}
+
+func (s *StatusTestSuite) TestOnStatusChange() {
+	// -- Given
+	//
+	lock := sync.Mutex{}
+	var actual []TrackerStatus
+	given := NewStatusTracker(context.Background(), StatusTrackerOpts{
+		StartupTimeout: 10 * time.Minute,
+		Clock:          s.Clock,
+		Transitions: map[actions.SetStatus_Status][]actions.SetStatus_Status{
+			actions.SetStatus_unknown: {actions.SetStatus_ready},
+		},
+		OnStatusChange: func(ts TrackerStatus) {
+			lock.Lock()
+			defer lock.Unlock()
+			actual = append(actual, ts)
+		},
+	})
+
+	// -- When
+	//
+	s.Clock.Advance(10 * time.Minute)
+	given.Set(actions.SetStatus_ready)
+	given.Set(actions.SetStatus_ready)
+	given.Set(actions.SetStatus_unknown)
+
+	// -- Then
+	//
+	lock.Lock()
+	defer lock.Unlock()
+	if s.Len(actual, 2) {
+		s.Equal(actions.SetStatus_unknown, actual[0].Status)
+		s.ErrorIs(actual[0].Err, except.ErrTimeout)
+		s.Equal("error", actual[0].String())
+		s.Equal(TrackerStatus{Status: actions.SetStatus_ready}, actual[1])
+	}
+	s.Equal(TrackerStatus{Status: actions.SetStatus_ready}, given.State())
+}
+
+func (s *StatusTestSuite) onEvent(ev StatusEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Events = append(s.Events, ev)
+}
+
+func (s *StatusTestSuite) events() []StatusEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]StatusEvent(nil), s.Events...)
+}
+
+func TestStatusTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusTestSuite))
+}
@@ -0,0 +1,222 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TimerReaction executes actions on a schedule e.g. periodic backups or restart warnings. Only one of Cron or Every
+// should be set.
+type TimerReaction struct {
+	// A cron expression with optional seconds e.g. 0 */6 * * * or a descriptor e.g. @daily or @every 1h.
+	Cron string
+
+	// Executes the actions at a fixed interval starting from when the reaction starts.
+	Every time.Duration
+
+	// The IANA timezone the Cron expression is evaluated in e.g. America/New_York. Defaults to UTC.
+	Timezone string
+
+	// Delays each execution by a random duration of up to Jitter e.g. so many servers don't back up at the same time.
+	Jitter time.Duration
+
+	// The same actions as file reactions.
+	Then []*reaction.FileReactionAction
+
+	// Executed after Then with the time available to their templates.
+	Actions []*Action
+}
+
+type CompiledTimerReaction struct {
+	Reaction *TimerReaction
+	Schedule cron.Schedule
+	Location *time.Location
+}
+
+type ExecuteTimerOpts struct {
+	// Configures how the actions are executed. Then uses Actions.Root and Actions.File.
+	Actions ActionOpts
+
+	// Called whenever a reaction is about to execute its actions.
+	OnFire func(rx *TimerReaction, at time.Time)
+
+	// Tells the time and schedules each execution. Defaults to RealClock.
+	Clock Clock
+}
+
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// CompileTimerReactions validates the schedule of every reaction.
+func CompileTimerReactions(rx ...*TimerReaction) ([]*CompiledTimerReaction, error) {
+	out := make([]*CompiledTimerReaction, 0, len(rx))
+	for _, v := range rx {
+		c, err := CompileTimerReaction(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func CompileTimerReaction(rx *TimerReaction) (*CompiledTimerReaction, error) {
+	if (rx.Cron == "") == (rx.Every == 0) {
+		return nil, except.NewInvalid("a timer reaction requires either a cron expression or an interval")
+	}
+
+	if rx.Every < 0 {
+		return nil, except.NewInvalid("timer interval %s must be positive", rx.Every)
+	}
+
+	if rx.Jitter < 0 {
+		return nil, except.NewInvalid("timer jitter %s must be positive", rx.Jitter)
+	}
+
+	loc := time.UTC
+	if rx.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(rx.Timezone)
+		if err != nil {
+			return nil, except.NewInvalid("invalid timezone %s: %s", rx.Timezone, err.Error())
+		}
+	}
+
+	out := &CompiledTimerReaction{
+		Reaction: rx,
+		Location: loc,
+		Schedule: everySchedule(rx.Every),
+	}
+
+	if rx.Cron != "" {
+		sched, err := cronParser.Parse(rx.Cron)
+		if err != nil {
+			return nil, except.NewInvalid("invalid cron expression %s: %s", rx.Cron, err.Error())
+		}
+
+		// A CRON_TZ within the expression takes precedence over the Timezone.
+		if v, ok := sched.(*cron.SpecSchedule); ok && v.Location == time.Local {
+			v.Location = loc
+		}
+		out.Schedule = sched
+	}
+
+	return out, nil
+}
+
+// Next is when the reaction should next execute after the time, not including jitter.
+func (c *CompiledTimerReaction) Next(t time.Time) time.Time {
+	return c.Schedule.Next(t.In(c.Location))
+}
+
+// ExecuteTimers executes every reaction on its schedule until the context is done. The returned context is done once
+// every timer has stopped and its actions have finished.
+func ExecuteTimers(ctx context.Context, store variable.Store, rx []*TimerReaction, opts ExecuteTimerOpts) (context.Context, error) {
+	compiled, err := CompileTimerReactions(rx...)
+	if err != nil {
+		return nil, err
+	}
+
+	done, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	wg := sync.WaitGroup{}
+	for _, v := range compiled {
+		wg.Add(1)
+		go func(c *CompiledTimerReaction) {
+			defer wg.Done()
+			runTimer(ctx, store, c, opts)
+		}(v)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel(context.Cause(ctx))
+	}()
+
+	return done, nil
+}
+
+func runTimer(ctx context.Context, store variable.Store, c *CompiledTimerReaction, opts ExecuteTimerOpts) {
+	clock := clockOrReal(opts.Clock)
+	next := c.Next(clock.Now())
+	for {
+		var delay time.Duration
+		if c.Reaction.Jitter > 0 {
+			delay = time.Duration(rand.Int63n(int64(c.Reaction.Jitter)))
+		}
+
+		due := make(chan struct{})
+		timer := clock.AfterFunc(next.Sub(clock.Now())+delay, func() {
+			close(due)
+		})
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-due:
+		}
+
+		at := clock.Now().In(c.Location)
+		err := ExecuteTimerActions(ctx, store, c.Reaction, at, opts)
+		if err != nil {
+			logrus.WithError(err).WithField("schedule", c.String()).Error("Failed to execute timer action.")
+		}
+
+		// Executions that were missed while the actions were running are skipped.
+		now := clock.Now()
+		for !next.After(now) {
+			next = c.Next(next)
+		}
+	}
+}
+
+func (c *CompiledTimerReaction) String() string {
+	if c.Reaction.Cron != "" {
+		return c.Reaction.Cron
+	}
+	return "@every " + c.Reaction.Every.String()
+}
+
+// ExecuteTimerActions executes the actions of the reaction as if it fired at the time.
+func ExecuteTimerActions(ctx context.Context, store variable.Store, rx *TimerReaction, at time.Time, opts ExecuteTimerOpts) error {
+	if opts.OnFire != nil {
+		opts.OnFire(rx, at)
+	}
+
+	entries := timerTemplateEntries(at)
+	for _, v := range rx.Then {
+		err := ExecuteAction(ctx, store, &Action{File: v}, opts.Actions, entries...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, v := range rx.Actions {
+		err := ExecuteAction(ctx, store, v, opts.Actions, entries...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timerTemplateEntries are the template entries for a timer that fired at the time e.g. for timestamped backups.
+func timerTemplateEntries(at time.Time) []*variable.Entry {
+	return []*variable.Entry{
+		variable.NewEntry("time", at.Format(time.RFC3339)),
+		variable.NewEntry("timestamp", at.Unix()),
+	}
+}
+
+// everySchedule is a cron.Schedule at a fixed interval. Unlike cron.Every, it isn't rounded to the second.
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
@@ -0,0 +1,239 @@
+package reaction
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/hostfactor/diazo/pkg/mocks/actionsmocks"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type TimerTestSuite struct {
+	suite.Suite
+
+	FileActions *actionsmocks.Client
+}
+
+func (t *TimerTestSuite) BeforeTest(_, _ string) {
+	t.FileActions = new(actionsmocks.Client)
+	actions2.Default = t.FileActions
+}
+
+func (t *TimerTestSuite) TestCompileTimerReactionInvalid() {
+	tests := []*TimerReaction{
+		{},
+		{Cron: "@daily", Every: time.Hour},
+		{Every: -time.Hour},
+		{Every: time.Hour, Jitter: -time.Second},
+		{Cron: "* * *"},
+		{Cron: "@daily", Timezone: "Mars/Olympus_Mons"},
+	}
+
+	for _, v := range tests {
+		// -- When
+		//
+		_, err := CompileTimerReaction(v)
+
+		// -- Then
+		//
+		t.ErrorIs(err, except.ErrInvalid, "%+v", v)
+	}
+}
+
+func (t *TimerTestSuite) TestNextTimezone() {
+	// -- Given
+	//
+	c, err := CompileTimerReaction(&TimerReaction{Cron: "0 9 * * *", Timezone: "America/New_York"})
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	actual := c.Next(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// -- Then
+	//
+	t.True(time.Date(2023, 1, 1, 14, 0, 0, 0, time.UTC).Equal(actual), actual.String())
+}
+
+func (t *TimerTestSuite) TestNextCronTZ() {
+	// -- Given
+	//
+	c, err := CompileTimerReaction(&TimerReaction{Cron: "CRON_TZ=Asia/Tokyo 0 9 * * *", Timezone: "America/New_York"})
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	actual := c.Next(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// -- Then
+	//
+	t.True(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC).Equal(actual), actual.String())
+}
+
+func (t *TimerTestSuite) TestNextSeconds() {
+	// -- Given
+	//
+	c, err := CompileTimerReaction(&TimerReaction{Cron: "*/30 * * * * *"})
+	t.Require().NoError(err)
+
+	// -- When
+	//
+	actual := c.Next(time.Date(2023, 1, 1, 0, 0, 10, 0, time.UTC))
+
+	// -- Then
+	//
+	t.True(time.Date(2023, 1, 1, 0, 0, 30, 0, time.UTC).Equal(actual), actual.String())
+}
+
+func (t *TimerTestSuite) TestExecuteTimerActions() {
+	// -- Given
+	//
+	at := time.Date(2023, 1, 1, 6, 0, 0, 0, time.UTC)
+	given := &TimerReaction{
+		Every: time.Hour,
+		Then: []*reaction.FileReactionAction{
+			{
+				Upload: &actions.UploadFile{
+					From: &actions.UploadFile_Source{Path: "/saves/world"},
+					To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "world-{{timestamp}}.zip"}},
+				},
+			},
+		},
+		Actions: []*Action{
+			{Setup: &blueprint.SetupAction{Shell: &actions.Shell{Command: "./warn.sh {{time}} {{server}}"}}},
+		},
+	}
+	store := variable.NewStore()
+	store.AddEntries(variable.NewEntry("server", "main"))
+	t.FileActions.On("Upload", "root", &actions.UploadFile{
+		From: &actions.UploadFile_Source{Path: "/saves/world"},
+		To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "world-1672552800.zip"}},
+	}, actions2.UploadOpts{}).Return(nil)
+	t.FileActions.On("Shell", mock.Anything, &actions.Shell{Command: "./warn.sh 2023-01-01T06:00:00Z main"}).Return(nil, nil)
+
+	// -- When
+	//
+	err := ExecuteTimerActions(context.Background(), store, given, at, ExecuteTimerOpts{
+		Actions: ActionOpts{Root: "root"},
+	})
+
+	// -- Then
+	//
+	t.NoError(err)
+	t.FileActions.AssertExpectations(t.T())
+}
+
+func (t *TimerTestSuite) TestExecuteTimerActionsFuncs() {
+	// -- Given
+	//
+	at := time.Date(2023, 1, 1, 6, 0, 0, 0, time.UTC)
+	given := &TimerReaction{
+		Every: time.Hour,
+		Actions: []*Action{
+			{Setup: &blueprint.SetupAction{Shell: &actions.Shell{Command: `./backup.sh {{timestamp}} {{ now_timestamp("2006") }} {{ path_ext("world.zip") }}`}}},
+		},
+	}
+	expected := "./backup.sh 1672552800 " + time.Now().UTC().Format("2006") + " .zip"
+	t.FileActions.On("Shell", mock.Anything, &actions.Shell{Command: expected}).Return(nil, nil)
+
+	// -- When
+	//
+	err := ExecuteTimerActions(context.Background(), variable.NewStore(), given, at, ExecuteTimerOpts{})
+
+	// -- Then
+	//
+	t.NoError(err)
+	t.FileActions.AssertExpectations(t.T())
+}
+
+func (t *TimerTestSuite) TestExecuteTimers() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fired := int32(0)
+	given := []*TimerReaction{
+		{Every: 10 * time.Millisecond, Jitter: time.Millisecond},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteTimers(ctx, variable.NewStore(), given, ExecuteTimerOpts{
+		OnFire: func(rx *TimerReaction, at time.Time) {
+			if atomic.AddInt32(&fired, 1) == 3 {
+				cancel()
+			}
+		},
+	})
+
+	// -- Then
+	//
+	if t.NoError(err) {
+		select {
+		case <-c.Done():
+		case <-time.After(5 * time.Second):
+			t.Fail("timers did not stop")
+		}
+		t.EqualValues(3, atomic.LoadInt32(&fired))
+	}
+}
+
+func (t *TimerTestSuite) TestExecuteTimersClock() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	fired := make(chan time.Time, 1)
+	given := []*TimerReaction{
+		{Every: time.Hour},
+	}
+
+	// -- When
+	//
+	c, err := ExecuteTimers(ctx, variable.NewStore(), given, ExecuteTimerOpts{
+		Clock: clock,
+		OnFire: func(rx *TimerReaction, at time.Time) {
+			fired <- at
+		},
+	})
+	t.Require().NoError(err)
+
+	// -- Then
+	//
+	for i := 1; i <= 2; i++ {
+		expected := start.Add(time.Duration(i) * time.Hour)
+		t.Eventually(func() bool {
+			next, ok := clock.Next()
+			return ok && next.Equal(expected)
+		}, 5*time.Second, time.Millisecond)
+		clock.Advance(time.Hour)
+		t.Equal(expected, <-fired)
+	}
+
+	cancel()
+	<-c.Done()
+}
+
+func (t *TimerTestSuite) TestExecuteTimersInvalid() {
+	// -- When
+	//
+	_, err := ExecuteTimers(context.Background(), variable.NewStore(), []*TimerReaction{{Cron: "nope"}}, ExecuteTimerOpts{})
+
+	// -- Then
+	//
+	t.ErrorIs(err, except.ErrInvalid)
+}
+
+func TestTimerTestSuite(t *testing.T) {
+	suite.Run(t, new(TimerTestSuite))
+}
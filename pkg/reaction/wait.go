@@ -0,0 +1,231 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWaitInterval = time.Second
+)
+
+// WaitFor is a condition to block on until it is satisfied. Only one of File, Tcp, Http, or Log should be set.
+type WaitFor struct {
+	// Satisfied when a file matching the condition exists in, or appears in, one of the condition's directories.
+	// Subdirectories aren't checked. An existing file only satisfies a condition whose Op includes create, or has no Op.
+	File *reaction.FileReactionCondition
+
+	// Satisfied when the address e.g. "localhost:25565" accepts TCP connections.
+	Tcp string
+
+	// Satisfied when a GET to the URL returns a 2xx.
+	Http string
+
+	// Satisfied when a line in the log matches the regex.
+	Log *WaitForLog
+
+	// The max amount of time to wait. If zero, Wait blocks until the condition is satisfied or the context is done.
+	Timeout time.Duration
+
+	// How often the Tcp and Http conditions are checked. Defaults to DefaultWaitInterval.
+	Interval time.Duration
+}
+
+type WaitForLog struct {
+	// The path to the log file.
+	Path string
+
+	Regex string
+}
+
+func (w *WaitFor) String() string {
+	if w.File != nil {
+		return fmt.Sprintf("file %s", w.File.String())
+	} else if w.Tcp != "" {
+		return fmt.Sprintf("tcp %s", w.Tcp)
+	} else if w.Http != "" {
+		return fmt.Sprintf("http %s", w.Http)
+	} else if w.Log != nil {
+		return fmt.Sprintf("log %s to match %s", w.Log.Path, w.Log.Regex)
+	}
+	return ""
+}
+
+// Wait blocks until the WaitFor is satisfied. If the WaitFor.Timeout is reached, an except.ErrTimeout is returned.
+func Wait(ctx context.Context, w *WaitFor) error {
+	var cancel context.CancelFunc
+	if w.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+
+	done := make(chan struct{})
+	once := sync.Once{}
+	satisfied := func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+
+	var err error
+	if w.File != nil {
+		err = waitFile(ctx, w.File, satisfied)
+	} else if w.Tcp != "" {
+		go poll(ctx, interval, satisfied, func() bool {
+			return checkTcp(ctx, w.Tcp, interval)
+		})
+	} else if w.Http != "" {
+		err = validateHttpUrl(w.Http)
+		if err != nil {
+			return err
+		}
+		go poll(ctx, interval, satisfied, func() bool {
+			return checkHttp(ctx, w.Http, interval)
+		})
+	} else if w.Log != nil {
+		err = waitLog(ctx, w.Log, satisfied)
+	} else {
+		return except.NewInvalid("a wait condition is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("condition", w.String()).Debug("Waiting for condition.")
+	select {
+	case <-done:
+		logrus.WithField("condition", w.String()).Debug("Wait condition satisfied.")
+		return nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return except.NewTimeout("timed out after %s waiting for %s", w.Timeout, w.String())
+		}
+		return ctx.Err()
+	}
+}
+
+func waitFile(ctx context.Context, cond *reaction.FileReactionCondition, satisfied func()) error {
+	// The watch is started before checking for existing files so a file created in between isn't missed.
+	_, err := WatchFile(ctx, func(_ fsnotify.Event) {
+		satisfied()
+	}, cond)
+	if err != nil {
+		return err
+	}
+
+	if existingFileMatches(cond) {
+		satisfied()
+	}
+
+	return nil
+}
+
+// existingFileMatches checks the files directly within the condition's directories the same as the watch, which isn't
+// recursive. An existing file is treated as created so a condition on only updates or deletes never matches it.
+func existingFileMatches(cond *reaction.FileReactionCondition) bool {
+	for _, d := range cond.GetDirectories() {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			continue
+		}
+
+		for _, v := range entries {
+			if v.IsDir() {
+				continue
+			}
+
+			if FileReactionCondition(fsnotify.Event{Name: filepath.Join(d, v.Name()), Op: fsnotify.Create}, cond) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func waitLog(ctx context.Context, l *WaitForLog, satisfied func()) error {
+	re, err := regexp.Compile(l.Regex)
+	if err != nil {
+		return err
+	}
+
+	return WatchLog(ctx, l.Path, func(ll LogLine) {
+		if re.MatchString(ll.Text) {
+			satisfied()
+		}
+	})
+}
+
+func poll(ctx context.Context, interval time.Duration, satisfied func(), check func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if check() {
+			satisfied()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkTcp(ctx context.Context, addr string, timeout time.Duration) bool {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		logrus.WithError(err).WithField("addr", addr).Trace("TCP address is not ready.")
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+func validateHttpUrl(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return except.NewInvalid("invalid http url %s", u)
+	}
+	return nil
+}
+
+func checkHttp(ctx context.Context, u string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		logrus.WithError(err).WithField("url", u).Error("Invalid HTTP wait request.")
+		return false
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logrus.WithError(err).WithField("url", u).Trace("HTTP endpoint is not ready.")
+		return false
+	}
+	_ = resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode <= 299
+}
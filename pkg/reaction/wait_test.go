@@ -0,0 +1,250 @@
+package reaction
+
+import (
+	"context"
+	"github.com/bxcodec/faker/v3"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type WaitTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (w *WaitTestSuite) BeforeTest(_, _ string) {
+	w.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(w.Dir, os.ModePerm)
+}
+
+func (w *WaitTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(w.Dir)
+}
+
+func (w *WaitTestSuite) TestWaitFile() {
+	// -- Given
+	//
+	given := &WaitFor{
+		File: &reaction.FileReactionCondition{
+			Directories: []string{w.Dir},
+			Matches:     &filesystem.FileMatcher{Name: "server.properties"},
+		},
+		Timeout: time.Second,
+	}
+	fp := filepath.Join(w.Dir, "server.properties")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(fp, []byte("motd=hi"), os.ModePerm)
+	}()
+
+	// -- When
+	//
+	err := Wait(context.Background(), given)
+
+	// -- Then
+	//
+	w.NoError(err)
+}
+
+func (w *WaitTestSuite) TestWaitFileExists() {
+	// -- Given
+	//
+	_ = os.WriteFile(filepath.Join(w.Dir, "world.db"), []byte(""), os.ModePerm)
+	given := &WaitFor{
+		File: &reaction.FileReactionCondition{
+			Directories: []string{w.Dir},
+			Matches:     &filesystem.FileMatcher{Name: "world.db"},
+			Op:          []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_create},
+		},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	// -- When
+	//
+	err := Wait(context.Background(), given)
+
+	// -- Then
+	//
+	w.NoError(err)
+}
+
+func (w *WaitTestSuite) TestWaitFileExistsIgnored() {
+	type test struct {
+		Fp   string
+		Cond *reaction.FileReactionCondition
+	}
+
+	tests := []test{
+		{
+			Fp: filepath.Join(w.Dir, "nested", "world.db"),
+			Cond: &reaction.FileReactionCondition{
+				Directories: []string{w.Dir},
+				Matches:     &filesystem.FileMatcher{Glob: &filesystem.GlobMatcher{Value: []string{"**/*.db"}}},
+			},
+		},
+		{
+			Fp: filepath.Join(w.Dir, "world.db"),
+			Cond: &reaction.FileReactionCondition{
+				Directories: []string{w.Dir},
+				Matches:     &filesystem.FileMatcher{Name: "world.db"},
+				Op:          []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_update},
+			},
+		},
+	}
+
+	for i, v := range tests {
+		// -- Given
+		//
+		_ = os.MkdirAll(filepath.Dir(v.Fp), os.ModePerm)
+		_ = os.WriteFile(v.Fp, []byte(""), os.ModePerm)
+
+		// -- When
+		//
+		err := Wait(context.Background(), &WaitFor{File: v.Cond, Timeout: 50 * time.Millisecond})
+
+		// -- Then
+		//
+		w.ErrorIs(err, except.ErrTimeout, "test %d", i)
+		_ = os.Remove(v.Fp)
+	}
+}
+
+func (w *WaitTestSuite) TestWaitTcp() {
+	// -- Given
+	//
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !w.NoError(err) {
+		return
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	given := &WaitFor{
+		Tcp:      addr,
+		Timeout:  time.Second,
+		Interval: 10 * time.Millisecond,
+	}
+	listener := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l, _ := net.Listen("tcp", addr)
+		listener <- l
+	}()
+
+	// -- When
+	//
+	err = Wait(context.Background(), given)
+
+	// -- Then
+	//
+	w.NoError(err)
+	if l := <-listener; l != nil {
+		_ = l.Close()
+	}
+}
+
+func (w *WaitTestSuite) TestWaitHttp() {
+	// -- Given
+	//
+	calls := atomic.Int32{}
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+	given := &WaitFor{
+		Http:     s.URL,
+		Timeout:  time.Second,
+		Interval: 10 * time.Millisecond,
+	}
+
+	// -- When
+	//
+	err := Wait(context.Background(), given)
+
+	// -- Then
+	//
+	w.NoError(err)
+	w.Equal(int32(3), calls.Load())
+}
+
+func (w *WaitTestSuite) TestWaitLog() {
+	// -- Given
+	//
+	log := filepath.Join(w.Dir, "log.txt")
+	f, _ := os.Create(log)
+	defer f.Close()
+	given := &WaitFor{
+		Log:     &WaitForLog{Path: log, Regex: "Done \\(\\d+\\.\\d+s\\)!"},
+		Timeout: time.Second,
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = f.WriteString("Preparing spawn area\nDone (1.23s)! For help, type \"help\"\n")
+	}()
+
+	// -- When
+	//
+	err := Wait(context.Background(), given)
+
+	// -- Then
+	//
+	w.NoError(err)
+}
+
+func (w *WaitTestSuite) TestWaitTimeout() {
+	// -- Given
+	//
+	given := &WaitFor{
+		File: &reaction.FileReactionCondition{
+			Directories: []string{w.Dir},
+			Matches:     &filesystem.FileMatcher{Name: "never.txt"},
+		},
+		Timeout: 20 * time.Millisecond,
+	}
+
+	// -- When
+	//
+	err := Wait(context.Background(), given)
+
+	// -- Then
+	//
+	w.ErrorIs(err, except.ErrTimeout)
+}
+
+func (w *WaitTestSuite) TestWaitInvalid() {
+	// -- When
+	//
+	err := Wait(context.Background(), &WaitFor{})
+
+	// -- Then
+	//
+	w.ErrorIs(err, except.ErrInvalid)
+}
+
+func (w *WaitTestSuite) TestWaitHttpInvalidUrl() {
+	for _, v := range []string{"localhost:8080/health", "ftp://localhost/health", "http://", "http://%zz"} {
+		// -- When
+		//
+		err := Wait(context.Background(), &WaitFor{Http: v, Timeout: time.Minute})
+
+		// -- Then
+		//
+		w.ErrorIs(err, except.ErrInvalid, v)
+	}
+}
+
+func TestWaitTestSuite(t *testing.T) {
+	suite.Run(t, new(WaitTestSuite))
+}
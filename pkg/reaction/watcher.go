@@ -0,0 +1,340 @@
+package reaction
+
+import (
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WatchBackend is how directories are watched for changes.
+type WatchBackend int
+
+const (
+	// WatchBackendAuto uses inotify unless the directory is on a filesystem that doesn't deliver inotify events (e.g.
+	// NFS or FUSE) or inotify can't be used, in which case the directory is polled.
+	WatchBackendAuto WatchBackend = iota
+
+	// WatchBackendNotify always uses inotify.
+	WatchBackendNotify
+
+	// WatchBackendPoll scans the directories on an interval.
+	WatchBackendPoll
+)
+
+func (w WatchBackend) String() string {
+	switch w {
+	case WatchBackendNotify:
+		return "notify"
+	case WatchBackendPoll:
+		return "poll"
+	default:
+		return "auto"
+	}
+}
+
+type WatchFileOpts struct {
+	// Watch every subdirectory of the condition directories. Subdirectories created after the watch starts are watched
+	// as they appear and subdirectories that are removed stop being watched.
+	Recursive bool
+
+	// The max number of directories that will be watched. Once reached, or once the system's inotify watch limit is
+	// reached, new subdirectories are no longer watched. If zero, only the system limit applies.
+	MaxWatches int
+
+	// How the condition directories are watched. Defaults to WatchBackendAuto.
+	Backend WatchBackend
+
+	// Overrides the Backend for individual condition directories.
+	Backends map[string]WatchBackend
+
+	// How often directories are scanned when polling. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+}
+
+func (w WatchFileOpts) backend(dir string) WatchBackend {
+	dir = filepath.Clean(dir)
+	for k, v := range w.Backends {
+		if filepath.Clean(k) == dir {
+			return v
+		}
+	}
+	return w.Backend
+}
+
+// eventWatcher is a source of fsnotify events for a set of directories. Only the direct children of a directory are
+// watched.
+type eventWatcher interface {
+	Add(dir string) error
+	Remove(dir string) error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// notifyWatcher is an eventWatcher backed by inotify.
+type notifyWatcher struct {
+	Watcher *fsnotify.Watcher
+}
+
+func (n *notifyWatcher) Add(dir string) error {
+	return n.Watcher.Add(dir)
+}
+
+func (n *notifyWatcher) Remove(dir string) error {
+	return n.Watcher.Remove(dir)
+}
+
+func (n *notifyWatcher) Events() <-chan fsnotify.Event {
+	return n.Watcher.Events
+}
+
+func (n *notifyWatcher) Errors() <-chan error {
+	return n.Watcher.Errors
+}
+
+func (n *notifyWatcher) Close() error {
+	return n.Watcher.Close()
+}
+
+// watchSources lazily creates a dirWatcher per backend as the condition directories are added.
+type watchSources struct {
+	Opts WatchFileOpts
+
+	notify    *dirWatcher
+	notifyErr error
+	poll      *dirWatcher
+}
+
+// AddRoot watches the dir using the backend. If the backend is WatchBackendAuto and inotify can't be used for the dir,
+// the dir is polled instead.
+func (w *watchSources) AddRoot(dir string, backend WatchBackend) error {
+	switch backend {
+	case WatchBackendPoll:
+		return w.pollSource().AddRoot(dir)
+	case WatchBackendNotify:
+		src, err := w.notifySource()
+		if err != nil {
+			return err
+		}
+		return src.AddRoot(dir)
+	}
+
+	if !notifySupported(dir) {
+		logrus.WithField("directory", dir).Debug("Filesystem does not support inotify. Polling directory.")
+		return w.pollSource().AddRoot(dir)
+	}
+
+	src, err := w.notifySource()
+	if err == nil {
+		err = src.AddRoot(dir)
+		if err == nil {
+			return nil
+		}
+	}
+
+	logrus.WithError(err).WithField("directory", dir).Warn("Failed to watch directory with inotify. Polling directory.")
+	return w.pollSource().AddRoot(dir)
+}
+
+// List returns every dirWatcher that has been created.
+func (w *watchSources) List() []*dirWatcher {
+	out := make([]*dirWatcher, 0, 2)
+	if w.notify != nil {
+		out = append(out, w.notify)
+	}
+	if w.poll != nil {
+		out = append(out, w.poll)
+	}
+	return out
+}
+
+func (w *watchSources) Close() {
+	for _, v := range w.List() {
+		_ = v.Watcher.Close()
+	}
+}
+
+func (w *watchSources) notifySource() (*dirWatcher, error) {
+	if w.notify == nil && w.notifyErr == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			w.notifyErr = err
+		} else {
+			w.notify = newDirWatcher(&notifyWatcher{Watcher: watcher}, w.Opts)
+		}
+	}
+	return w.notify, w.notifyErr
+}
+
+func (w *watchSources) pollSource() *dirWatcher {
+	if w.poll == nil {
+		w.poll = newDirWatcher(newPollWatcher(w.Opts.PollInterval), w.Opts)
+	}
+	return w.poll
+}
+
+// dirWatcher tracks which directories are being watched by the eventWatcher so subdirectories can be added and
+// removed as they come and go.
+type dirWatcher struct {
+	Watcher eventWatcher
+	Opts    WatchFileOpts
+
+	watched  map[string]bool
+	roots    map[string]bool
+	limitHit bool
+}
+
+func newDirWatcher(w eventWatcher, opts WatchFileOpts) *dirWatcher {
+	return &dirWatcher{
+		Watcher: w,
+		Opts:    opts,
+		watched: map[string]bool{},
+		roots:   map[string]bool{},
+	}
+}
+
+// AddRoot watches one of the directories from a condition. Unlike subdirectories, failing to watch a root is an error.
+func (d *dirWatcher) AddRoot(dir string) error {
+	dir = filepath.Clean(dir)
+	err := d.add(dir)
+	if err != nil {
+		return err
+	}
+	d.roots[dir] = true
+
+	if d.Opts.Recursive {
+		d.addSubdirs(dir, nil)
+	}
+
+	return nil
+}
+
+// Handle keeps the watched directories in sync with the event. Any files found within a newly created directory are
+// returned as create events as they may have been written before the directory was watched.
+func (d *dirWatcher) Handle(ev fsnotify.Event) []fsnotify.Event {
+	if !d.Opts.Recursive {
+		return nil
+	}
+
+	name := filepath.Clean(ev.Name)
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		d.remove(name)
+		return nil
+	}
+
+	if ev.Op&fsnotify.Create == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(name)
+	if err != nil || !info.IsDir() || d.watched[name] {
+		return nil
+	}
+
+	if !d.addSub(name) {
+		return nil
+	}
+
+	found := make([]fsnotify.Event, 0)
+	d.addSubdirs(name, func(fp string) {
+		found = append(found, fsnotify.Event{Name: fp, Op: fsnotify.Create})
+	})
+
+	return found
+}
+
+func (d *dirWatcher) Len() int {
+	return len(d.watched)
+}
+
+func (d *dirWatcher) add(dir string) error {
+	logrus.WithField("directory", dir).Debug("Watching directory for triggers.")
+	err := d.Watcher.Add(dir)
+	if err != nil {
+		return err
+	}
+	d.watched[dir] = true
+	return nil
+}
+
+// addSub watches a subdirectory. If the limit for watched directories has been reached, the directory is skipped.
+func (d *dirWatcher) addSub(dir string) bool {
+	if d.limitHit {
+		return false
+	}
+
+	if d.Opts.MaxWatches > 0 && len(d.watched) >= d.Opts.MaxWatches {
+		d.reachedLimit(dir, nil)
+		return false
+	}
+
+	err := d.add(dir)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			d.reachedLimit(dir, err)
+		} else {
+			logrus.WithError(err).WithField("directory", dir).Warn("Failed to watch subdirectory.")
+		}
+		return false
+	}
+
+	return true
+}
+
+func (d *dirWatcher) reachedLimit(dir string, err error) {
+	d.limitHit = true
+	logrus.WithError(err).
+		WithField("directory", dir).
+		WithField("watched", len(d.watched)).
+		Warn("Reached the max number of watched directories. New subdirectories will not be watched.")
+}
+
+// addSubdirs watches every directory beneath the dir. If onFile is set, it's called for every file that's found.
+func (d *dirWatcher) addSubdirs(dir string, onFile func(fp string)) {
+	_ = filepath.WalkDir(dir, func(fp string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if !de.IsDir() {
+			if onFile != nil {
+				onFile(fp)
+			}
+			return nil
+		}
+
+		if fp == dir || d.watched[fp] {
+			return nil
+		}
+
+		if !d.addSub(fp) {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+}
+
+// remove stops watching the dir and everything beneath it. Roots are kept so they're watched again if they're recreated
+// and the backend supports it. The limit is lifted as space may have been freed up.
+func (d *dirWatcher) remove(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for k := range d.watched {
+		if d.roots[k] {
+			continue
+		}
+
+		if k == dir || strings.HasPrefix(k, prefix) {
+			// The watch may have already been removed by the kernel so the error is ignored.
+			_ = d.Watcher.Remove(k)
+			delete(d.watched, k)
+			d.limitHit = false
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package reaction
+
+import (
+	"syscall"
+)
+
+// Filesystems where changes can be made without going through the local kernel so inotify never sees them.
+var noNotifyFilesystems = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xfe534d42: true, // SMB2
+	0xff534d42: true, // CIFS
+	0x65735546: true, // FUSE
+	0x01021997: true, // 9P
+}
+
+// notifySupported checks whether inotify will deliver events for changes within the dir.
+func notifySupported(dir string) bool {
+	st := syscall.Statfs_t{}
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return true
+	}
+
+	return !noNotifyFilesystems[uint32(st.Type)]
+}
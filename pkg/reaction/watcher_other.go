@@ -0,0 +1,9 @@
+//go:build !linux
+
+package reaction
+
+// notifySupported checks whether inotify will deliver events for changes within the dir. Filesystems are only
+// inspected on Linux.
+func notifySupported(_ string) bool {
+	return true
+}
@@ -0,0 +1,309 @@
+package reaction
+
+import (
+	"context"
+	"github.com/bxcodec/faker/v3"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type WatcherTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (w *WatcherTestSuite) BeforeTest(_, _ string) {
+	w.Dir = filepath.Join(os.TempDir(), faker.Username())
+	_ = os.MkdirAll(w.Dir, os.ModePerm)
+}
+
+func (w *WatcherTestSuite) AfterTest(_, _ string) {
+	_ = os.RemoveAll(w.Dir)
+}
+
+func (w *WatcherTestSuite) TestWatchFileRecursive() {
+	// -- Given
+	//
+	_ = os.MkdirAll(filepath.Join(w.Dir, "worlds", "existing"), os.ModePerm)
+	lock := sync.Mutex{}
+	actual := map[string]bool{}
+	cond := &reaction.FileReactionCondition{
+		Directories: []string{w.Dir},
+		Matches:     &filesystem.FileMatcher{Glob: &filesystem.GlobMatcher{Value: []string{"**/*.mca"}}},
+		Op:          []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_create},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	_, err := WatchFileWithOpts(ctx, func(event fsnotify.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		actual[event.Name] = true
+	}, WatchFileOpts{Recursive: true}, cond)
+	if !w.NoError(err) {
+		return
+	}
+
+	existing := filepath.Join(w.Dir, "worlds", "existing", "r.0.0.mca")
+	_ = os.WriteFile(existing, []byte("region"), os.ModePerm)
+
+	// Created alongside its parent so the file may be written before the new directory is watched.
+	created := filepath.Join(w.Dir, "worlds", "new", "region", "r.1.0.mca")
+	_ = os.MkdirAll(filepath.Dir(created), os.ModePerm)
+	_ = os.WriteFile(created, []byte("region"), os.ModePerm)
+
+	// -- Then
+	//
+	w.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return actual[existing] && actual[created]
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (w *WatcherTestSuite) TestWatchFileNotRecursive() {
+	// -- Given
+	//
+	_ = os.MkdirAll(filepath.Join(w.Dir, "nested"), os.ModePerm)
+	lock := sync.Mutex{}
+	actual := make([]string, 0)
+	cond := &reaction.FileReactionCondition{Directories: []string{w.Dir}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	_, err := WatchFile(ctx, func(event fsnotify.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		actual = append(actual, event.Name)
+	}, cond)
+	if !w.NoError(err) {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(w.Dir, "nested", "a.txt"), []byte("a"), os.ModePerm)
+	_ = os.WriteFile(filepath.Join(w.Dir, "b.txt"), []byte("b"), os.ModePerm)
+
+	// -- Then
+	//
+	w.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(actual) > 0
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	w.NotContains(actual, filepath.Join(w.Dir, "nested", "a.txt"))
+	w.Contains(actual, filepath.Join(w.Dir, "b.txt"))
+}
+
+func (w *WatcherTestSuite) TestDirWatcher() {
+	// -- Given
+	//
+	_ = os.MkdirAll(filepath.Join(w.Dir, "a", "b", "c"), os.ModePerm)
+	_ = os.MkdirAll(filepath.Join(w.Dir, "d"), os.ModePerm)
+	watcher, _ := fsnotify.NewWatcher()
+	defer watcher.Close()
+	given := newDirWatcher(&notifyWatcher{Watcher: watcher}, WatchFileOpts{Recursive: true})
+
+	// -- When
+	//
+	err := given.AddRoot(w.Dir)
+
+	// -- Then
+	//
+	if w.NoError(err) {
+		w.Equal(5, given.Len())
+		given.Handle(fsnotify.Event{Name: filepath.Join(w.Dir, "a"), Op: fsnotify.Remove})
+		w.Equal(2, given.Len())
+
+		_ = os.MkdirAll(filepath.Join(w.Dir, "e", "f"), os.ModePerm)
+		_ = os.WriteFile(filepath.Join(w.Dir, "e", "f", "g.txt"), []byte(""), os.ModePerm)
+		found := given.Handle(fsnotify.Event{Name: filepath.Join(w.Dir, "e"), Op: fsnotify.Create})
+		w.Equal(4, given.Len())
+		w.Equal([]fsnotify.Event{{Name: filepath.Join(w.Dir, "e", "f", "g.txt"), Op: fsnotify.Create}}, found)
+	}
+}
+
+func (w *WatcherTestSuite) TestDirWatcherMaxWatches() {
+	// -- Given
+	//
+	_ = os.MkdirAll(filepath.Join(w.Dir, "a", "b", "c"), os.ModePerm)
+	watcher, _ := fsnotify.NewWatcher()
+	defer watcher.Close()
+	given := newDirWatcher(&notifyWatcher{Watcher: watcher}, WatchFileOpts{Recursive: true, MaxWatches: 2})
+
+	// -- When
+	//
+	err := given.AddRoot(w.Dir)
+
+	// -- Then
+	//
+	if w.NoError(err) {
+		w.Equal(2, given.Len())
+		_ = os.MkdirAll(filepath.Join(w.Dir, "d"), os.ModePerm)
+		given.Handle(fsnotify.Event{Name: filepath.Join(w.Dir, "d"), Op: fsnotify.Create})
+		w.Equal(2, given.Len())
+	}
+}
+
+func (w *WatcherTestSuite) TestWatchFilePoll() {
+	// -- Given
+	//
+	fp := filepath.Join(w.Dir, "save.dat")
+	_ = os.WriteFile(filepath.Join(w.Dir, "existing.dat"), []byte(""), os.ModePerm)
+	events := make(chan fsnotify.Event, 10)
+	cond := &reaction.FileReactionCondition{Directories: []string{w.Dir}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	_, err := WatchFileWithOpts(ctx, func(event fsnotify.Event) {
+		events <- event
+	}, WatchFileOpts{Backend: WatchBackendPoll, PollInterval: 10 * time.Millisecond}, cond)
+	if !w.NoError(err) {
+		return
+	}
+
+	// -- Then
+	//
+	_ = os.WriteFile(fp, []byte("a"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Create}, <-events)
+
+	_ = os.WriteFile(fp, []byte("ab"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Write}, <-events)
+
+	replacement := filepath.Join(w.Dir, "save.tmp")
+	_ = os.WriteFile(replacement, []byte("ab"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: replacement, Op: fsnotify.Create}, <-events)
+	_ = os.Rename(replacement, fp)
+	w.ElementsMatch([]fsnotify.Event{
+		{Name: fp, Op: fsnotify.Create},
+		{Name: replacement, Op: fsnotify.Remove},
+	}, []fsnotify.Event{<-events, <-events})
+
+	_ = os.Remove(fp)
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Remove}, <-events)
+}
+
+func (w *WatcherTestSuite) TestWatchFilePollRootRecreated() {
+	// -- Given
+	//
+	root := filepath.Join(w.Dir, "saves")
+	fp := filepath.Join(root, "save.dat")
+	events := make(chan fsnotify.Event, 10)
+	cond := &reaction.FileReactionCondition{
+		Directories: []string{root},
+		Matches:     &filesystem.FileMatcher{Glob: &filesystem.GlobMatcher{Value: []string{"**/*.dat"}}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := WatchFileWithOpts(ctx, func(event fsnotify.Event) {
+		events <- event
+	}, WatchFileOpts{
+		Recursive:    true,
+		Backends:     map[string]WatchBackend{root: WatchBackendPoll},
+		PollInterval: 10 * time.Millisecond,
+	}, proto.Clone(cond).(*reaction.FileReactionCondition))
+	w.Require().NoError(err)
+
+	// -- When
+	//
+	_ = os.WriteFile(fp, []byte("a"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Create}, <-events)
+	_ = os.RemoveAll(root)
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Remove}, <-events)
+	_ = os.MkdirAll(root, os.ModePerm)
+	_ = os.WriteFile(fp, []byte("b"), os.ModePerm)
+
+	// -- Then
+	//
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Create}, <-events)
+	_ = os.WriteFile(fp, []byte("bc"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: fp, Op: fsnotify.Write}, <-events)
+}
+
+func (w *WatcherTestSuite) TestWatchFilePollRecursive() {
+	// -- Given
+	//
+	events := make(chan fsnotify.Event, 10)
+	cond := &reaction.FileReactionCondition{
+		Directories: []string{w.Dir},
+		Matches:     &filesystem.FileMatcher{Glob: &filesystem.GlobMatcher{Value: []string{"**/*.mca"}}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -- When
+	//
+	_, err := WatchFileWithOpts(ctx, func(event fsnotify.Event) {
+		events <- event
+	}, WatchFileOpts{
+		Recursive:    true,
+		Backends:     map[string]WatchBackend{w.Dir + "/": WatchBackendPoll},
+		PollInterval: 10 * time.Millisecond,
+	}, cond)
+	if !w.NoError(err) {
+		return
+	}
+
+	// -- Then
+	//
+	created := filepath.Join(w.Dir, "worlds", "region", "r.0.0.mca")
+	_ = os.MkdirAll(filepath.Dir(created), os.ModePerm)
+	_ = os.WriteFile(created, []byte("region"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: created, Op: fsnotify.Create}, <-events)
+
+	_ = os.WriteFile(created, []byte("region2"), os.ModePerm)
+	w.Equal(fsnotify.Event{Name: created, Op: fsnotify.Write}, <-events)
+}
+
+func (w *WatcherTestSuite) TestDiffDir() {
+	// -- Given
+	//
+	now := time.Now()
+	prev := map[string]pollEntry{
+		"removed":  {Size: 1, ModTime: now, Inode: 1},
+		"same":     {Size: 1, ModTime: now, Inode: 2},
+		"written":  {Size: 1, ModTime: now, Inode: 3},
+		"replaced": {Size: 1, ModTime: now, Inode: 4},
+		"dir":      {ModTime: now, Inode: 5, IsDir: true},
+	}
+	cur := map[string]pollEntry{
+		"same":     {Size: 1, ModTime: now, Inode: 2},
+		"written":  {Size: 1, ModTime: now.Add(time.Second), Inode: 3},
+		"replaced": {Size: 1, ModTime: now, Inode: 6},
+		"dir":      {ModTime: now.Add(time.Second), Inode: 5, IsDir: true},
+		"created":  {Size: 1, ModTime: now, Inode: 7},
+	}
+
+	// -- When
+	//
+	actual := diffDir("root", prev, cur)
+
+	// -- Then
+	//
+	w.Equal([]fsnotify.Event{
+		{Name: filepath.Join("root", "created"), Op: fsnotify.Create},
+		{Name: filepath.Join("root", "removed"), Op: fsnotify.Remove},
+		{Name: filepath.Join("root", "replaced"), Op: fsnotify.Create},
+		{Name: filepath.Join("root", "written"), Op: fsnotify.Write},
+	}, actual)
+}
+
+func TestWatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(WatcherTestSuite))
+}
@@ -0,0 +1,123 @@
+package replay
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+var _ actions2.Client = &FakeClient{}
+
+// Call is an action that was executed by the FakeClient.
+type Call struct {
+	// The name of the actions.Client method e.g. Upload.
+	Method string
+
+	// The action passed to the method e.g. *actions.UploadFile.
+	Action any
+}
+
+// FakeClient is an actions.Client that records every action instead of executing it.
+type FakeClient struct {
+	// Called with every action that's executed.
+	OnCall func(c *Call)
+
+	lock  sync.Mutex
+	calls []*Call
+}
+
+// Calls are every action executed in order.
+func (f *FakeClient) Calls() []*Call {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]*Call(nil), f.calls...)
+}
+
+func (f *FakeClient) Rename(r *actions.RenameFiles) error {
+	f.record("Rename", r)
+	return nil
+}
+
+func (f *FakeClient) Unzip(file *actions.UnzipFile) error {
+	f.record("Unzip", file)
+	return nil
+}
+
+func (f *FakeClient) Extract(file *actions.ExtractFiles) error {
+	f.record("Extract", file)
+	return nil
+}
+
+func (f *FakeClient) Download(_ string, dl *actions.DownloadFile, _ actions2.DownloadOpts) error {
+	f.record("Download", dl)
+	return nil
+}
+
+func (f *FakeClient) Upload(_ string, u *actions.UploadFile, _ actions2.UploadOpts) error {
+	f.record("Upload", u)
+	return nil
+}
+
+func (f *FakeClient) Zip(z *actions.ZipFile) error {
+	f.record("Zip", z)
+	return nil
+}
+
+func (f *FakeClient) MoveFile(a *actions.MoveFile) error {
+	f.record("MoveFile", a)
+	return nil
+}
+
+func (f *FakeClient) Shell(_ context.Context, a *actions.Shell) ([]byte, error) {
+	f.record("Shell", a)
+	return nil, nil
+}
+
+func (f *FakeClient) Fetch(_ context.Context, fetch *actions2.FetchFile, _ actions2.FetchOpts) error {
+	f.record("Fetch", fetch)
+	return nil
+}
+
+func (f *FakeClient) record(method string, a any) {
+	c := &Call{Method: method, Action: a}
+
+	f.lock.Lock()
+	f.calls = append(f.calls, c)
+	f.lock.Unlock()
+
+	if f.OnCall != nil {
+		f.OnCall(c)
+	}
+}
+
+// FakeAppClient is an app.AppServiceClient that records every saved variable. Only SetVariable is implemented.
+type FakeAppClient struct {
+	app.AppServiceClient
+
+	// Called with every variable that's saved.
+	OnSetVariable func(req *app.SetVariable_Request)
+
+	lock      sync.Mutex
+	variables []*app.SetVariable_Request
+}
+
+// Variables are every saved variable in order.
+func (f *FakeAppClient) Variables() []*app.SetVariable_Request {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]*app.SetVariable_Request(nil), f.variables...)
+}
+
+func (f *FakeAppClient) SetVariable(_ context.Context, in *app.SetVariable_Request, _ ...grpc.CallOption) (*app.SetVariable_Response, error) {
+	f.lock.Lock()
+	f.variables = append(f.variables, in)
+	f.lock.Unlock()
+
+	if f.OnSetVariable != nil {
+		f.OnSetVariable(in)
+	}
+	return &app.SetVariable_Response{}, nil
+}
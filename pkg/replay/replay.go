@@ -0,0 +1,447 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/app"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	reaction2 "github.com/hostfactor/diazo/pkg/reaction"
+	"github.com/hostfactor/diazo/pkg/variable"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Step is a log line or file event that's fed through the reactions. Only one of Line or File should be set.
+type Step struct {
+	// How long after the previous step the line was logged or the file changed.
+	After time.Duration
+
+	Line string
+	File *fsnotify.Event
+}
+
+// Config is the reactions that are replayed.
+type Config struct {
+	LogReactions []*reaction.LogReaction
+
+	// Log reactions that were already compiled e.g. ones with a composite Condition. Their conditions keep their state
+	// between replays so they should be compiled for each replay.
+	Logs []*reaction2.CompiledLogReaction
+
+	Files []*reaction.FileReaction
+}
+
+type Opts struct {
+	// The store the reactions start with. It's updated by the replay. Defaults to an empty store.
+	Store variable.Store
+
+	// When the first step happens. Defaults to now.
+	Start time.Time
+
+	// Configures how the actions are executed. The FakeClient and FakeAppClient are always used to execute them and
+	// app commands are only recorded so Actions.AppClient and Actions.OnAppCommand are ignored. File events go through
+	// the Debounce, Settle and Limit of Actions.File the same as ExecuteFile. Actions.File.Queue is ignored as nothing
+	// is executed concurrently.
+	Actions reaction2.ActionOpts
+
+	// Groups the lines the same as ExecuteLogOpts.Group.
+	Group *reaction2.GroupLinesOpts
+}
+
+// Event is a reaction that fired.
+type Event struct {
+	// When the reaction fired.
+	At time.Time
+
+	// The index of the Step that fired the reaction.
+	Step int
+
+	// The name of the reaction e.g. log/0 or file/1. Log reactions are numbered in the order of
+	// Config.LogReactions then Config.Logs.
+	Reaction string
+
+	// The line or the path of the file that fired the reaction.
+	Line string
+	File string
+
+	Matches   []string
+	Calls     []*Call
+	Variables []*app.SetVariable_Request
+	Statuses  []actions.SetStatus_Status
+
+	// The compiled app commands that would have been sent to the app.
+	AppCommands []string
+
+	// Why the actions failed.
+	Err error
+}
+
+func (e *Event) String() string {
+	out := fmt.Sprintf("%s %s", e.At.Format("15:04:05.000"), e.Reaction)
+	if e.File != "" {
+		out += fmt.Sprintf(" file=%q", e.File)
+	} else {
+		out += fmt.Sprintf(" line=%q", e.Line)
+	}
+
+	for _, v := range e.Calls {
+		out += " " + v.Method
+	}
+
+	for _, v := range e.Variables {
+		out += fmt.Sprintf(" %s=%q", v.GetName(), v.GetValue())
+	}
+
+	for _, v := range e.Statuses {
+		out += " status=" + v.String()
+	}
+
+	for _, v := range e.AppCommands {
+		out += fmt.Sprintf(" app_command=%q", v)
+	}
+
+	if e.Err != nil {
+		out += " err=" + e.Err.Error()
+	}
+
+	return out
+}
+
+type Result struct {
+	// Every reaction that fired in order.
+	Timeline []*Event
+
+	// The store after every step was replayed.
+	Store variable.Store
+
+	// Every status change in order.
+	Statuses []actions.SetStatus_Status
+
+	// Every app command in order.
+	AppCommands []string
+
+	Calls     []*Call
+	Variables []*app.SetVariable_Request
+}
+
+// WriteTimeline writes each Event of the Timeline on its own line e.g. for a CLI.
+func (r *Result) WriteTimeline(w io.Writer) error {
+	for _, v := range r.Timeline {
+		_, err := fmt.Fprintln(w, v.String())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayLog replays every line of the log as if each was logged the interval after the last.
+func ReplayLog(ctx context.Context, conf Config, r io.Reader, interval time.Duration, opts Opts) (*Result, error) {
+	steps, err := LogSteps(r, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	return Replay(ctx, conf, steps, opts)
+}
+
+// LogSteps reads every line of the log as a Step the interval after the last.
+func LogSteps(r io.Reader, interval time.Duration) ([]*Step, error) {
+	out := make([]*Step, 0)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			out = append(out, &Step{
+				After: interval,
+				Line:  strings.TrimRight(line, "\r\n"),
+			})
+		}
+
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Replay feeds every step through the reactions in order using a FakeClient and FakeAppClient. Nothing is actually
+// executed so a replay is safe to run against any blueprint.
+//
+// Time only passes between steps so a replay is deterministic. Deferred work e.g. a trailing fire, a debounced file or a
+// group of lines happens once the replayed time reaches it. Anything still deferred after the last step happens as if
+// the time kept passing.
+func Replay(ctx context.Context, conf Config, steps []*Step, opts Opts) (*Result, error) {
+	// Every run compiles its own reactions so nothing is shared with other runs.
+	logs, err := reaction2.CompileLogReactions(conf.LogReactions...)
+	if err != nil {
+		return nil, err
+	}
+	logs = append(logs, conf.Logs...)
+
+	start := opts.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	// Stops the limits, debounces and settles of this run.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &replayer{
+		Result:    &Result{Store: opts.Store},
+		Names:     make(map[*reaction2.CompiledLogReaction]string, len(logs)),
+		Clock:     reaction2.NewManualClock(start),
+		fileSteps: map[string]int{},
+		modified:  map[string]time.Time{},
+	}
+
+	for i, v := range logs {
+		r.Names[v] = fmt.Sprintf("log/%d", i)
+	}
+
+	if r.Result.Store == nil {
+		r.Result.Store = variable.NewStore()
+	}
+
+	r.Client = &FakeClient{OnCall: r.onCall}
+	r.AppClient = &FakeAppClient{OnSetVariable: r.onSetVariable}
+	r.Actions = opts.Actions
+	r.Actions.File.Client = r.Client
+	r.Actions.AppClient = r.AppClient
+	r.Actions.OnAppCommand = r.onAppCommand
+
+	reactor := reaction2.NewLogReactor(ctx, r.Result.Store, r.AppClient, logs, reaction2.ExecuteLogOpts{
+		Actions:        r.Actions,
+		Clock:          r.Clock,
+		OnMatch:        r.onMatch,
+		OnStatusChange: r.onStatusChange,
+	})
+
+	r.Line = func(ll reaction2.LogLine) {
+		r.current = nil
+		err := reactor.React(ll)
+		if err != nil && r.current != nil {
+			r.current.Err = err
+		}
+	}
+
+	if opts.Group != nil {
+		r.Line, err = reaction2.GroupLinesWithClock(ctx, r.Clock, *opts.Group, r.Line)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fileOpts := r.Actions.File
+	fileOpts.Clock = r.Clock
+	fileOpts.Settle.Stat = r.stat
+	for i, v := range conf.Files {
+		i, v := i, v
+		r.Files = append(r.Files, &replayedFile{
+			Reaction: v,
+			Fn: reaction2.FileEventFunc(ctx, fileOpts, func(ev fsnotify.Event) {
+				r.file(i, v, ev)
+			}),
+		})
+	}
+
+	for i, v := range steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		r.Clock.Advance(v.After)
+		if v.File != nil {
+			r.fileStep(i, *v.File)
+		} else {
+			r.Line(reaction2.LogLine{Text: v.Line, Num: i + 1})
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		at, ok := r.Clock.Next()
+		if !ok {
+			break
+		}
+		r.Clock.Set(at)
+	}
+
+	r.Result.Calls = r.Client.Calls()
+	r.Result.Variables = r.AppClient.Variables()
+	return r.Result, nil
+}
+
+type replayer struct {
+	Result    *Result
+	Names     map[*reaction2.CompiledLogReaction]string
+	Files     []*replayedFile
+	Line      reaction2.WatchLogFunc
+	Client    *FakeClient
+	AppClient *FakeAppClient
+	Actions   reaction2.ActionOpts
+	Clock     *reaction2.ManualClock
+
+	// The step of the latest event of each file.
+	fileSteps map[string]int
+
+	// When each file that exists was last modified.
+	modified map[string]time.Time
+
+	// The event that any calls, variables and statuses belong to.
+	current *Event
+}
+
+type replayedFile struct {
+	Reaction *reaction.FileReaction
+	Fn       reaction2.WatchFileFunc
+}
+
+func (r *replayer) fileStep(step int, ev fsnotify.Event) {
+	r.fileSteps[ev.Name] = step
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(r.modified, ev.Name)
+	} else {
+		r.modified[ev.Name] = r.Clock.Now()
+	}
+
+	for _, v := range r.Files {
+		if matchesAny(ev, v.Reaction.GetWhen()...) {
+			v.Fn(ev)
+		}
+	}
+}
+
+func (r *replayer) file(idx int, rx *reaction.FileReaction, ev fsnotify.Event) {
+	r.fire(&Event{
+		Step:     r.fileSteps[ev.Name],
+		Reaction: fmt.Sprintf("file/%d", idx),
+		File:     ev.Name,
+	})
+
+	for _, act := range rx.GetThen() {
+		err := reaction2.ExecuteFileReactionAction(ev.Name, r.Actions.Root, r.Result.Store, act, r.Actions.File)
+		if err != nil {
+			r.current.Err = err
+			break
+		}
+	}
+}
+
+// stat is a file that was modified by its latest event. Files are never written to so they're settled once no new
+// events are replayed for them.
+func (r *replayer) stat(fp string) (os.FileInfo, error) {
+	at, ok := r.modified[fp]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: fp, Err: fs.ErrNotExist}
+	}
+	return &replayedFileInfo{name: filepath.Base(fp), modTime: at}, nil
+}
+
+func (r *replayer) onMatch(ll reaction2.LogLine, m *reaction2.LogMatch) {
+	r.fire(&Event{
+		Step:     ll.Num - 1,
+		Reaction: r.Names[m.Reaction],
+		Line:     ll.Text,
+		Matches:  m.RegexMatches,
+	})
+}
+
+func (r *replayer) onStatusChange(s actions.SetStatus_Status) {
+	r.Result.Statuses = append(r.Result.Statuses, s)
+	if r.current != nil {
+		r.current.Statuses = append(r.current.Statuses, s)
+	}
+}
+
+func (r *replayer) fire(e *Event) {
+	e.At = r.Clock.Now()
+	r.current = e
+	r.Result.Timeline = append(r.Result.Timeline, e)
+}
+
+func (r *replayer) onCall(c *Call) {
+	if r.current != nil {
+		r.current.Calls = append(r.current.Calls, c)
+	}
+}
+
+func (r *replayer) onAppCommand(cmd []byte) error {
+	r.Result.AppCommands = append(r.Result.AppCommands, string(cmd))
+	if r.current != nil {
+		r.current.AppCommands = append(r.current.AppCommands, string(cmd))
+	}
+	return nil
+}
+
+func (r *replayer) onSetVariable(req *app.SetVariable_Request) {
+	if r.current != nil {
+		r.current.Variables = append(r.current.Variables, req)
+	}
+}
+
+type replayedFileInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (r *replayedFileInfo) Name() string {
+	return r.name
+}
+
+func (r *replayedFileInfo) Size() int64 {
+	return 0
+}
+
+func (r *replayedFileInfo) Mode() fs.FileMode {
+	return 0644
+}
+
+func (r *replayedFileInfo) ModTime() time.Time {
+	return r.modTime
+}
+
+func (r *replayedFileInfo) IsDir() bool {
+	return false
+}
+
+func (r *replayedFileInfo) Sys() any {
+	return nil
+}
+
+func matchesAny(ev fsnotify.Event, conds ...*reaction.FileReactionCondition) bool {
+	for _, v := range conds {
+		if inDirs(ev.Name, v.GetDirectories()...) && reaction2.FileReactionCondition(ev, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDirs checks if the file is within any of the dirs as the watcher would only see those files.
+func inDirs(fp string, dirs ...string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+
+	for _, v := range dirs {
+		rel, err := filepath.Rel(v, fp)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,413 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hostfactor/api/go/blueprint/actions"
+	"github.com/hostfactor/api/go/blueprint/appcommand"
+	"github.com/hostfactor/api/go/blueprint/filesystem"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	actions2 "github.com/hostfactor/diazo/pkg/actions"
+	"github.com/hostfactor/diazo/pkg/appcmd"
+	reaction2 "github.com/hostfactor/diazo/pkg/reaction"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ReplayTestSuite struct {
+	suite.Suite
+
+	Start time.Time
+}
+
+func (r *ReplayTestSuite) BeforeTest(_, _ string) {
+	r.Start = time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func (r *ReplayTestSuite) TestReplayLog() {
+	// -- Given
+	//
+	log := strings.Join([]string{
+		"Starting minecraft server version 1.20.1",
+		"ERROR Cannot keep up",
+		"Preparing spawn area",
+		"ERROR Cannot keep up",
+		"Done (3.2s)! For help, type help",
+	}, "\n")
+	rate, err := reaction2.Regex(`ERROR (.*)`)
+	r.Require().NoError(err)
+	conf := Config{
+		LogReactions: []*reaction.LogReaction{
+			{
+				When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: `server version (.*)`}}},
+				Then: []*reaction.LogReactionAction{
+					{SetVariable: &actions.SetVariable{Name: "version", Value: "{{first_match}}", Save: true}},
+				},
+			},
+			{
+				When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: `Done \((.*)\)! For help`}}},
+				Then: []*reaction.LogReactionAction{
+					{SetStatus: &actions.SetStatus{Status: actions.SetStatus_ready}},
+				},
+			},
+		},
+		Logs: []*reaction2.CompiledLogReaction{
+			{
+				Condition: reaction2.Rate(rate, 2, 25*time.Second),
+				Then: []*reaction.LogReactionAction{
+					{SetVariable: &actions.SetVariable{Name: "lagging", Value: "{{first_match}}"}},
+				},
+			},
+		},
+	}
+
+	// -- When
+	//
+	actual, err := ReplayLog(context.Background(), conf, strings.NewReader(log), 10*time.Second, Opts{Start: r.Start})
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Equal([]string{"log/0", "log/2", "log/1"}, r.reactions(actual.Timeline))
+		r.Equal([]int{0, 3, 4}, r.steps(actual.Timeline))
+		r.Equal(r.Start.Add(50*time.Second), actual.Timeline[2].At)
+		r.Equal([]actions.SetStatus_Status{actions.SetStatus_ready}, actual.Timeline[2].Statuses)
+		r.Equal([]actions.SetStatus_Status{actions.SetStatus_ready}, actual.Statuses)
+		if r.Len(actual.Variables, 1) {
+			r.Equal("version", actual.Variables[0].GetName())
+			r.Equal("1.20.1", actual.Variables[0].GetValue())
+		}
+		r.Equal("1.20.1", actual.Store.GetStringValue("version"))
+		r.Equal("Cannot keep up", actual.Store.GetStringValue("lagging"))
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayLogRateWindow() {
+	// -- Given
+	//
+	rate, err := reaction2.Regex(`ERROR`)
+	r.Require().NoError(err)
+	conf := Config{
+		Logs: []*reaction2.CompiledLogReaction{
+			{
+				Condition: reaction2.Rate(rate, 2, 5*time.Second),
+				Then: []*reaction.LogReactionAction{
+					{SetVariable: &actions.SetVariable{Name: "lagging", Value: "true"}},
+				},
+			},
+		},
+	}
+
+	// -- When
+	//
+	actual, err := ReplayLog(context.Background(), conf, strings.NewReader("ERROR\nERROR\nERROR\n"), 10*time.Second, Opts{Start: r.Start})
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Empty(actual.Timeline)
+		r.Empty(actual.Store.GetStringValue("lagging"))
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayFiles() {
+	// -- Given
+	//
+	conf := Config{
+		Files: []*reaction.FileReaction{
+			{
+				When: []*reaction.FileReactionCondition{
+					{
+						Directories: []string{"/saves"},
+						Op:          []reaction.FileReactionCondition_FileOp{reaction.FileReactionCondition_create},
+					},
+				},
+				Then: []*reaction.FileReactionAction{
+					{
+						Upload: &actions.UploadFile{
+							From: &actions.UploadFile_Source{Path: "{{abs}}"},
+							To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{filename}}"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	steps := []*Step{
+		{File: &fsnotify.Event{Name: "/saves/world.zip", Op: fsnotify.Create}},
+		{After: time.Second, File: &fsnotify.Event{Name: "/saves/world.zip", Op: fsnotify.Write}},
+		{After: time.Second, File: &fsnotify.Event{Name: "/other/world.zip", Op: fsnotify.Create}},
+		{After: time.Second, File: &fsnotify.Event{Name: "/saves/nether/region.zip", Op: fsnotify.Create}},
+	}
+
+	// -- When
+	//
+	actual, err := Replay(context.Background(), conf, steps, Opts{Start: r.Start})
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Equal([]int{0, 3}, r.steps(actual.Timeline))
+		r.Equal("/saves/nether/region.zip", actual.Timeline[1].File)
+		if r.Len(actual.Timeline[1].Calls, 1) {
+			r.Equal("Upload", actual.Timeline[1].Calls[0].Method)
+			r.Equal("region.zip", actual.Timeline[1].Calls[0].Action.(*actions.UploadFile).GetTo().GetBucketFile().GetName())
+		}
+		r.Len(actual.Calls, 2)
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayLogTrailing() {
+	// -- Given
+	//
+	cond, err := reaction2.Regex(`ERROR (\w+)`)
+	r.Require().NoError(err)
+	conf := Config{
+		Logs: []*reaction2.CompiledLogReaction{
+			{
+				Condition: cond,
+				Limit:     reaction2.LimitOpts{Cooldown: 30 * time.Second, Edge: reaction2.EdgeBoth},
+				Then: []*reaction.LogReactionAction{
+					{SetVariable: &actions.SetVariable{Name: "last_error", Value: "{{first_match}}"}},
+				},
+			},
+		},
+	}
+
+	// -- When
+	//
+	actual, err := ReplayLog(context.Background(), conf, strings.NewReader("ERROR a\nERROR b\nERROR c\n"), 10*time.Second, Opts{Start: r.Start})
+
+	// -- Then
+	//
+	if r.NoError(err) && r.Len(actual.Timeline, 2) {
+		r.Equal([]int{0, 2}, r.steps(actual.Timeline))
+		r.Equal(r.Start.Add(10*time.Second), actual.Timeline[0].At)
+		r.Equal(r.Start.Add(40*time.Second), actual.Timeline[1].At)
+		r.Equal("c", actual.Store.GetStringValue("last_error"))
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayLimitsPerRun() {
+	// -- Given
+	//
+	cond, err := reaction2.Regex(`ERROR`)
+	r.Require().NoError(err)
+	conf := Config{
+		Logs: []*reaction2.CompiledLogReaction{
+			{Condition: cond, Limit: reaction2.LimitOpts{Cooldown: time.Hour}},
+		},
+	}
+
+	// -- When
+	//
+	first, err := ReplayLog(context.Background(), conf, strings.NewReader("ERROR\nERROR\n"), time.Second, Opts{Start: r.Start})
+	r.Require().NoError(err)
+	second, err := ReplayLog(context.Background(), conf, strings.NewReader("ERROR\nERROR\n"), time.Second, Opts{Start: r.Start})
+
+	// -- Then
+	//
+	if r.NoError(err) {
+		r.Len(first.Timeline, 1)
+		r.Len(second.Timeline, 1)
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayFilesDebouncedAndSettled() {
+	// -- Given
+	//
+	conf := Config{
+		Files: []*reaction.FileReaction{
+			{
+				When: []*reaction.FileReactionCondition{{Directories: []string{"/saves"}}},
+				Then: []*reaction.FileReactionAction{
+					{
+						Upload: &actions.UploadFile{
+							From: &actions.UploadFile_Source{Path: "{{abs}}"},
+							To:   &filesystem.FileLocation{BucketFile: &filesystem.BucketFile{Name: "{{filename}}"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	steps := []*Step{
+		{File: &fsnotify.Event{Name: "/saves/world.zip", Op: fsnotify.Create}},
+		{After: time.Second, File: &fsnotify.Event{Name: "/saves/world.zip", Op: fsnotify.Write}},
+		{After: time.Second, File: &fsnotify.Event{Name: "/saves/world.zip", Op: fsnotify.Write}},
+		{After: time.Minute, Line: "Saved the game"},
+	}
+	opts := Opts{Start: r.Start}
+	opts.Actions.File.Debounce = 5 * time.Second
+	opts.Actions.File.Settle = reaction2.SettleOpts{Stable: 2 * time.Second}
+
+	// -- When
+	//
+	actual, err := Replay(context.Background(), conf, steps, opts)
+
+	// -- Then
+	//
+	if r.NoError(err) && r.Len(actual.Timeline, 1) {
+		r.Equal(2, actual.Timeline[0].Step)
+		r.Equal(r.Start.Add(9*time.Second), actual.Timeline[0].At)
+		r.Len(actual.Calls, 1)
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayLogGrouped() {
+	// -- Given
+	//
+	conf := Config{
+		LogReactions: []*reaction.LogReaction{
+			{
+				When: []*reaction.LogReactionCondition{{Matches: &reaction.LogMatcher{Regex: `(?s)Exception.*at (\w+)$`}}},
+				Then: []*reaction.LogReactionAction{
+					{SetVariable: &actions.SetVariable{Name: "crashed_at", Value: "{{first_match}}"}},
+				},
+			},
+		},
+	}
+	log := "Exception in thread main\n  at world\n  at tick\nRestarting\n"
+
+	// -- When
+	//
+	actual, err := ReplayLog(context.Background(), conf, strings.NewReader(log), 100*time.Millisecond, Opts{
+		Start: r.Start,
+		Group: &reaction2.GroupLinesOpts{Continuation: `^\s+`},
+	})
+
+	// -- Then
+	//
+	if r.NoError(err) && r.Len(actual.Timeline, 1) {
+		r.Equal(0, actual.Timeline[0].Step)
+		r.Equal("tick", actual.Store.GetStringValue("crashed_at"))
+	}
+}
+
+func (r *ReplayTestSuite) TestReplayCancelled() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// -- When
+	//
+	_, err := Replay(ctx, Config{}, []*Step{{Line: "hello"}}, Opts{})
+
+	// -- Then
+	//
+	r.ErrorIs(err, context.Canceled)
+}
+
+func (r *ReplayTestSuite) TestReplayLogAppCommandAndVariable() {
+	// -- Given
+	//
+	joined, err := reaction2.Regex(`(\w+) joined`)
+	r.Require().NoError(err)
+	conf := Config{
+		Logs: []*reaction2.CompiledLogReaction{
+			{
+				Condition: joined,
+				Actions: []*reaction2.Action{
+					{AppCommand: &appcommand.AppCommandPayload{
+						Name: "say",
+						Args: []*appcommand.AppCommandArg{{Name: "message", Value: appcmd.NewVal("welcome {{first_match}}")}},
+					}},
+					{Variable: &actions2.UpdateVariable{Name: "joins", Op: actions2.VariableIncrement, Value: "1", Save: true}},
+				},
+			},
+		},
+	}
+	sent := false
+	opts := Opts{
+		Start: r.Start,
+		Actions: reaction2.ActionOpts{
+			AppCommands: []*appcommand.AppCommand{
+				{Name: "say", Spec: &appcommand.AppCommandSpec{Options: []*appcommand.CommandOption{
+					{Name: "message", Type: appcommand.CommandOption_STRING},
+				}}},
+			},
+			OnAppCommand: func(cmd []byte) error {
+				sent = true
+				return nil
+			},
+		},
+	}
+
+	// -- When
+	//
+	actual, err := ReplayLog(context.Background(), conf, strings.NewReader("steve joined"), time.Second, opts)
+
+	// -- Then
+	//
+	r.Require().NoError(err)
+	r.False(sent)
+	r.Equal([]string{"say welcome steve"}, actual.AppCommands)
+	if r.Len(actual.Timeline, 1) {
+		r.NoError(actual.Timeline[0].Err)
+		r.Equal([]string{"say welcome steve"}, actual.Timeline[0].AppCommands)
+		if r.Len(actual.Timeline[0].Variables, 1) {
+			r.Equal("joins", actual.Timeline[0].Variables[0].GetName())
+		}
+	}
+	r.Equal("1", actual.Store.GetStringValue("joins"))
+}
+
+func (r *ReplayTestSuite) TestWriteTimeline() {
+	// -- Given
+	//
+	given := &Result{Timeline: []*Event{
+		{
+			At:       r.Start,
+			Reaction: "log/1",
+			Line:     "Done!",
+			Statuses: []actions.SetStatus_Status{actions.SetStatus_ready},
+		},
+		{
+			At:       r.Start.Add(time.Second),
+			Reaction: "file/0",
+			File:     "/saves/world.zip",
+			Calls:    []*Call{{Method: "Upload"}},
+		},
+		{
+			At:          r.Start.Add(2 * time.Second),
+			Reaction:    "log/0",
+			Line:        "steve joined",
+			AppCommands: []string{"say welcome steve"},
+		},
+	}}
+	buf := bytes.NewBuffer(nil)
+
+	// -- When
+	//
+	err := given.WriteTimeline(buf)
+
+	// -- Then
+	//
+	r.NoError(err)
+	r.Equal("12:00:00.000 log/1 line=\"Done!\" status=ready\n12:00:01.000 file/0 file=\"/saves/world.zip\" Upload\n"+
+		"12:00:02.000 log/0 line=\"steve joined\" app_command=\"say welcome steve\"\n", buf.String())
+}
+
+func (r *ReplayTestSuite) reactions(events []*Event) []string {
+	out := make([]string, 0, len(events))
+	for _, v := range events {
+		out = append(out, v.Reaction)
+	}
+	return out
+}
+
+func (r *ReplayTestSuite) steps(events []*Event) []int {
+	out := make([]int, 0, len(events))
+	for _, v := range events {
+		out = append(out, v.Step)
+	}
+	return out
+}
+
+func TestReplayTestSuite(t *testing.T) {
+	suite.Run(t, new(ReplayTestSuite))
+}
@@ -0,0 +1,187 @@
+package variable
+
+import (
+	"encoding/json"
+	"errors"
+	"go.etcd.io/bbolt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultBoltBucket is the bucket used by a BoltBackend when none is set.
+	DefaultBoltBucket = "variables"
+)
+
+var _ Backend = &FileBackend{}
+var _ Backend = &BoltBackend{}
+
+// FileBackend persists every variable to a single JSON file.
+type FileBackend struct {
+	Path string
+}
+
+func NewFileBackend(fp string) *FileBackend {
+	return &FileBackend{Path: fp}
+}
+
+func (f *FileBackend) Load() ([]*Entry, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var persisted []*persistedEntry
+	err = json.Unmarshal(b, &persisted)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeEntries(persisted)
+}
+
+// Save atomically writes the file so a crash never leaves a partially written file.
+func (f *FileBackend) Save(entries []*Entry) error {
+	persisted, err := encodeEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(f.Path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.Path)
+}
+
+func (f *FileBackend) Close() error {
+	return nil
+}
+
+// BoltBackend persists every variable to a key within a bbolt database. The database is locked until the backend is
+// closed.
+type BoltBackend struct {
+	DB     *bbolt.DB
+	Bucket string
+}
+
+// NewBoltBackend opens or creates the database. If the bucket is empty, DefaultBoltBucket is used.
+func NewBoltBackend(fp, bucket string) (*BoltBackend, error) {
+	if bucket == "" {
+		bucket = DefaultBoltBucket
+	}
+
+	err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(fp, 0644, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltBackend{DB: db, Bucket: bucket}, nil
+}
+
+func (b *BoltBackend) Load() ([]*Entry, error) {
+	var persisted []*persistedEntry
+	err := b.DB.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(b.Bucket))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_, v []byte) error {
+			p := &persistedEntry{}
+			err := json.Unmarshal(v, p)
+			if err != nil {
+				return err
+			}
+			persisted = append(persisted, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeEntries(persisted)
+}
+
+// Save replaces the bucket within a single transaction.
+func (b *BoltBackend) Save(entries []*Entry) error {
+	persisted, err := encodeEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	return b.DB.Update(func(tx *bbolt.Tx) error {
+		err := tx.DeleteBucket([]byte(b.Bucket))
+		if err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+			return err
+		}
+
+		bucket, err := tx.CreateBucket([]byte(b.Bucket))
+		if err != nil {
+			return err
+		}
+
+		for _, v := range persisted {
+			val, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+
+			err = bucket.Put([]byte(v.Key), val)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltBackend) Close() error {
+	return b.DB.Close()
+}
+
+func encodeEntries(entries []*Entry) ([]*persistedEntry, error) {
+	out := make([]*persistedEntry, 0, len(entries))
+	for _, v := range entries {
+		p, err := encodeEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func decodeEntries(persisted []*persistedEntry) ([]*Entry, error) {
+	out := make([]*Entry, 0, len(persisted))
+	for _, v := range persisted {
+		e, err := decodeEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
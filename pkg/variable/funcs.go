@@ -0,0 +1,349 @@
+package variable
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/flosch/pongo2/v6"
+	"github.com/hostfactor/diazo/pkg/except"
+	"gopkg.in/yaml.v3"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// DefaultTimestampLayout is the layout of now_timestamp(). It's safe to use within file names e.g. backup names.
+	DefaultTimestampLayout = "20060102-150405"
+
+	DefaultRandomIdLength       = 16
+	DefaultRandomPasswordLength = 24
+)
+
+const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// TemplateSet is the pongo2 set used by RenderString. Every function of Funcs is available to its templates. pongo2
+// filters are always registered globally so the library is made of functions rather than filters e.g.
+// {{ basename(abs) }}. The built-in filters still apply to their results e.g. {{ basename(abs)|upper }}.
+var TemplateSet = NewTemplateSet()
+
+// NewTemplateSet creates a pongo2 set with every function of Funcs. Variables with the same name as a function take
+// precedence so functions are named to not clash with template entries e.g. the ext of a file or the timestamp of a
+// timer.
+func NewTemplateSet() *pongo2.TemplateSet {
+	set := pongo2.NewSet("diazo", pongo2.DefaultLoader)
+	set.Globals.Update(Funcs())
+	return set
+}
+
+// Funcs is the standard library of template functions.
+//
+// Time:
+//   - now() is the current time in UTC.
+//   - now_timestamp(layout?) is the current time in UTC formatted with the Go layout. Defaults to DefaultTimestampLayout.
+//   - format_time(t, layout?) formats a time, unix seconds or RFC 3339 string with the Go layout. Defaults to RFC 3339.
+//
+// Paths:
+//   - basename(p), dirname(p) and path_ext(p) are the same as filepath.Base, filepath.Dir and filepath.Ext.
+//   - join_path(elems...) is the same as filepath.Join.
+//
+// Versions:
+//   - semver_compare(a, b) is -1 if a < b, 0 if a == b and 1 if a > b. The leading v and missing minor or patch
+//     versions are optional e.g. v1.20 == 1.20.0. A pre-release is less than its release.
+//
+// Strings:
+//   - slugify(s) lowercases the string and replaces everything but letters and digits with single dashes.
+//   - shell_quote(s) quotes the string as a single shell word. See ShellQuote.
+//   - random_id(n?) is n random hex characters. Defaults to DefaultRandomIdLength.
+//   - random_password(n?) is n random letters and digits. Defaults to DefaultRandomPasswordLength.
+//
+// Encoding:
+//   - b64encode(s) and b64decode(s) use standard base64.
+//   - sha256(s) is the hex encoded SHA-256 hash.
+//   - to_json(v), from_json(s), to_yaml(v) and from_yaml(s) encode and decode values.
+func Funcs() pongo2.Context {
+	return pongo2.Context{
+		"now":             now,
+		"now_timestamp":   nowTimestamp,
+		"format_time":     formatTime,
+		"basename":        func(p *pongo2.Value) string { return filepath.Base(p.String()) },
+		"dirname":         func(p *pongo2.Value) string { return filepath.Dir(p.String()) },
+		"path_ext":        func(p *pongo2.Value) string { return filepath.Ext(p.String()) },
+		"join_path":       joinPath,
+		"semver_compare":  semverCompareFunc,
+		"slugify":         func(s *pongo2.Value) string { return Slugify(s.String()) },
+		"shell_quote":     shellQuote,
+		"random_id":       randomId,
+		"random_password": randomPassword,
+		"b64encode":       func(s *pongo2.Value) string { return base64.StdEncoding.EncodeToString([]byte(s.String())) },
+		"b64decode":       b64decode,
+		"sha256":          sha256Hex,
+		"to_json":         toJson,
+		"from_json":       fromJson,
+		"to_yaml":         toYaml,
+		"from_yaml":       fromYaml,
+	}
+}
+
+// Slugify lowercases the string and replaces every run of characters that aren't letters or digits with a single dash
+// e.g. "My World (1)" is my-world-1.
+func Slugify(s string) string {
+	out := strings.Builder{}
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && out.Len() > 0 {
+				out.WriteByte('-')
+			}
+			out.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return out.String()
+}
+
+// ShellQuote quotes the string so a POSIX shell reads it as a single word with no expansions e.g. it's is 'it'"'"'s'.
+// Strings made of only letters, digits and @%+=:,./_- are left as-is.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	if strings.IndexFunc(s, func(r rune) bool {
+		return r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("@%+=:,./_-", r))
+	}) < 0 {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// SemverCompare is -1 if a < b, 0 if a == b and 1 if a > b. Build metadata is ignored.
+func SemverCompare(a, b string) (int, error) {
+	av, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	bv, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < 3; i++ {
+		if av.Version[i] != bv.Version[i] {
+			return compareInt(av.Version[i], bv.Version[i]), nil
+		}
+	}
+
+	switch {
+	case av.Pre == bv.Pre:
+		return 0, nil
+	case av.Pre == "":
+		return 1, nil
+	case bv.Pre == "":
+		return -1, nil
+	}
+
+	ap, bp := strings.Split(av.Pre, "."), strings.Split(bv.Pre, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if ap[i] == bp[i] {
+			continue
+		}
+		ai, aErr := strconv.ParseInt(ap[i], 10, 64)
+		bi, bErr := strconv.ParseInt(bp[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			return compareInt(ai, bi), nil
+		case aErr == nil:
+			return -1, nil
+		case bErr == nil:
+			return 1, nil
+		}
+		return strings.Compare(ap[i], bp[i]), nil
+	}
+	return compareInt(int64(len(ap)), int64(len(bp))), nil
+}
+
+type semver struct {
+	Version [3]int64
+	Pre     string
+}
+
+func parseSemver(s string) (*semver, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ := strings.Cut(v, "-")
+
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return nil, except.NewInvalid("invalid version %s", s)
+	}
+
+	out := &semver{Pre: pre}
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n < 0 {
+			return nil, except.NewInvalid("invalid version %s", s)
+		}
+		out.Version[i] = n
+	}
+	return out, nil
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// shellQuote is marked safe so the quotes aren't HTML escaped.
+func shellQuote(s *pongo2.Value) *pongo2.Value {
+	return pongo2.AsSafeValue(ShellQuote(s.String()))
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func nowTimestamp(layout ...*pongo2.Value) string {
+	l := DefaultTimestampLayout
+	if len(layout) > 0 {
+		l = layout[0].String()
+	}
+	return now().Format(l)
+}
+
+func formatTime(t *pongo2.Value, layout ...*pongo2.Value) (string, error) {
+	l := time.RFC3339
+	if len(layout) > 0 {
+		l = layout[0].String()
+	}
+
+	switch {
+	case t.IsTime():
+		return t.Time().Format(l), nil
+	case t.IsInteger():
+		return time.Unix(int64(t.Integer()), 0).UTC().Format(l), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, t.String())
+	if err != nil {
+		return "", except.NewInvalid("invalid time %s", t.String())
+	}
+	return parsed.Format(l), nil
+}
+
+func joinPath(elems ...*pongo2.Value) string {
+	out := make([]string, 0, len(elems))
+	for _, v := range elems {
+		out = append(out, v.String())
+	}
+	return filepath.Join(out...)
+}
+
+func semverCompareFunc(a, b *pongo2.Value) (int, error) {
+	return SemverCompare(a.String(), b.String())
+}
+
+func randomId(n ...*pongo2.Value) (string, error) {
+	length := DefaultRandomIdLength
+	if len(n) > 0 {
+		length = n[0].Integer()
+	}
+	if length <= 0 {
+		return "", except.NewInvalid("invalid length %d", length)
+	}
+
+	b := make([]byte, (length+1)/2)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b)[:length], nil
+}
+
+func randomPassword(n ...*pongo2.Value) (string, error) {
+	length := DefaultRandomPasswordLength
+	if len(n) > 0 {
+		length = n[0].Integer()
+	}
+	if length <= 0 {
+		return "", except.NewInvalid("invalid length %d", length)
+	}
+
+	out := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = passwordChars[idx.Int64()]
+	}
+	return string(out), nil
+}
+
+func b64decode(s *pongo2.Value) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s.String())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func sha256Hex(s *pongo2.Value) string {
+	sum := sha256.Sum256([]byte(s.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// toJson is safe so quotes aren't escaped.
+func toJson(v *pongo2.Value) (*pongo2.Value, error) {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return pongo2.AsSafeValue(string(b)), nil
+}
+
+// toYaml is safe so quotes aren't escaped.
+func toYaml(v *pongo2.Value) (*pongo2.Value, error) {
+	b, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return pongo2.AsSafeValue(strings.TrimSuffix(string(b), "\n")), nil
+}
+
+func fromJson(s *pongo2.Value) (interface{}, error) {
+	out, err := decodeJson([]byte(s.String()))
+	if err != nil {
+		return nil, err
+	}
+	return pongoValue(out), nil
+}
+
+func fromYaml(s *pongo2.Value) (interface{}, error) {
+	var out interface{}
+	err := yaml.Unmarshal([]byte(s.String()), &out)
+	if err != nil {
+		return nil, err
+	}
+
+	// Converted through JSON so numbers match from_json.
+	b, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return fromJson(pongo2.AsValue(string(b)))
+}
@@ -0,0 +1,139 @@
+package variable
+
+import (
+	"github.com/flosch/pongo2/v6"
+	"github.com/stretchr/testify/suite"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type FuncsTestSuite struct {
+	suite.Suite
+}
+
+func (f *FuncsTestSuite) TestFuncs() {
+	type test struct {
+		Template string
+		Expected string
+	}
+
+	given := NewStore()
+	given.AddEntries(
+		NewEntry("abs", "/data/worlds/My World.zip"),
+		NewEntry("started", int64(1700000000)),
+		NewEntry("config", "motd: hi\nplayers: 4\n"),
+		NewEntry("info", map[string]interface{}{"motd": "hi", "slots": []interface{}{int64(1), 2.5}}),
+	)
+
+	tests := []test{
+		{Template: "{{ basename(abs) }}", Expected: "My World.zip"},
+		{Template: "{{ dirname(abs) }}", Expected: "/data/worlds"},
+		{Template: "{{ path_ext(abs) }}", Expected: ".zip"},
+		{Template: `{{ join_path("/data", "backups", basename(abs)) }}`, Expected: "/data/backups/My World.zip"},
+		{Template: "{{ slugify(basename(abs)) }}", Expected: "my-world-zip"},
+		{Template: "{{ shell_quote(basename(abs)) }}", Expected: "'My World.zip'"},
+		{Template: `{{ slugify(" --Hello,  World!! ") }}`, Expected: "hello-world"},
+		{Template: `{{ format_time(started) }}`, Expected: "2023-11-14T22:13:20Z"},
+		{Template: `{{ format_time(started, "2006-01-02") }}`, Expected: "2023-11-14"},
+		{Template: `{{ format_time("2023-11-14T22:13:20+01:00", "15:04") }}`, Expected: "22:13"},
+		{Template: `{% if semver_compare("1.20.1", "v1.20") > 0 %}newer{% endif %}`, Expected: "newer"},
+		{Template: `{{ semver_compare("1.20.0-rc.1", "1.20.0") }}`, Expected: "-1"},
+		{Template: `{{ b64encode("user:pass") }}`, Expected: "dXNlcjpwYXNz"},
+		{Template: `{{ b64decode("dXNlcjpwYXNz") }}`, Expected: "user:pass"},
+		{Template: `{{ sha256("hello") }}`, Expected: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{Template: `{{ to_json(info) }}`, Expected: `{"motd":"hi","slots":[1,2.5]}`},
+		{Template: `{{ from_json(to_json(info)).slots.1 }}`, Expected: "2.5"},
+		{Template: `{{ to_yaml(info.slots) }}`, Expected: "- 1\n- 2.5"},
+		{Template: `{{ from_yaml(config).players + 1 }}`, Expected: "5"},
+		{Template: `{{ basename(abs)|upper }}`, Expected: "MY WORLD.ZIP"},
+	}
+
+	for i, v := range tests {
+		f.Equal(v.Expected, RenderString(v.Template, given), "test %d: %s", i, v.Template)
+	}
+}
+
+func (f *FuncsTestSuite) TestRandom() {
+	// -- When
+	//
+	id := RenderString("{{ random_id() }}", NewStore())
+	short := RenderString("{{ random_id(5) }}", NewStore())
+	password := RenderString("{{ random_password(32) }}", NewStore())
+
+	// -- Then
+	//
+	f.Regexp(regexp.MustCompile(`^[0-9a-f]{16}$`), id)
+	f.Regexp(regexp.MustCompile(`^[0-9a-f]{5}$`), short)
+	f.Regexp(regexp.MustCompile(`^[a-zA-Z0-9]{32}$`), password)
+	f.NotEqual(password, RenderString("{{ random_password(32) }}", NewStore()))
+}
+
+func (f *FuncsTestSuite) TestTimestamp() {
+	// -- When
+	//
+	actual := RenderString("backup-{{ now_timestamp() }}.zip", NewStore())
+
+	// -- Then
+	//
+	ts, err := time.Parse("backup-"+DefaultTimestampLayout+".zip", actual)
+	if f.NoError(err) {
+		f.WithinDuration(time.Now(), ts, time.Minute)
+	}
+}
+
+func (f *FuncsTestSuite) TestRenderShell() {
+	type test struct {
+		Template string
+		Expected string
+	}
+
+	given := NewStore()
+	given.AddEntries(
+		NewEntry("abs", "/data/worlds/My World.zip"),
+		NewEntry("players", int64(4)),
+	)
+	entries := []*Entry{
+		NewEntry("name", `steve"; rm -rf / #`),
+		NewEntry("message", "it's $HOME `id`"),
+		NewEntry("shell_quote", "ignored"),
+	}
+
+	tests := []test{
+		{Template: "./kick.sh {{ name }}", Expected: `./kick.sh 'steve"; rm -rf / #'`},
+		{Template: `./say.sh "{{message}}"`, Expected: `./say.sh "'it'"'"'s $HOME ` + "`id`'\""},
+		{Template: "./backup.sh {{ basename(abs)|upper }} {{players}}", Expected: "./backup.sh 'MY WORLD.ZIP' 4"},
+		{Template: `./log.sh {{ "}}" }} {{ missing }}`, Expected: "./log.sh '}}' ''"},
+		{Template: "cp ${abs} /backups", Expected: "cp '/data/worlds/My World.zip' /backups"},
+		{Template: "{% if players > 2 %}./full.sh{% endif %}", Expected: "./full.sh"},
+		{Template: "./broken.sh {{ name", Expected: "./broken.sh {{ name"},
+	}
+
+	for i, v := range tests {
+		f.Equal(v.Expected, RenderShell(v.Template, given, entries...), "test %d: %s", i, v.Template)
+	}
+}
+
+func (f *FuncsTestSuite) TestSemverCompareInvalid() {
+	// -- When
+	//
+	_, err := SemverCompare("1.x", "1.0")
+
+	// -- Then
+	//
+	f.Error(err)
+}
+
+func (f *FuncsTestSuite) TestGlobalSetUnchanged() {
+	// -- When
+	//
+	actual, _ := pongo2.RenderTemplateString(`{{ basename("/a/b") }}`, pongo2.Context{})
+
+	// -- Then
+	//
+	f.Empty(actual)
+}
+
+func TestFuncsTestSuite(t *testing.T) {
+	suite.Run(t, new(FuncsTestSuite))
+}
@@ -0,0 +1,166 @@
+package variable
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// List is the value of a set or list variable. It's displayed as every element joined by ", " but FormatValue encodes it
+// as a JSON array so elements can contain commas.
+type List []string
+
+func (l List) String() string {
+	return strings.Join(l, ", ")
+}
+
+// Increment atomically adds the delta to the counter at the key. A missing counter, or one that's not a number, starts
+// at zero. The counter has no floor so it can go negative e.g. if a player leaving is logged without them joining. Use
+// IncrementFloor to prevent that.
+func Increment(s Updater, key string, delta int64) *Entry {
+	return s.Update(key, func(cur interface{}) interface{} {
+		return ToInt(cur) + delta
+	})
+}
+
+// IncrementFloor is the same as Increment but the counter never goes below the floor e.g. zero for the players online.
+func IncrementFloor(s Updater, key string, delta, floor int64) *Entry {
+	return s.Update(key, func(cur interface{}) interface{} {
+		out := ToInt(cur) + delta
+		if out < floor {
+			return floor
+		}
+		return out
+	})
+}
+
+// AddToSet atomically adds the values to the set at the key. The set is kept sorted and every value is only kept once.
+func AddToSet(s Updater, key string, vals ...string) *Entry {
+	return s.Update(key, func(cur interface{}) interface{} {
+		set := map[string]struct{}{}
+		for _, v := range append(ToList(cur), vals...) {
+			set[v] = struct{}{}
+		}
+
+		out := make(List, 0, len(set))
+		for k := range set {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	})
+}
+
+// RemoveFromSet atomically removes the values from the set or list at the key.
+func RemoveFromSet(s Updater, key string, vals ...string) *Entry {
+	return s.Update(key, func(cur interface{}) interface{} {
+		remove := map[string]struct{}{}
+		for _, v := range vals {
+			remove[v] = struct{}{}
+		}
+
+		out := List{}
+		for _, v := range ToList(cur) {
+			if _, ok := remove[v]; !ok {
+				out = append(out, v)
+			}
+		}
+		return out
+	})
+}
+
+// AppendToList atomically appends the values to the list at the key. If max is greater than zero, the oldest values
+// are dropped so the list has at most max values.
+func AppendToList(s Updater, key string, max int, vals ...string) *Entry {
+	return s.Update(key, func(cur interface{}) interface{} {
+		out := append(ToList(cur), vals...)
+		if max > 0 && len(out) > max {
+			out = out[len(out)-max:]
+		}
+		return out
+	})
+}
+
+// ToInt converts a variable value into an integer. Strings are parsed. Values that aren't numbers are zero.
+func ToInt(val interface{}) int64 {
+	switch v := val.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case nil:
+		return 0
+	}
+
+	out, err := strconv.ParseInt(strings.TrimSpace(fmt.Sprintf("%v", val)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return out
+}
+
+// ToList converts a variable value into a List. Strings are decoded as a JSON array e.g. a List from FormatValue.
+// Strings that aren't a JSON array are split on commas e.g. a legacy list that was saved as "a, b". Empty elements are
+// dropped.
+func ToList(val interface{}) List {
+	var in []string
+	switch v := val.(type) {
+	case nil:
+		return List{}
+	case List:
+		in = v
+	case []string:
+		in = v
+	case []interface{}:
+		in = make([]string, 0, len(v))
+		for _, e := range v {
+			in = append(in, FormatValue(e))
+		}
+	default:
+		in = splitList(FormatValue(v))
+	}
+
+	out := make(List, 0, len(in))
+	for _, v := range in {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// splitList decodes the elements of a JSON array. If the string isn't one, it's a legacy list that's split on commas.
+func splitList(s string) []string {
+	if t := strings.TrimSpace(s); strings.HasPrefix(t, "[") {
+		var arr []interface{}
+		if json.Unmarshal([]byte(t), &arr) == nil {
+			out := make([]string, 0, len(arr))
+			for _, v := range arr {
+				out = append(out, FormatValue(v))
+			}
+			return out
+		}
+	}
+	return strings.Split(s, ",")
+}
+
+// formatList encodes the list as a JSON array.
+func formatList(l []string) string {
+	if l == nil {
+		l = []string{}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(l)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
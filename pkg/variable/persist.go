@@ -0,0 +1,321 @@
+package variable
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFlushInterval = 10 * time.Second
+)
+
+// Backend persists the variables of a store.
+type Backend interface {
+	// Load every persisted entry. A backend that was never saved has no entries.
+	Load() ([]*Entry, error)
+
+	// Save replaces every persisted entry.
+	Save(entries []*Entry) error
+
+	Close() error
+}
+
+// PersistMode is when a PersistentStore saves its variables.
+type PersistMode int
+
+const (
+	// PersistWriteThrough saves after every change.
+	PersistWriteThrough PersistMode = iota
+
+	// PersistPeriodic saves every PersistOpts.FlushInterval if anything changed and once the store is closed.
+	PersistPeriodic
+)
+
+type PersistOpts struct {
+	Mode PersistMode
+
+	// Defaults to DefaultFlushInterval.
+	FlushInterval time.Duration
+}
+
+// PersistentStore is a Store whose variables and raw values are saved to a Backend so they survive a restart. Only
+// persisted keys are saved: restored keys, declared keys, blueprint variables from AddVariable and keys changed by
+// Update e.g. a counter. Entries of other keys e.g. the template data of a log line are kept in memory and never cause
+// a save. Errors saving in the background are logged.
+type PersistentStore struct {
+	MemoryStore
+
+	Backend Backend
+	Opts    PersistOpts
+
+	lock   sync.Mutex
+	keys   map[string]bool
+	dirty  bool
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Set once done is closed.
+	closeErr error
+}
+
+// NewPersistentStore restores the variables from the backend. The store is flushed and the backend is closed once the
+// context is done or Close is called.
+func NewPersistentStore(ctx context.Context, backend Backend, opts PersistOpts) (*PersistentStore, error) {
+	entries, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &PersistentStore{
+		MemoryStore: NewStore().(MemoryStore),
+		Backend:     backend,
+		Opts:        opts,
+		keys:        map[string]bool{},
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	s.MemoryStore.Restore(entries...)
+	for _, v := range entries {
+		s.keys[v.Key] = true
+	}
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+func (p *PersistentStore) AddEntries(entries ...*Entry) {
+	p.MemoryStore.AddEntries(entries...)
+	p.changed(entryKeys(entries)...)
+}
+
+func (p *PersistentStore) AddVariable(vars ...*blueprint.Variable) {
+	p.MemoryStore.AddVariable(vars...)
+	p.persist(variableKeys(vars)...)
+}
+
+func (p *PersistentStore) RemoveVariable(vars ...*blueprint.Variable) {
+	p.MemoryStore.RemoveVariable(vars...)
+	keys := variableKeys(vars)
+	p.changed(keys...)
+
+	p.lock.Lock()
+	for _, v := range keys {
+		delete(p.keys, v)
+	}
+	p.lock.Unlock()
+}
+
+func (p *PersistentStore) AddFileTemplateData(d ...*reaction.FileReactionTemplateData) {
+	for _, v := range d {
+		p.AddEntries(FileReactionTemplateDataEntries(v)...)
+	}
+}
+
+func (p *PersistentStore) AddLogTemplateData(d ...*reaction.LogReactionTemplateData) {
+	for _, v := range d {
+		p.AddEntries(LogReactionTemplateDataEntries(v)...)
+	}
+}
+
+func (p *PersistentStore) Update(key string, fn func(cur interface{}) interface{}) *Entry {
+	out := p.MemoryStore.Update(key, fn)
+	p.persist(key)
+	return out
+}
+
+func (p *PersistentStore) Declare(key string, typ Type) error {
+	err := p.MemoryStore.Declare(key, typ)
+	if err != nil {
+		return err
+	}
+	p.persist(key)
+	return nil
+}
+
+// Snapshot is every persisted variable with its raw value sorted by key.
+func (p *PersistentStore) Snapshot() []*Entry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.snapshot()
+}
+
+func (p *PersistentStore) Restore(entries ...*Entry) {
+	p.MemoryStore.Restore(entries...)
+
+	p.lock.Lock()
+	p.keys = map[string]bool{}
+	for _, v := range entries {
+		p.keys[v.Key] = true
+	}
+	p.lock.Unlock()
+	p.save()
+}
+
+// Flush saves the variables if anything changed since the last save.
+func (p *PersistentStore) Flush() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.dirty {
+		return nil
+	}
+
+	err := p.Backend.Save(p.snapshot())
+	if err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// Close flushes the variables and closes the backend.
+func (p *PersistentStore) Close() error {
+	p.cancel()
+	<-p.done
+	return p.closeErr
+}
+
+// snapshot must be called with the lock held.
+func (p *PersistentStore) snapshot() []*Entry {
+	all := p.MemoryStore.Snapshot()
+	out := make([]*Entry, 0, len(p.keys))
+	for _, v := range all {
+		if p.keys[v.Key] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// persist saves the keys from now on.
+func (p *PersistentStore) persist(keys ...string) {
+	p.lock.Lock()
+	for _, v := range keys {
+		p.keys[v] = true
+	}
+	p.lock.Unlock()
+	p.save()
+}
+
+// changed saves if any of the keys are persisted.
+func (p *PersistentStore) changed(keys ...string) {
+	p.lock.Lock()
+	persisted := false
+	for _, v := range keys {
+		persisted = persisted || p.keys[v]
+	}
+	p.lock.Unlock()
+
+	if persisted {
+		p.save()
+	}
+}
+
+func (p *PersistentStore) save() {
+	p.lock.Lock()
+	p.dirty = true
+	p.lock.Unlock()
+
+	if p.Opts.Mode == PersistWriteThrough {
+		err := p.Flush()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to save variables.")
+		}
+	}
+}
+
+func (p *PersistentStore) run(ctx context.Context) {
+	defer close(p.done)
+
+	var tick <-chan time.Time
+	if p.Opts.Mode == PersistPeriodic {
+		interval := p.Opts.FlushInterval
+		if interval <= 0 {
+			interval = DefaultFlushInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			err := p.Flush()
+			if err != nil {
+				logrus.WithError(err).Error("Failed to save variables.")
+			}
+		case <-ctx.Done():
+			p.closeErr = errors.Join(p.Flush(), p.Backend.Close())
+			if p.closeErr != nil {
+				logrus.WithError(p.closeErr).Error("Failed to close variable store.")
+			}
+			return
+		}
+	}
+}
+
+func entryKeys(entries []*Entry) []string {
+	out := make([]string, 0, len(entries))
+	for _, v := range entries {
+		out = append(out, v.Key)
+	}
+	return out
+}
+
+func variableKeys(vars []*blueprint.Variable) []string {
+	out := make([]string, 0, len(vars))
+	for _, v := range vars {
+		out = append(out, v.GetName())
+	}
+	return out
+}
+
+// persistedEntry is an Entry whose raw value keeps its type once it's decoded.
+type persistedEntry struct {
+	Key         string          `json:"key"`
+	DisplayName string          `json:"display_name,omitempty"`
+	Type        Type            `json:"type"`
+	Value       json.RawMessage `json:"value"`
+}
+
+func encodeEntry(e *Entry) (*persistedEntry, error) {
+	b, err := json.Marshal(e.Val)
+	if err != nil {
+		return nil, err
+	}
+
+	return &persistedEntry{
+		Key:         e.Key,
+		DisplayName: e.DisplayName,
+		Type:        TypeOf(e.Val),
+		Value:       b,
+	}, nil
+}
+
+func decodeEntry(p *persistedEntry) (*Entry, error) {
+	val, err := decodeJson(p.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Type != TypeJson {
+		val, err = Coerce(p.Type, val)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Entry{
+		Key:         p.Key,
+		Val:         val,
+		DisplayName: p.DisplayName,
+	}, nil
+}
@@ -0,0 +1,243 @@
+package variable
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type PersistTestSuite struct {
+	suite.Suite
+
+	Dir string
+}
+
+func (p *PersistTestSuite) BeforeTest(_, _ string) {
+	p.Dir = p.T().TempDir()
+}
+
+func (p *PersistTestSuite) TestSnapshotRestore() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	given.AddEntries(NewEntry("b", int64(2)), &Entry{Key: "a", Val: "1", DisplayName: "A var"})
+
+	// -- When
+	//
+	actual := given.Snapshot()
+	restored := NewStore(&blueprint.Variable{Name: "old", Value: "gone"}).(MemoryStore)
+	restored.Restore(actual...)
+
+	// -- Then
+	//
+	p.Equal([]*Entry{
+		{Key: "a", Val: "1", DisplayName: "A var"},
+		{Key: "b", Val: int64(2), DisplayName: "B"},
+	}, actual)
+	p.Equal(actual, restored.Snapshot())
+}
+
+func (p *PersistTestSuite) TestFileBackendWriteThrough() {
+	// -- Given
+	//
+	fp := filepath.Join(p.Dir, "state", "variables.json")
+	given, err := NewPersistentStore(context.Background(), NewFileBackend(fp), PersistOpts{})
+	p.Require().NoError(err)
+
+	// -- When
+	//
+	given.AddVariable(&blueprint.Variable{Name: "version", Value: "1.20.1"})
+	Increment(given, "players", 3)
+	AddToSet(given, "names", "steve", "alex")
+	p.Require().NoError(given.Declare("info", TypeJson))
+	p.Require().NoError(given.Declare("lagging", TypeBool))
+	given.AddEntries(NewEntry("info", map[string]any{"motd": "hi"}), NewEntry("lagging", true))
+	saved := p.load(fp)
+	p.Require().NoError(given.Close())
+
+	// -- Then
+	//
+	restored, err := NewPersistentStore(context.Background(), NewFileBackend(fp), PersistOpts{})
+	if p.NoError(err) {
+		defer restored.Close()
+		p.Len(saved, 5)
+		p.Equal(given.Snapshot(), restored.Snapshot())
+		p.Equal(int64(4), Increment(restored, "players", 1).Val)
+		p.Equal(`["alex","steve"]`, restored.GetStringValue("names"))
+		p.Equal("hi 4", RenderString("{{info.motd}} {{players}}", restored))
+	}
+}
+
+func (p *PersistTestSuite) TestRenderUnsavedKeys() {
+	// -- Given
+	//
+	fp := filepath.Join(p.Dir, "variables.json")
+	given, err := NewPersistentStore(context.Background(), NewFileBackend(fp), PersistOpts{})
+	p.Require().NoError(err)
+	defer given.Close()
+	Increment(given, "players", 3)
+
+	// -- When
+	//
+	given.AddEntries(NewEntry("line", "steve joined"), NewEntry("slots", []interface{}{int64(1), int64(2)}))
+
+	// -- Then
+	//
+	p.Equal("steve joined 3", RenderString("{{line}} {{players}}", given))
+	actual, err := RenderValue("{{slots}}", "", given)
+	if p.NoError(err) {
+		p.Equal([]interface{}{int64(1), int64(2)}, actual)
+	}
+	p.Len(given.Snapshot(), 1)
+	p.Len(p.load(fp), 1)
+}
+
+func (p *PersistTestSuite) TestFileBackendPeriodic() {
+	// -- Given
+	//
+	fp := filepath.Join(p.Dir, "variables.json")
+	given, err := NewPersistentStore(context.Background(), NewFileBackend(fp), PersistOpts{
+		Mode:          PersistPeriodic,
+		FlushInterval: time.Hour,
+	})
+	p.Require().NoError(err)
+
+	// -- When
+	//
+	given.AddVariable(&blueprint.Variable{Name: "version", Value: "1.20.1"})
+	_, statErr := os.Stat(fp)
+	err = given.Close()
+
+	// -- Then
+	//
+	p.True(os.IsNotExist(statErr))
+	p.NoError(err)
+	p.Len(p.load(fp), 1)
+}
+
+func (p *PersistTestSuite) TestFileBackendPeriodicFlush() {
+	// -- Given
+	//
+	fp := filepath.Join(p.Dir, "variables.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	given, err := NewPersistentStore(ctx, NewFileBackend(fp), PersistOpts{
+		Mode:          PersistPeriodic,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	p.Require().NoError(err)
+
+	// -- When
+	//
+	given.AddVariable(&blueprint.Variable{Name: "version", Value: "1.20.1"})
+
+	// -- Then
+	//
+	p.Eventually(func() bool {
+		_, err := os.Stat(fp)
+		return err == nil
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func (p *PersistTestSuite) TestBoltBackend() {
+	// -- Given
+	//
+	fp := filepath.Join(p.Dir, "variables.db")
+	backend, err := NewBoltBackend(fp, "")
+	p.Require().NoError(err)
+	given, err := NewPersistentStore(context.Background(), backend, PersistOpts{})
+	p.Require().NoError(err)
+
+	// -- When
+	//
+	p.Require().NoError(given.Declare("tps", TypeFloat))
+	given.AddVariable(&blueprint.Variable{Name: "version", Value: "1.20.1"})
+	given.AddEntries(NewEntry("tps", 19.5))
+	AppendToList(given, "recent", 0, "a", "b")
+	given.RemoveVariable(&blueprint.Variable{Name: "version"})
+	p.Require().NoError(given.Close())
+
+	// -- Then
+	//
+	backend, err = NewBoltBackend(fp, "")
+	p.Require().NoError(err)
+	restored, err := NewPersistentStore(context.Background(), backend, PersistOpts{})
+	if p.NoError(err) {
+		defer restored.Close()
+		p.Equal(given.Snapshot(), restored.Snapshot())
+		p.Equal(19.5, restored.Snapshot()[1].Val)
+		p.Empty(restored.GetStringValue("version"))
+	}
+}
+
+func (p *PersistTestSuite) TestTemplateEntriesNotPersisted() {
+	// -- Given
+	//
+	backend := &countingBackend{}
+	given, err := NewPersistentStore(context.Background(), backend, PersistOpts{})
+	p.Require().NoError(err)
+	p.Require().NoError(given.Declare("players", TypeInt))
+
+	// -- When
+	//
+	for i := 0; i < 10; i++ {
+		given.AddLogTemplateData(&reaction.LogReactionTemplateData{Line: "steve joined the game"})
+		given.AddEntries(NewEntry("first_match", "steve"))
+	}
+	given.AddEntries(NewEntry("players", "2"))
+	p.Require().NoError(given.Close())
+
+	// -- Then
+	//
+	p.Equal(2, backend.Saves)
+	p.Equal([]*Entry{{Key: "players", Val: int64(2), DisplayName: "Players"}}, backend.Entries)
+	p.Equal("steve", given.GetStringValue("first_match"))
+}
+
+func (p *PersistTestSuite) TestFileBackendMissing() {
+	// -- When
+	//
+	actual, err := NewFileBackend(filepath.Join(p.Dir, "missing.json")).Load()
+
+	// -- Then
+	//
+	p.NoError(err)
+	p.Empty(actual)
+}
+
+func (p *PersistTestSuite) load(fp string) []*persistedEntry {
+	b, err := os.ReadFile(fp)
+	p.Require().NoError(err)
+	var out []*persistedEntry
+	p.Require().NoError(json.Unmarshal(b, &out))
+	return out
+}
+
+type countingBackend struct {
+	Saves   int
+	Entries []*Entry
+}
+
+func (c *countingBackend) Load() ([]*Entry, error) {
+	return nil, nil
+}
+
+func (c *countingBackend) Save(entries []*Entry) error {
+	c.Saves++
+	c.Entries = entries
+	return nil
+}
+
+func (c *countingBackend) Close() error {
+	return nil
+}
+
+func TestPersistTestSuite(t *testing.T) {
+	suite.Run(t, new(PersistTestSuite))
+}
@@ -1,13 +1,16 @@
 package variable
 
 import (
-	"github.com/flosch/pongo2/v6"
+	"encoding/json"
+	"regexp"
 	"strings"
 )
 
+var singleVarRegex = regexp.MustCompile(`^\{\{\s*([a-zA-Z0-9_]+)\s*\}\}$`)
+
 func RenderString(og string, store Store, entries ...*Entry) string {
 	og = replaceVarsDeprecated(og, store, entries...)
-	temp, err := pongo2.FromString(og)
+	temp, err := TemplateSet.FromString(og)
 	if err != nil {
 		return og
 	}
@@ -19,6 +22,129 @@ func RenderString(og string, store Store, entries ...*Entry) string {
 	return out
 }
 
+// RenderShell renders the template of a shell command. The result of every {{ }} is quoted with ShellQuote so values
+// e.g. text from a log line can't inject commands or expand variables. The deprecated ${} variables are quoted as well.
+// Tags e.g. {% if %} are rendered as-is.
+func RenderShell(og string, store Store, entries ...*Entry) string {
+	temp, err := TemplateSet.FromString(quoteTemplateVars(deprecatedVarsReplacer.Replace(og)))
+	if err != nil {
+		return og
+	}
+
+	ctx := toPongoContext(store, entries...)
+	// Entries can't take the place of the function.
+	ctx["shell_quote"] = shellQuote
+	out, err := temp.Execute(ctx)
+	if err != nil {
+		return og
+	}
+	return out
+}
+
+// RenderValue renders the template and converts it to the type. If the template is a single variable e.g. {{players}},
+// its raw value is used rather than its string value so it keeps its type. If the type is empty, the value isn't
+// converted.
+func RenderValue(og string, typ Type, store Store, entries ...*Entry) (interface{}, error) {
+	var out interface{}
+	if m := singleVarRegex.FindStringSubmatch(strings.TrimSpace(og)); m != nil {
+		out = rawValue(m[1], store, entries...)
+	}
+
+	if out == nil {
+		out = RenderString(og, store, entries...)
+	}
+
+	if typ == "" {
+		return out, nil
+	}
+	return Coerce(typ, out)
+}
+
+// rawValue is the raw value of the key. Entries take precedence over the store.
+func rawValue(key string, s Store, entries ...*Entry) interface{} {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Key == key {
+			return entries[i].Val
+		}
+	}
+
+	if v, ok := s.(*PersistentStore); ok {
+		s = v.MemoryStore
+	}
+
+	if v, ok := s.(*store); ok {
+		out, ok := v.Map.Load(key)
+		if !ok {
+			return nil
+		}
+		return out.(*storeValue).RawValue
+	}
+
+	var out interface{}
+	rangeRawValues(s, func(k string, val interface{}) bool {
+		if k == key {
+			out = val
+			return false
+		}
+		return true
+	})
+	return out
+}
+
+// deprecatedVarsReplacer converts the deprecated ${} variables to their template.
+var deprecatedVarsReplacer = strings.NewReplacer(
+	"${dir}", "{{ dir }}",
+	"${abs}", "{{ abs }}",
+	"${filename}", "{{ filename }}",
+	"${name}", "{{ name }}",
+	"${ext}", "{{ ext }}",
+)
+
+// quoteTemplateVars wraps the expression of every {{ }} within the template with shell_quote e.g. {{ name|upper }} is
+// {{ shell_quote(name|upper) }}. The }} within string literals of the expression doesn't close it.
+func quoteTemplateVars(tpl string) string {
+	out := strings.Builder{}
+	for {
+		start := strings.Index(tpl, "{{")
+		if start < 0 {
+			break
+		}
+
+		end := templateVarEnd(tpl[start+2:])
+		if end < 0 {
+			break
+		}
+
+		out.WriteString(tpl[:start])
+		out.WriteString("{{ shell_quote(")
+		out.WriteString(strings.TrimSpace(tpl[start+2 : start+2+end]))
+		out.WriteString(") }}")
+		tpl = tpl[start+2+end+2:]
+	}
+	out.WriteString(tpl)
+	return out.String()
+}
+
+// templateVarEnd is the index of the }} closing the expression or -1 if it's never closed.
+func templateVarEnd(expr string) int {
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(expr[i:], "}}"):
+			return i
+		}
+	}
+	return -1
+}
+
 func replaceVarsDeprecated(og string, store Store, entries ...*Entry) string {
 	s := CombineEntries(store, entries...)
 	return strings.NewReplacer(
@@ -29,3 +155,47 @@ func replaceVarsDeprecated(og string, store Store, entries ...*Entry) string {
 		"${ext}", s.GetStringValue("ext"),
 	).Replace(og)
 }
+
+// pongoValue converts the raw value so it renders the same as its FormatValue. Floats are rendered with the fewest
+// digits needed rather than six decimals and JSON objects and arrays are rendered as JSON.
+func pongoValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case float64:
+		return pongoFloat(v)
+	case float32:
+		return pongoFloat(v)
+	case map[string]interface{}:
+		out := make(pongoObject, len(v))
+		for k, e := range v {
+			out[k] = pongoValue(e)
+		}
+		return out
+	case []interface{}:
+		out := make(pongoArray, 0, len(v))
+		for _, e := range v {
+			out = append(out, pongoValue(e))
+		}
+		return out
+	}
+	return val
+}
+
+type pongoFloat float64
+
+func (p pongoFloat) String() string {
+	return FormatValue(float64(p))
+}
+
+type pongoObject map[string]interface{}
+
+func (p pongoObject) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+type pongoArray []interface{}
+
+func (p pongoArray) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
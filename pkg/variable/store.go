@@ -5,8 +5,10 @@ import (
 	"github.com/flosch/pongo2/v6"
 	"github.com/hostfactor/api/go/blueprint"
 	"github.com/hostfactor/api/go/blueprint/reaction"
+	"github.com/hostfactor/diazo/pkg/except"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -47,6 +49,33 @@ func LogReactionTemplateDataEntries(l *reaction.LogReactionTemplateData) []*Entr
 	return entries
 }
 
+// LogNamedGroupEntries are the template entries for the named groups of the regex matches. The names and matches must
+// be in the same order, including the full match e.g. from regexp.Regexp.SubexpNames. Every named group is available by
+// name and within the groups map. Groups that didn't participate in the match are empty.
+func LogNamedGroupEntries(names, matches []string) []*Entry {
+	groups := map[string]any{}
+	entries := make([]*Entry, 0, len(names)+1)
+	for i, name := range names {
+		if name == "" || i >= len(matches) {
+			continue
+		}
+		groups[name] = matches[i]
+		entries = append(entries, &Entry{
+			Key: name,
+			Val: matches[i],
+		})
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	return append(entries, &Entry{
+		Key: "groups",
+		Val: groups,
+	})
+}
+
 func FileReactionTemplateDataEntries(v *reaction.FileReactionTemplateData) []*Entry {
 	entries := make([]*Entry, 0, 5)
 
@@ -104,10 +133,71 @@ type Store interface {
 	AddLogTemplateData(d ...*reaction.LogReactionTemplateData)
 	AddVariable(vars ...*blueprint.Variable)
 	AddEntries(entries ...*Entry)
+
 	Range(f func(key string, value *blueprint.Variable) bool)
 	Len() int
 }
 
+// Updater is a store whose values can be updated atomically e.g. by Increment.
+type Updater interface {
+	// Update atomically replaces the value of the key with the value returned by the fn. The current value is nil if
+	// the key doesn't exist. Updates of the same store are serialized so the fn must not update the store itself.
+	Update(key string, fn func(cur interface{}) interface{}) *Entry
+}
+
+// Snapshotter is a store that keeps the raw values of its variables.
+type Snapshotter interface {
+	// Snapshot is every variable with its raw value sorted by key.
+	Snapshot() []*Entry
+
+	// Restore replaces every variable with the entries e.g. from a Snapshot.
+	Restore(entries ...*Entry)
+}
+
+// Subscriber is a store whose changes can be subscribed to.
+type Subscriber interface {
+	// Subscribe calls the fn with every Change of a key matching the glob pattern e.g. max_players or world_*. If the
+	// pattern is empty, every key matches. Changes are delivered in order on a separate goroutine so a slow fn never
+	// blocks the store. At most MaxQueuedChanges are queued. The returned func unsubscribes and drops any undelivered
+	// changes.
+	Subscribe(pattern string, fn func(c Change)) (func(), error)
+}
+
+// Declarer is a store whose variables can be typed.
+type Declarer interface {
+	// Declare the Type of the key. Every value of the key is converted to the type, including the current one, e.g. a
+	// string from a blueprint or a SetVariable action. Values that can't be converted are kept as-is. Errors if the
+	// type is unknown.
+	Declare(key string, typ Type) error
+}
+
+// MemoryStore is a Store that implements every optional store interface e.g. the store returned by NewStore.
+type MemoryStore interface {
+	Store
+	Updater
+	Snapshotter
+	Subscriber
+	Declarer
+}
+
+// Snapshot is the Snapshotter.Snapshot of the store. If the store isn't a Snapshotter, it's every variable with its
+// string value sorted by key.
+func Snapshot(s Store) []*Entry {
+	if v, ok := s.(Snapshotter); ok {
+		return v.Snapshot()
+	}
+
+	out := make([]*Entry, 0, s.Len())
+	s.Range(func(key string, value *blueprint.Variable) bool {
+		out = append(out, &Entry{Key: key, Val: value.GetValue(), DisplayName: value.GetDisplayName()})
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
 type Entry struct {
 	Key         string
 	Val         interface{}
@@ -148,6 +238,11 @@ func (c *combinedStore) GetStringValue(key string) string {
 
 type store struct {
 	Map sync.Map
+
+	// Serializes every change so subscribers receive them in order.
+	lock  sync.Mutex
+	subs  []*subscription
+	types map[string]Type
 }
 
 func (s *store) Get(key string) *blueprint.Variable {
@@ -168,24 +263,110 @@ func (s *store) Len() int {
 }
 
 func (s *store) AddEntries(entries ...*Entry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.addEntries(entries...)
+}
+
+// addEntries must be called with the lock held.
+func (s *store) addEntries(entries ...*Entry) {
 	for _, v := range entries {
+		val := v.Val
+		if typ, ok := s.types[v.Key]; ok {
+			val = coerceOrKeep(v.Key, typ, val)
+		}
+
 		out := &storeValue{
 			Variable: &blueprint.Variable{
 				Name:        v.Key,
-				Value:       fmt.Sprintf("%v", v.Val),
+				Value:       FormatValue(val),
 				DisplayName: v.DisplayName,
 			},
-			RawValue: v.Val,
+			RawValue: val,
 		}
 
 		if out.Variable.DisplayName == "" {
 			out.Variable.DisplayName = cases.Title(language.English, cases.Compact).String(v.Key)
 		}
 
-		s.Map.Store(v.Key, out)
+		old, _ := s.Map.Swap(v.Key, out)
+		s.notify(v.Key, old, out)
 	}
 }
 
+func (s *store) Update(key string, fn func(cur interface{}) interface{}) *Entry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var cur interface{}
+	var displayName string
+	if v, ok := s.Map.Load(key); ok {
+		cur = v.(*storeValue).RawValue
+		displayName = v.(*storeValue).Variable.GetDisplayName()
+	}
+
+	out := &Entry{
+		Key:         key,
+		Val:         fn(cur),
+		DisplayName: displayName,
+	}
+	s.addEntries(out)
+	return out
+}
+
+func (s *store) Declare(key string, typ Type) error {
+	if !typ.Valid() {
+		return except.NewInvalid("unknown variable type %s", typ)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.types == nil {
+		s.types = map[string]Type{}
+	}
+	s.types[key] = typ
+
+	if v, ok := s.Map.Load(key); ok {
+		s.addEntries(&Entry{Key: key, Val: v.(*storeValue).RawValue, DisplayName: v.(*storeValue).Variable.GetDisplayName()})
+	}
+	return nil
+}
+
+func (s *store) Snapshot() []*Entry {
+	out := make([]*Entry, 0, 10)
+	s.rawRange(func(key string, val *storeValue) bool {
+		out = append(out, &Entry{
+			Key:         key,
+			Val:         val.RawValue,
+			DisplayName: val.Variable.GetDisplayName(),
+		})
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func (s *store) Restore(entries ...*Entry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keep := map[string]bool{}
+	for _, v := range entries {
+		keep[v.Key] = true
+	}
+
+	s.Map.Range(func(key, _ interface{}) bool {
+		if !keep[key.(string)] {
+			s.remove(key.(string))
+		}
+		return true
+	})
+	s.addEntries(entries...)
+}
+
 func (s *store) Range(f func(key string, value *blueprint.Variable) bool) {
 	s.Map.Range(func(key, value interface{}) bool {
 		return f(key.(string), value.(*storeValue).Variable)
@@ -227,8 +408,18 @@ func (s *store) AddVariable(vars ...*blueprint.Variable) {
 }
 
 func (s *store) RemoveVariable(vars ...*blueprint.Variable) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	for _, v := range vars {
-		s.Map.Delete(v.GetName())
+		s.remove(v.GetName())
+	}
+}
+
+// remove must be called with the lock held.
+func (s *store) remove(key string) {
+	old, loaded := s.Map.LoadAndDelete(key)
+	if loaded {
+		s.notify(key, old, nil)
 	}
 }
 
@@ -238,15 +429,34 @@ func (s *store) rawRange(f func(key string, val *storeValue) bool) {
 	})
 }
 
+// rangeRawValues calls f with the raw value of every variable within the store. Unlike Snapshot, keys that a
+// PersistentStore doesn't save are included.
+func rangeRawValues(s Store, f func(key string, val interface{}) bool) {
+	switch v := s.(type) {
+	case *store:
+		v.rawRange(func(key string, val *storeValue) bool {
+			return f(key, val.RawValue)
+		})
+	case *PersistentStore:
+		rangeRawValues(v.MemoryStore, f)
+	default:
+		for _, e := range Snapshot(s) {
+			if !f(e.Key, e.Val) {
+				return
+			}
+		}
+	}
+}
+
 func toPongoContext(s Store, entries ...*Entry) pongo2.Context {
 	ctx := pongo2.Context{}
-	s.(*store).rawRange(func(k string, v *storeValue) bool {
-		ctx[k] = v.RawValue
+	rangeRawValues(s, func(key string, val interface{}) bool {
+		ctx[key] = pongoValue(val)
 		return true
 	})
 
 	for _, v := range entries {
-		ctx[v.Key] = v.Val
+		ctx[v.Key] = pongoValue(v.Val)
 	}
 
 	return ctx
@@ -2,8 +2,11 @@ package variable
 
 import (
 	"bytes"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/hostfactor/diazo/pkg/except"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/suite"
+	"sync"
 	"testing"
 )
 
@@ -54,6 +57,278 @@ func (s *StoreTestSuite) TestStringInterface() {
 	s.Equal(expected, actual)
 }
 
+func (s *StoreTestSuite) TestLogNamedGroupEntries() {
+	// -- Given
+	//
+	names := []string{"", "player", "", "world"}
+	matches := []string{"steve left nether", "steve", "left", "nether"}
+
+	// -- When
+	//
+	actual := LogNamedGroupEntries(names, matches)
+
+	// -- Then
+	//
+	s.Equal([]*Entry{
+		{Key: "player", Val: "steve"},
+		{Key: "world", Val: "nether"},
+		{Key: "groups", Val: map[string]any{"player": "steve", "world": "nether"}},
+	}, actual)
+	s.Nil(LogNamedGroupEntries([]string{"", ""}, []string{"a", "b"}))
+}
+
+func (s *StoreTestSuite) TestIncrement() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	given.AddEntries(NewEntry("players", "2"))
+	wg := sync.WaitGroup{}
+
+	// -- When
+	//
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			Increment(given, "players", 2)
+		}()
+		go func() {
+			defer wg.Done()
+			Increment(given, "players", -1)
+		}()
+	}
+	wg.Wait()
+
+	// -- Then
+	//
+	s.Equal("52", given.GetStringValue("players"))
+}
+
+func (s *StoreTestSuite) TestIncrementFloor() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	given.AddEntries(NewEntry("players", "1"))
+
+	// -- When
+	//
+	IncrementFloor(given, "players", -1, 0)
+	IncrementFloor(given, "players", -1, 0)
+	Increment(given, "left", -1)
+
+	// -- Then
+	//
+	s.Equal("0", given.GetStringValue("players"))
+	s.Equal("-1", given.GetStringValue("left"))
+}
+
+func (s *StoreTestSuite) TestListCommas() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+
+	// -- When
+	//
+	AppendToList(given, "messages", 0, "hello, world")
+	AppendToList(given, "messages", 0, "bye")
+	restored := NewStore().(MemoryStore)
+	restored.AddEntries(NewEntry("messages", given.GetStringValue("messages")))
+	AppendToList(restored, "messages", 0, "again")
+
+	// -- Then
+	//
+	s.Equal(`["hello, world","bye"]`, given.GetStringValue("messages"))
+	s.Equal(List{"hello, world", "bye", "again"}, ToList(restored.GetStringValue("messages")))
+	s.Equal("hello, world/bye/again/", RenderString("{% for v in messages %}{{v}}/{% endfor %}", restored))
+}
+
+func (s *StoreTestSuite) TestSets() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	given.AddEntries(NewEntry("names", "steve, alex"))
+
+	// -- When
+	//
+	AddToSet(given, "names", "zed", "alex")
+	RemoveFromSet(given, "names", "steve")
+
+	// -- Then
+	//
+	s.Equal(`["alex","zed"]`, given.GetStringValue("names"))
+	s.Equal("alex/zed/", RenderString("{% for v in names %}{{v}}/{% endfor %}", given))
+}
+
+func (s *StoreTestSuite) TestAppendToList() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+
+	// -- When
+	//
+	for _, v := range []string{"a", "b", "c", "d"} {
+		AppendToList(given, "recent", 3, v)
+	}
+
+	// -- Then
+	//
+	s.Equal(`["b","c","d"]`, given.GetStringValue("recent"))
+}
+
+func (s *StoreTestSuite) TestDeclare() {
+	// -- Given
+	//
+	given := NewStore(&blueprint.Variable{Name: "max_players", Value: "20"}).(MemoryStore)
+
+	// -- When
+	//
+	err := given.Declare("max_players", TypeInt)
+	s.Require().NoError(err)
+	s.Require().NoError(given.Declare("info", TypeJson))
+	s.Require().NoError(given.Declare("tps", TypeFloat))
+	given.AddVariable(&blueprint.Variable{Name: "info", Value: `{"motd": "hi", "slots": [1, 2.5]}`})
+	given.AddEntries(NewEntry("tps", "19.50"), NewEntry("max_players", "lots"))
+
+	// -- Then
+	//
+	actual := given.Snapshot()
+	s.Equal(map[string]interface{}{"motd": "hi", "slots": []interface{}{int64(1), 2.5}}, actual[0].Val)
+	s.Equal("lots", actual[1].Val)
+	s.Equal(19.5, actual[2].Val)
+	s.Equal("19.5", given.GetStringValue("tps"))
+	s.Equal(`{"motd":"hi","slots":[1,2.5]}`, given.GetStringValue("info"))
+	s.ErrorIs(given.Declare("tps", "decimal"), except.ErrInvalid)
+}
+
+func (s *StoreTestSuite) TestDeclareUnconvertible() {
+	// -- Given
+	//
+	given := NewStore(&blueprint.Variable{Name: "max_players", Value: "lots"}).(MemoryStore)
+
+	// -- When
+	//
+	err := given.Declare("max_players", TypeInt)
+
+	// -- Then
+	//
+	s.Require().NoError(err)
+	s.Equal("lots", given.Snapshot()[0].Val)
+	given.AddEntries(NewEntry("max_players", "20"))
+	s.Equal(int64(20), given.Snapshot()[0].Val)
+}
+
+func (s *StoreTestSuite) TestRenderTyped() {
+	// -- Given
+	//
+	given := NewStore()
+	given.AddEntries(
+		NewEntry("players", int64(4)),
+		NewEntry("tps", 19.5),
+		NewEntry("lagging", false),
+		NewEntry("info", map[string]interface{}{"slots": []interface{}{int64(1), 2.5}}),
+	)
+
+	// -- When
+	//
+	actual := RenderString("{{players * 2}} {{tps}} {% if tps < 20 and not lagging %}ok{% endif %} {{info.slots}} {{info.slots.1}}", given)
+
+	// -- Then
+	//
+	s.Equal("8 19.5 ok [1,2.5] 2.5", actual)
+}
+
+func (s *StoreTestSuite) TestRenderValue() {
+	// -- Given
+	//
+	given := NewStore()
+	given.AddEntries(NewEntry("players", int64(4)), NewEntry("names", List{"alex", "steve"}))
+
+	// -- When
+	//
+	count, countErr := RenderValue("{{ players }}", "", given)
+	next, nextErr := RenderValue("{{players + 1}}", TypeInt, given)
+	names, namesErr := RenderValue("{{names}}", TypeList, given, NewEntry("names", "zed"))
+	_, invalidErr := RenderValue("{{names}}", TypeBool, given)
+
+	// -- Then
+	//
+	s.NoError(countErr)
+	s.Equal(int64(4), count)
+	s.NoError(nextErr)
+	s.Equal(int64(5), next)
+	s.NoError(namesErr)
+	s.Equal(List{"zed"}, names)
+	s.Error(invalidErr)
+}
+
+func (s *StoreTestSuite) TestCoerce() {
+	type test struct {
+		Typ      Type
+		Val      interface{}
+		Expected interface{}
+		Err      bool
+	}
+
+	tests := []test{
+		{Typ: TypeInt, Val: " 12 ", Expected: int64(12)},
+		{Typ: TypeInt, Val: "12.0", Expected: int64(12)},
+		{Typ: TypeInt, Val: "1.9", Err: true},
+		{Typ: TypeInt, Val: 3.0, Expected: int64(3)},
+		{Typ: TypeInt, Val: 2.5, Err: true},
+		{Typ: TypeInt, Val: "twelve", Err: true},
+		{Typ: TypeInt, Val: true, Err: true},
+		{Typ: TypeFloat, Val: "0.25", Expected: 0.25},
+		{Typ: TypeFloat, Val: 2, Expected: 2.0},
+		{Typ: TypeBool, Val: "Yes", Expected: true},
+		{Typ: TypeBool, Val: "0", Expected: false},
+		{Typ: TypeBool, Val: "maybe", Err: true},
+		{Typ: TypeString, Val: 2.50, Expected: "2.5"},
+		{Typ: TypeString, Val: List{"a", "b"}, Expected: `["a","b"]`},
+		{Typ: TypeList, Val: "a, b,", Expected: List{"a", "b"}},
+		{Typ: TypeList, Val: `["a, b", "c"]`, Expected: List{"a, b", "c"}},
+		{Typ: TypeList, Val: `[1, true]`, Expected: List{"1", "true"}},
+		{Typ: TypeJson, Val: `[1, "a"]`, Expected: []interface{}{int64(1), "a"}},
+		{Typ: TypeJson, Val: map[string]int{"a": 1}, Expected: map[string]interface{}{"a": int64(1)}},
+		{Typ: TypeJson, Val: "{", Err: true},
+		{Typ: "decimal", Val: "1", Err: true},
+	}
+
+	for i, v := range tests {
+		actual, err := Coerce(v.Typ, v.Val)
+		if v.Err {
+			s.Error(err, "test %d", i)
+		} else if s.NoError(err, "test %d", i) {
+			s.Equal(v.Expected, actual, "test %d", i)
+		}
+	}
+}
+
+func (s *StoreTestSuite) TestPlainStore() {
+	// -- Given
+	//
+	given := plainStore{Store: NewStore()}
+	given.AddEntries(NewEntry("players", int64(2)), NewEntry("names", List{"alex"}))
+
+	// -- When
+	//
+	actual := Snapshot(given)
+	_, isUpdater := Store(given).(Updater)
+
+	// -- Then
+	//
+	s.False(isUpdater)
+	s.Equal([]*Entry{
+		{Key: "names", Val: `["alex"]`, DisplayName: "Names"},
+		{Key: "players", Val: "2", DisplayName: "Players"},
+	}, actual)
+	s.Equal("2", RenderString("{{players}}", given))
+}
+
+// plainStore only implements Store.
+type plainStore struct {
+	Store
+}
+
 func TestStoreTestSuite(t *testing.T) {
 	suite.Run(t, new(StoreTestSuite))
 }
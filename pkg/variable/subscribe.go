@@ -0,0 +1,197 @@
+package variable
+
+import (
+	"context"
+	"github.com/hostfactor/diazo/pkg/except"
+	"path"
+	"reflect"
+	"sync"
+)
+
+// MaxQueuedChanges is the max number of changes queued for a subscriber. Once full, a change is coalesced with the
+// latest queued change of its key. If its key isn't queued, the oldest queued change is dropped.
+const MaxQueuedChanges = 1000
+
+// Change is a change of a variable within a Store.
+type Change struct {
+	Key string
+
+	// The raw values before and after the change. Old is nil if the variable was added and New is nil if it was
+	// removed.
+	Old interface{}
+	New interface{}
+
+	Removed bool
+}
+
+// Watch is the same as Subscriber.Subscribe but delivers the changes on the returned channel, which is closed once the
+// context is done. Changes are queued by the store so an unread channel never blocks it. See MaxQueuedChanges.
+func Watch(ctx context.Context, s Subscriber, pattern string) (<-chan Change, error) {
+	out := make(chan Change)
+	lock := sync.Mutex{}
+	closed := false
+	unsubscribe, err := s.Subscribe(pattern, func(c Change) {
+		lock.Lock()
+		defer lock.Unlock()
+		if closed {
+			return
+		}
+
+		select {
+		case out <- c:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+		lock.Lock()
+		defer lock.Unlock()
+		closed = true
+		close(out)
+	}()
+
+	return out, nil
+}
+
+func (s *store) Subscribe(pattern string, fn func(c Change)) (func(), error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, except.NewInvalid("invalid variable pattern %s", pattern)
+	}
+
+	sub := &subscription{
+		Pattern:  pattern,
+		Fn:       fn,
+		Capacity: MaxQueuedChanges,
+		signal:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	s.lock.Lock()
+	s.subs = append(s.subs, sub)
+	s.lock.Unlock()
+
+	go sub.run()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			s.lock.Lock()
+			for i, v := range s.subs {
+				if v == sub {
+					s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+					break
+				}
+			}
+			s.lock.Unlock()
+			close(sub.done)
+		})
+	}, nil
+}
+
+// notify queues the change for every matching subscriber. Values that didn't change are ignored. Must be called with
+// the lock held.
+func (s *store) notify(key string, old, new interface{}) {
+	if len(s.subs) == 0 {
+		return
+	}
+
+	c := Change{Key: key, Removed: new == nil}
+	if v, ok := old.(*storeValue); ok && v != nil {
+		c.Old = v.RawValue
+	}
+	if v, ok := new.(*storeValue); ok && v != nil {
+		c.New = v.RawValue
+	}
+
+	if old != nil && new != nil && reflect.DeepEqual(c.Old, c.New) {
+		return
+	}
+
+	for _, v := range s.subs {
+		if v.matches(key) {
+			v.push(c)
+		}
+	}
+}
+
+type subscription struct {
+	Pattern  string
+	Fn       func(c Change)
+	Capacity int
+
+	lock   sync.Mutex
+	queue  []Change
+	signal chan struct{}
+	done   chan struct{}
+}
+
+func (s *subscription) matches(key string) bool {
+	if s.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(s.Pattern, key)
+	return ok
+}
+
+func (s *subscription) push(c Change) {
+	s.lock.Lock()
+	if len(s.queue) < s.Capacity {
+		s.queue = append(s.queue, c)
+	} else {
+		s.queue = coalesce(s.queue, c)
+	}
+	s.lock.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.signal:
+		}
+
+		s.lock.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.lock.Unlock()
+
+		for _, v := range queue {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.Fn(v)
+		}
+	}
+}
+
+// coalesce adds the change to the full queue. The latest queued change of the key is replaced by one from its old value
+// to the new one and moved to the end. If the key isn't queued, the oldest change is dropped.
+func coalesce(queue []Change, c Change) []Change {
+	for i := len(queue) - 1; i >= 0; i-- {
+		if queue[i].Key != c.Key {
+			continue
+		}
+
+		c.Old = queue[i].Old
+		queue = append(queue[:i], queue[i+1:]...)
+		if c.Old != nil && !c.Removed && reflect.DeepEqual(c.Old, c.New) {
+			return queue
+		}
+		return append(queue, c)
+	}
+
+	return append(queue[1:], c)
+}
@@ -0,0 +1,209 @@
+package variable
+
+import (
+	"context"
+	"github.com/hostfactor/api/go/blueprint"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"testing"
+	"time"
+)
+
+type SubscribeTestSuite struct {
+	suite.Suite
+
+	lock    sync.Mutex
+	Changes []Change
+}
+
+func (s *SubscribeTestSuite) BeforeTest(_, _ string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Changes = nil
+}
+
+func (s *SubscribeTestSuite) TestSubscribe() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	given.AddEntries(NewEntry("players", int64(1)))
+	unsubscribe, err := given.Subscribe("", s.onChange)
+	s.Require().NoError(err)
+	defer unsubscribe()
+
+	// -- When
+	//
+	Increment(given, "players", 1)
+	given.AddEntries(NewEntry("players", int64(2)), NewEntry("version", "1.20.1"))
+	given.RemoveVariable(&blueprint.Variable{Name: "version"}, &blueprint.Variable{Name: "missing"})
+
+	// -- Then
+	//
+	s.Eventually(func() bool {
+		return len(s.changes()) == 3
+	}, 5*time.Second, 5*time.Millisecond)
+	s.Equal([]Change{
+		{Key: "players", Old: int64(1), New: int64(2)},
+		{Key: "version", New: "1.20.1"},
+		{Key: "version", Old: "1.20.1", Removed: true},
+	}, s.changes())
+}
+
+func (s *SubscribeTestSuite) TestSubscribePattern() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	unsubscribe, err := given.Subscribe("world_*", s.onChange)
+	s.Require().NoError(err)
+	defer unsubscribe()
+
+	// -- When
+	//
+	given.AddEntries(NewEntry("players", 1), NewEntry("world_name", "overworld"), NewEntry("world_seed", "123"))
+
+	// -- Then
+	//
+	s.Eventually(func() bool {
+		return len(s.changes()) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	actual := s.changes()
+	s.Equal("world_name", actual[0].Key)
+	s.Equal("world_seed", actual[1].Key)
+}
+
+func (s *SubscribeTestSuite) TestSubscribeInvalidPattern() {
+	// -- When
+	//
+	_, err := NewStore().(MemoryStore).Subscribe("world_[", s.onChange)
+
+	// -- Then
+	//
+	s.Error(err)
+}
+
+func (s *SubscribeTestSuite) TestSlowSubscriber() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	release := make(chan struct{})
+	received := make(chan int64, 100)
+	unsubscribe, err := given.Subscribe("count", func(c Change) {
+		<-release
+		received <- c.New.(int64)
+	})
+	s.Require().NoError(err)
+	defer unsubscribe()
+
+	// -- When
+	//
+	for i := 0; i < 100; i++ {
+		Increment(given, "count", 1)
+	}
+	close(release)
+
+	// -- Then
+	//
+	for i := int64(1); i <= 100; i++ {
+		select {
+		case v := <-received:
+			s.Equal(i, v)
+		case <-time.After(5 * time.Second):
+			s.FailNow("change not delivered")
+		}
+	}
+}
+
+func (s *SubscribeTestSuite) TestQueueFull() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	once := sync.Once{}
+	unsubscribe, err := given.Subscribe("", func(c Change) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		s.onChange(c)
+	})
+	s.Require().NoError(err)
+	defer unsubscribe()
+	given.AddEntries(NewEntry("first", 1))
+	<-started
+
+	// -- When
+	//
+	for i := 0; i < MaxQueuedChanges+50; i++ {
+		Increment(given, "count", 1)
+	}
+	given.AddEntries(NewEntry("last", 1))
+	close(release)
+
+	// -- Then
+	//
+	s.Eventually(func() bool {
+		return len(s.changes()) == MaxQueuedChanges+1
+	}, 5*time.Second, 5*time.Millisecond)
+	actual := s.changes()
+	s.Equal(Change{Key: "first", New: 1}, actual[0])
+	s.Equal(Change{Key: "count", Old: int64(1), New: int64(2)}, actual[1])
+	s.Equal(Change{Key: "count", Old: int64(MaxQueuedChanges - 1), New: int64(MaxQueuedChanges + 50)}, actual[MaxQueuedChanges-1])
+	s.Equal(Change{Key: "last", New: 1}, actual[MaxQueuedChanges])
+}
+
+func (s *SubscribeTestSuite) TestUnsubscribe() {
+	// -- Given
+	//
+	given := NewStore().(MemoryStore)
+	unsubscribe, err := given.Subscribe("", s.onChange)
+	s.Require().NoError(err)
+
+	// -- When
+	//
+	unsubscribe()
+	unsubscribe()
+	given.AddEntries(NewEntry("players", 1))
+
+	// -- Then
+	//
+	time.Sleep(20 * time.Millisecond)
+	s.Empty(s.changes())
+}
+
+func (s *SubscribeTestSuite) TestWatch() {
+	// -- Given
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	given := NewStore().(MemoryStore)
+	actual, err := Watch(ctx, given, "players")
+	s.Require().NoError(err)
+
+	// -- When
+	//
+	given.AddEntries(NewEntry("players", 1), NewEntry("players", 1), NewEntry("players", 2))
+
+	// -- Then
+	//
+	s.Equal(Change{Key: "players", New: 1}, <-actual)
+	s.Equal(Change{Key: "players", Old: 1, New: 2}, <-actual)
+	cancel()
+	for range actual {
+	}
+}
+
+func (s *SubscribeTestSuite) onChange(c Change) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Changes = append(s.Changes, c)
+}
+
+func (s *SubscribeTestSuite) changes() []Change {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Change(nil), s.Changes...)
+}
+
+func TestSubscribeTestSuite(t *testing.T) {
+	suite.Run(t, new(SubscribeTestSuite))
+}
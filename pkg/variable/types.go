@@ -0,0 +1,249 @@
+package variable
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hostfactor/diazo/pkg/except"
+	"github.com/sirupsen/logrus"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of a variable's value. Variables are always strings within the app service and blueprints so the
+// type is how a value is converted back e.g. a player count that was captured from a log.
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeInt    Type = "int"
+	TypeFloat  Type = "float"
+	TypeBool   Type = "bool"
+
+	// TypeList is a List. Strings are decoded as a JSON array or, if they aren't one, split on commas.
+	TypeList Type = "list"
+
+	// TypeJson is a JSON object or array. Strings are decoded as JSON.
+	TypeJson Type = "json"
+)
+
+// Valid is whether the type is one of the declared types.
+func (t Type) Valid() bool {
+	switch t {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeList, TypeJson:
+		return true
+	}
+	return false
+}
+
+// TypeOf is the Type of a raw value. Values that are not a string, number, bool or List are TypeJson.
+func TypeOf(val interface{}) Type {
+	switch val.(type) {
+	case string:
+		return TypeString
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return TypeInt
+	case float32, float64:
+		return TypeFloat
+	case bool:
+		return TypeBool
+	case List, []string:
+		return TypeList
+	}
+	return TypeJson
+}
+
+// Coerce converts the value to the type. Strings are parsed e.g. "12" is int64 12 and "true" is true. Ints are int64
+// and floats are float64. JSON numbers are int64 if they're whole, otherwise float64.
+func Coerce(typ Type, val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	switch typ {
+	case TypeString:
+		return FormatValue(val), nil
+	case TypeInt:
+		switch v := val.(type) {
+		case float32:
+			return floatToInt(float64(v))
+		case float64:
+			return floatToInt(v)
+		case bool:
+			return nil, except.NewInvalid("cannot convert %t to an int", v)
+		}
+		if TypeOf(val) == TypeInt {
+			return ToInt(val), nil
+		}
+		s := strings.TrimSpace(FormatValue(val))
+		out, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(s, 64)
+			if ferr != nil {
+				return nil, except.NewInvalid("cannot convert %s to an int", s)
+			}
+			return floatToInt(f)
+		}
+		return out, nil
+	case TypeFloat:
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		}
+		if TypeOf(val) == TypeInt {
+			return float64(ToInt(val)), nil
+		}
+		s := strings.TrimSpace(FormatValue(val))
+		out, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, except.NewInvalid("cannot convert %s to a float", s)
+		}
+		return out, nil
+	case TypeBool:
+		if v, ok := val.(bool); ok {
+			return v, nil
+		}
+		s := strings.TrimSpace(FormatValue(val))
+		switch strings.ToLower(s) {
+		case "1", "t", "true", "yes", "y", "on":
+			return true, nil
+		case "0", "f", "false", "no", "n", "off", "":
+			return false, nil
+		}
+		return nil, except.NewInvalid("cannot convert %s to a bool", s)
+	case TypeList:
+		return ToList(val), nil
+	case TypeJson:
+		var b []byte
+		switch v := val.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			var err error
+			b, err = json.Marshal(v)
+			if err != nil {
+				return nil, except.NewInvalid("cannot convert %v to json: %s", v, err.Error())
+			}
+		}
+		return decodeJson(b)
+	}
+	return nil, except.NewInvalid("unknown variable type %s", typ)
+}
+
+// FormatValue is the string value of a raw value as it's stored within a blueprint.Variable and sent to the app service.
+// Floats use the fewest digits needed, Lists are encoded as JSON arrays and JSON values are encoded. The string can be
+// converted back with Coerce.
+func FormatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case List:
+		return formatList(v)
+	case []string:
+		return formatList(v)
+	case fmt.Stringer:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case []byte:
+		return string(v)
+	}
+
+	switch TypeOf(val) {
+	case TypeJson:
+		b, err := json.Marshal(val)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// CoerceEntries converts the value of every entry with a declared type. The values within a map entry e.g. the groups
+// of LogNamedGroupEntries are also converted if their key is declared. Values that can't be converted are left as-is.
+func CoerceEntries(types map[string]Type, entries ...*Entry) []*Entry {
+	if len(types) == 0 {
+		return entries
+	}
+
+	out := make([]*Entry, 0, len(entries))
+	for _, v := range entries {
+		if typ, ok := types[v.Key]; ok {
+			out = append(out, &Entry{Key: v.Key, Val: coerceOrKeep(v.Key, typ, v.Val), DisplayName: v.DisplayName})
+			continue
+		}
+
+		if m, ok := v.Val.(map[string]any); ok {
+			coerced := make(map[string]any, len(m))
+			for k, val := range m {
+				if typ, ok := types[k]; ok {
+					val = coerceOrKeep(k, typ, val)
+				}
+				coerced[k] = val
+			}
+			out = append(out, &Entry{Key: v.Key, Val: coerced, DisplayName: v.DisplayName})
+			continue
+		}
+
+		out = append(out, v)
+	}
+	return out
+}
+
+// floatToInt converts a whole number e.g. 3.0 from JSON. Fractions aren't truncated.
+func floatToInt(f float64) (interface{}, error) {
+	if f != math.Trunc(f) || math.IsInf(f, 0) || f > math.MaxInt64 || f < math.MinInt64 {
+		return nil, except.NewInvalid("cannot convert %s to an int", FormatValue(f))
+	}
+	return int64(f), nil
+}
+
+func coerceOrKeep(key string, typ Type, val interface{}) interface{} {
+	out, err := Coerce(typ, val)
+	if err != nil {
+		logrus.WithError(err).WithField("variable", key).Debug("Failed to convert variable.")
+		return val
+	}
+	return out
+}
+
+// decodeJson decodes JSON with whole numbers as int64 and every other number as float64.
+func decodeJson(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out interface{}
+	err := dec.Decode(&out)
+	if err != nil {
+		return nil, except.NewInvalid("invalid json: %s", err.Error())
+	}
+	return normalizeJson(out), nil
+}
+
+func normalizeJson(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeJson(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeJson(e)
+		}
+	}
+	return val
+}